@@ -21,7 +21,12 @@ function encodeURIMin (s: string) {
 
 const { searchParams } = new URL(location.href)
 
-export const token = searchParams.get('token') || ''
+function getCookie (name: string) {
+  const m = document.cookie.match(new RegExp(`(?:^|; )${name}=([^;]*)`))
+  return m ? decodeURIComponent(m[1]) : ''
+}
+
+export const token = searchParams.get('token') || getCookie('csrf_token')
 
 export const api = axios.create({
   headers: {
@@ -102,7 +107,9 @@ api.interceptors.response.use(
 
     // eslint-disable-next-line no-console
     console.error(err)
-    Snackbar.open(err.message)
+
+    const apiError = err.response?.data?.error
+    Snackbar.open(apiError ? apiError.message : err.message)
 
     return err
   }
@@ -37,8 +37,13 @@ window.open = function (url) {
   return new Tab({ url }).iframeElement?.contentWindow || null
 }
 window.openExternal = function (url) {
+  const m = document.cookie.match(/(?:^|; )csrf_token=([^;]*)/)
+
   fetch(`/api/openURL?url=${encodeURIComponent(url)}`, {
-    method: 'POST'
+    method: 'POST',
+    headers: {
+      'CSRF-Token': m ? decodeURIComponent(m[1]) : ''
+    }
   })
 }
 
@@ -1,89 +1,119 @@
 package main
 
-/*
-#cgo darwin LDFLAGS: -framework CoreGraphics
-#cgo linux pkg-config: x11
-#if defined(__APPLE__)
-#include <CoreGraphics/CGDisplayConfiguration.h>
-int display_width() {
-	return CGDisplayPixelsWide(CGMainDisplayID());
-}
-int display_height() {
-	return CGDisplayPixelsHigh(CGMainDisplayID());
-}
-#elif defined(_WIN32)
-#include <wtypes.h>
-int display_width() {
-	RECT desktop;
-	const HWND hDesktop = GetDesktopWindow();
-	GetWindowRect(hDesktop, &desktop);
-	return desktop.right;
-}
-int display_height() {
-	RECT desktop;
-	const HWND hDesktop = GetDesktopWindow();
-	GetWindowRect(hDesktop, &desktop);
-	return desktop.bottom;
-}
-#else
-#include <X11/Xlib.h>
-int display_width() {
-	Display* d = XOpenDisplay(NULL);
-	Screen*  s = DefaultScreenOfDisplay(d);
-	return s->width - 50;
-}
-int display_height() {
-	Display* d = XOpenDisplay(NULL);
-	Screen*  s = DefaultScreenOfDisplay(d);
-	return s->height - 50;
-}
-#endif
-*/
-import "C"
 import (
+	"context"
+	"flag"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/webview/webview"
 	"github.com/zhquiz/go-zhquiz/server"
 	"github.com/zhquiz/go-zhquiz/server/api"
+	"github.com/zhquiz/go-zhquiz/server/cli"
 	"github.com/zhquiz/go-zhquiz/shared"
 )
 
 func main() {
 	shared.Load()
 
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		res := api.Prepare()
+		e := cli.Run(&res, os.Args[1:])
+		res.Cleanup()
+
+		if e != nil {
+			fmt.Fprintln(os.Stderr, e)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	serve := fs.Bool("serve", false, "serve the web UI without the webview, e.g. to other devices on the network")
+	host := fs.String("host", shared.Host(), "bind address, e.g. 0.0.0.0 for all interfaces")
+	port := fs.Int("port", shared.Port(), "port")
+	fsck := fs.String("fsck", shared.Fsck(), "check FTS tables on startup, either \"check\", or \"repair\" to also rebuild them if needed")
+
+	args := make([]string, 0)
+	for _, a := range os.Args[1:] {
+		// macOS adds -psn_* when launched from Finder
+		if !strings.HasPrefix(a, "-psn_") {
+			args = append(args, a)
+		}
+	}
+	fs.Parse(args)
+
+	if *fsck != "" && *fsck != "check" && *fsck != "repair" {
+		log.Fatalf("invalid --fsck: %s\n", *fsck)
+	}
+
+	// Other devices are refused, rather than let in without a password
+	if !shared.IsLoopback(*host) && shared.Password() == "" {
+		log.Fatalf("--host %q is reachable from other devices, so ZHQUIZ_PASSWORD must be set\n", *host)
+	}
+
 	res := api.Prepare()
 	defer res.Cleanup()
 
-	server.Serve(&res)
+	res.DB.StartBackups(shared.BackupInterval())
+
+	if *fsck != "" {
+		before, after, e := res.Fsck(*fsck == "repair")
+		if e != nil {
+			log.Fatalln(e)
+		}
 
-	if !shared.IsDebug() {
-		url := fmt.Sprintf("http://localhost:%d", shared.Port())
+		log.Printf("fsck: %d issues found\n", len(before.Issues))
+		for _, issue := range before.Issues {
+			log.Printf("fsck: %s %s %s %v\n", issue.Table, issue.ID, issue.Problem, issue.Columns)
+		}
 
-		for {
-			time.Sleep(1 * time.Second)
-			_, err := http.Head(url)
-			if err == nil {
-				break
-			}
+		if after != nil {
+			log.Printf("fsck: rebuilt FTS tables, %d issues remaining\n", len(after.Issues))
 		}
+	}
+
+	opts := server.Options{
+		Host: *host,
+		Port: *port,
+	}
+
+	if *serve || !shared.IsLoopback(*host) {
+		opts.Password = shared.Password()
+	}
+
+	srv := server.Serve(&res, opts)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
 
-		w := webview.New(true)
-		defer w.Destroy()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Println(err)
+		}
+	}()
 
-		w.SetSize(int(C.display_width()), int(C.display_height()), webview.HintNone)
-		w.SetTitle("ZhQuiz")
-		w.Navigate(url + "/etabs.html")
-		w.Run()
-	} else {
-		c := make(chan os.Signal, 2)
-		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
+	if *serve || shared.IsDebug() {
 		<-c
+		return
+	}
+
+	for {
+		time.Sleep(1 * time.Second)
+		_, err := http.Head(srv.URL)
+		if err == nil {
+			break
+		}
+	}
+
+	if err := openWindow(srv.URL, c); err != nil {
+		log.Println(err)
 	}
 }
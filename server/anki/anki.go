@@ -0,0 +1,224 @@
+package anki
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Model is Anki note type
+type Model struct {
+	ID     int64    `json:"id"`
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"`
+}
+
+// Note is Anki note, along with review stats of its cards
+type Note struct {
+	ID      int64             `json:"id"`
+	ModelID int64             `json:"modelId"`
+	Fields  map[string]string `json:"fields"`
+	Tags    []string          `json:"tags"`
+
+	// Interval is the longest interval of its review cards, in days
+	Interval int `json:"interval"`
+	Reps     int `json:"reps"`
+	Lapses   int `json:"lapses"`
+}
+
+// Collection is the content of .apkg
+type Collection struct {
+	Models []Model `json:"models"`
+	Notes  []Note  `json:"notes"`
+}
+
+// Read reads .apkg, i.e. zip of collection.anki2 (or .anki21) and media.
+// Media are ignored.
+func Read(r io.ReaderAt, size int64) (*Collection, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+
+	f := files["collection.anki21"]
+	if f == nil {
+		f = files["collection.anki2"]
+	}
+	if f == nil {
+		if files["collection.anki21b"] != nil {
+			return nil, errors.New("collection.anki21b is not supported, please export with legacy support from Anki")
+		}
+		return nil, errors.New("not an .apkg: collection.anki2 not found")
+	}
+
+	tmp, err := ioutil.TempFile("", "zhquiz-*.anki2")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := func() error {
+		defer tmp.Close()
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		_, err = io.Copy(tmp, rc)
+		return err
+	}(); err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(sqlite.Open(tmp.Name()+"?mode=ro"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	defer sqlDB.Close()
+
+	return readCollection(db)
+}
+
+func readCollection(db *gorm.DB) (*Collection, error) {
+	out := Collection{
+		Models: make([]Model, 0),
+		Notes:  make([]Note, 0),
+	}
+
+	var modelsJSON string
+	if err := db.Raw("SELECT models FROM col").Row().Scan(&modelsJSON); err != nil {
+		return nil, err
+	}
+
+	var models map[string]struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+		Flds []struct {
+			Name string `json:"name"`
+			Ord  int    `json:"ord"`
+		} `json:"flds"`
+	}
+	if err := json.Unmarshal([]byte(modelsJSON), &models); err != nil {
+		return nil, fmt.Errorf("cannot parse note types: %w", err)
+	}
+
+	modelMap := map[int64]Model{}
+	for _, m := range models {
+		sort.Slice(m.Flds, func(i, j int) bool {
+			return m.Flds[i].Ord < m.Flds[j].Ord
+		})
+
+		it := Model{
+			ID:     m.ID,
+			Name:   m.Name,
+			Fields: make([]string, 0),
+		}
+		for _, f := range m.Flds {
+			it.Fields = append(it.Fields, f.Name)
+		}
+
+		modelMap[m.ID] = it
+		out.Models = append(out.Models, it)
+	}
+
+	sort.Slice(out.Models, func(i, j int) bool {
+		return out.Models[i].Name < out.Models[j].Name
+	})
+
+	type cardStat struct {
+		Nid      int64
+		Interval int
+		Reps     int
+		Lapses   int
+	}
+	var cardStats []cardStat
+	if r := db.Raw(`
+	SELECT nid Nid, MAX(ivl) Interval, SUM(reps) Reps, SUM(lapses) Lapses
+	FROM cards
+	GROUP BY nid
+	`).Scan(&cardStats); r.Error != nil {
+		return nil, r.Error
+	}
+
+	statMap := map[int64]cardStat{}
+	for _, c := range cardStats {
+		statMap[c.Nid] = c
+	}
+
+	rows, err := db.Raw("SELECT id, mid, flds, tags FROM notes ORDER BY id").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n Note
+		var flds, tags string
+		if err := rows.Scan(&n.ID, &n.ModelID, &flds, &tags); err != nil {
+			return nil, err
+		}
+
+		n.Fields = map[string]string{}
+		names := modelMap[n.ModelID].Fields
+		for i, v := range strings.Split(flds, "\x1f") {
+			if i < len(names) {
+				n.Fields[names[i]] = StripHTML(v)
+			}
+		}
+
+		n.Tags = strings.Fields(tags)
+
+		if c, ok := statMap[n.ID]; ok {
+			// Negative intervals are learning steps, in seconds
+			if c.Interval > 0 {
+				n.Interval = c.Interval
+			}
+			n.Reps = c.Reps
+			n.Lapses = c.Lapses
+		}
+
+		out.Notes = append(out.Notes, n)
+	}
+
+	return &out, rows.Err()
+}
+
+var reSound = regexp.MustCompile(`\[sound:[^\]]*\]`)
+var reBreak = regexp.MustCompile(`(?i)<br\s*/?>|</div>|</p>`)
+var reTag = regexp.MustCompile(`<[^>]*>`)
+
+// StripHTML converts Anki field to plain text
+func StripHTML(s string) string {
+	s = reSound.ReplaceAllString(s, "")
+	s = reBreak.ReplaceAllString(s, "\n")
+	s = reTag.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,76 @@
+package anki
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestWriteRead(t *testing.T) {
+	cards := []Card{
+		{GUID: "zhquiz-q1", Front: "你好", Back: "ni3 hao3<br>hello", Tags: []string{"t1", "level1"}},
+		{GUID: "zhquiz-q2", Front: "a &lt; b", Back: "<b>c</b> [sound:c.mp3]"},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "ZhQuiz", cards); err != nil {
+		t.Fatal(err)
+	}
+
+	col, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(col.Models) != 1 || col.Models[0].ID != modelID || col.Models[0].Name != "ZhQuiz" ||
+		!reflect.DeepEqual(col.Models[0].Fields, []string{"Front", "Back"}) {
+		t.Fatalf("note types are %+v", col.Models)
+	}
+
+	want := []Note{
+		{ModelID: modelID, Fields: map[string]string{"Front": "你好", "Back": "ni3 hao3\nhello"}, Tags: []string{"t1", "level1"}},
+		{ModelID: modelID, Fields: map[string]string{"Front": "a < b", "Back": "c"}, Tags: []string{}},
+	}
+
+	if len(col.Notes) != len(want) {
+		t.Fatalf("read %d notes, not %d", len(col.Notes), len(want))
+	}
+
+	for i, n := range col.Notes {
+		n.ID = 0
+		if !reflect.DeepEqual(n, want[i]) {
+			t.Errorf("note %d is %+v, not %+v", i, n, want[i])
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		b    []byte
+	}{
+		{"empty", []byte{}},
+		{"not zip", []byte("collection.anki2")},
+	} {
+		if _, err := Read(bytes.NewReader(c.b), int64(len(c.b))); err == nil {
+			t.Errorf("%s is read", c.name)
+		}
+	}
+}
+
+func TestStripHTML(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want string
+	}{
+		{"你好", "你好"},
+		{"<div>ni3 hao3</div><div>hello</div>", "ni3 hao3\nhello"},
+		{"a<br />b<BR>c", "a\nb\nc"},
+		{"&lt;b&gt; &amp;nbsp;", "<b> &nbsp;"},
+		{"[sound:ni3.mp3] 你", "你"},
+	} {
+		if out := StripHTML(c.in); out != c.want {
+			t.Errorf("%q is %q, not %q", c.in, out, c.want)
+		}
+	}
+}
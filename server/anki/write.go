@@ -0,0 +1,330 @@
+package anki
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Card is a note of the basic (front / back) note type, to be written to .apkg
+type Card struct {
+	// GUID identifies the note, so that re-importing into Anki updates it
+	GUID  string
+	Front string
+	Back  string
+	Tags  []string
+}
+
+const schema = `
+CREATE TABLE col (
+	id integer primary key, crt integer not null, mod integer not null, scm integer not null,
+	ver integer not null, dty integer not null, usn integer not null, ls integer not null,
+	conf text not null, models text not null, decks text not null, dconf text not null, tags text not null
+);
+CREATE TABLE notes (
+	id integer primary key, guid text not null, mid integer not null, mod integer not null,
+	usn integer not null, tags text not null, flds text not null, sfld integer not null,
+	csum integer not null, flags integer not null, data text not null
+);
+CREATE TABLE cards (
+	id integer primary key, nid integer not null, did integer not null, ord integer not null,
+	mod integer not null, usn integer not null, type integer not null, queue integer not null,
+	due integer not null, ivl integer not null, factor integer not null, reps integer not null,
+	lapses integer not null, left integer not null, odue integer not null, odid integer not null,
+	flags integer not null, data text not null
+);
+CREATE TABLE revlog (
+	id integer primary key, cid integer not null, usn integer not null, ease integer not null,
+	ivl integer not null, lastIvl integer not null, factor integer not null, time integer not null,
+	type integer not null
+);
+CREATE TABLE graves (usn integer not null, oid integer not null, type integer not null);
+CREATE INDEX ix_notes_usn ON notes (usn);
+CREATE INDEX ix_cards_usn ON cards (usn);
+CREATE INDEX ix_revlog_usn ON revlog (usn);
+CREATE INDEX ix_cards_nid ON cards (nid);
+CREATE INDEX ix_cards_sched ON cards (did, queue, due);
+CREATE INDEX ix_revlog_cid ON revlog (cid);
+CREATE INDEX ix_notes_csum ON notes (csum);
+`
+
+// Model and deck IDs are fixed, so that repeated exports go to the same note type and deck
+const (
+	modelID int64 = 1607997720000
+	deckID  int64 = 1607997720001
+)
+
+// Write writes cards as .apkg, in a new deck
+func Write(w io.Writer, deckName string, cards []Card) error {
+	tmp, err := ioutil.TempFile("", "zhquiz-*.anki2")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := writeCollection(tmp.Name(), deckName, cards); err != nil {
+		return err
+	}
+
+	z := zip.NewWriter(w)
+
+	f, err := z.Create("collection.anki2")
+	if err != nil {
+		return err
+	}
+
+	if err := func() error {
+		rc, err := os.Open(tmp.Name())
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		_, err = io.Copy(f, rc)
+		return err
+	}(); err != nil {
+		return err
+	}
+
+	f, err = z.Create("media")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write([]byte("{}")); err != nil {
+		return err
+	}
+
+	return z.Close()
+}
+
+func writeCollection(filename string, deckName string, cards []Card) error {
+	db, err := gorm.Open(sqlite.Open(filename), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range strings.Split(schema, ";") {
+			if strings.TrimSpace(stmt) == "" {
+				continue
+			}
+
+			if r := tx.Exec(stmt); r.Error != nil {
+				return r.Error
+			}
+		}
+
+		now := time.Now()
+		mod := now.Unix()
+
+		models, decks, dconf, conf, err := collectionConfig(deckName, mod)
+		if err != nil {
+			return err
+		}
+
+		if r := tx.Exec(`
+		INSERT INTO col (id, crt, mod, scm, ver, dty, usn, ls, conf, models, decks, dconf, tags)
+		VALUES (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}')
+		`, mod, mod*1000, mod*1000, conf, models, decks, dconf); r.Error != nil {
+			return r.Error
+		}
+
+		// Note and card IDs are creation time in milliseconds, and must be unique
+		id := now.UnixNano() / int64(time.Millisecond)
+
+		for i, c := range cards {
+			id++
+
+			tags := ""
+			if len(c.Tags) > 0 {
+				tags = " " + strings.Join(c.Tags, " ") + " "
+			}
+
+			if r := tx.Exec(`
+			INSERT INTO notes (id, guid, mid, mod, usn, tags, flds, sfld, csum, flags, data)
+			VALUES (?, ?, ?, ?, -1, ?, ?, ?, ?, 0, '')
+			`, id, c.GUID, modelID, mod, tags, c.Front+"\x1f"+c.Back, c.Front, checksum(c.Front)); r.Error != nil {
+				return r.Error
+			}
+
+			if r := tx.Exec(`
+			INSERT INTO cards (id, nid, did, ord, mod, usn, type, queue, due, ivl, factor, reps, lapses, left, odue, odid, flags, data)
+			VALUES (?, ?, ?, 0, ?, -1, 0, 0, ?, 0, 0, 0, 0, 0, 0, 0, 0, '')
+			`, id, id, deckID, mod, i+1); r.Error != nil {
+				return r.Error
+			}
+		}
+
+		return nil
+	})
+}
+
+// checksum is the first 8 hex digits of SHA1 of the stripped sort field
+func checksum(s string) int64 {
+	h := sha1.Sum([]byte(StripHTML(s)))
+	n, _ := strconv.ParseInt(hex.EncodeToString(h[:])[:8], 16, 64)
+	return n
+}
+
+// collectionConfig makes JSON columns of col, with a note type of Front and Back, and a deck of deckName
+func collectionConfig(deckName string, mod int64) (models, decks, dconf, conf string, err error) {
+	type obj = map[string]interface{}
+
+	mid := strconv.FormatInt(modelID, 10)
+	did := strconv.FormatInt(deckID, 10)
+
+	field := func(name string, ord int) obj {
+		return obj{
+			"name":   name,
+			"ord":    ord,
+			"sticky": false,
+			"rtl":    false,
+			"font":   "Arial",
+			"size":   20,
+			"media":  []string{},
+		}
+	}
+
+	deck := func(id int64, name string) obj {
+		return obj{
+			"id":               id,
+			"name":             name,
+			"desc":             "",
+			"mod":              mod,
+			"usn":              -1,
+			"collapsed":        false,
+			"browserCollapsed": false,
+			"newToday":         []int{0, 0},
+			"revToday":         []int{0, 0},
+			"lrnToday":         []int{0, 0},
+			"timeToday":        []int{0, 0},
+			"dyn":              0,
+			"extendNew":        10,
+			"extendRev":        50,
+			"conf":             1,
+		}
+	}
+
+	// toJSON keeps the first error, to be returned
+	toJSON := func(v interface{}) string {
+		b, e := json.Marshal(v)
+		if e != nil && err == nil {
+			err = e
+		}
+		return string(b)
+	}
+
+	models = toJSON(obj{
+		mid: obj{
+			"id":    modelID,
+			"name":  "ZhQuiz",
+			"type":  0,
+			"mod":   mod,
+			"usn":   -1,
+			"sortf": 0,
+			"did":   deckID,
+			"tmpls": []obj{
+				{
+					"name":  "Card 1",
+					"ord":   0,
+					"qfmt":  "{{Front}}",
+					"afmt":  "{{FrontSide}}\n\n<hr id=answer>\n\n{{Back}}",
+					"did":   nil,
+					"bqfmt": "",
+					"bafmt": "",
+				},
+			},
+			"flds":      []obj{field("Front", 0), field("Back", 1)},
+			"css":       ".card {\n font-family: arial;\n font-size: 20px;\n text-align: center;\n color: black;\n background-color: white;\n}\n",
+			"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+			"latexPost": "\\end{document}",
+			"req":       []interface{}{[]interface{}{0, "any", []int{0}}},
+			"tags":      []string{},
+			"vers":      []string{},
+		},
+	})
+
+	decks = toJSON(obj{
+		"1": deck(1, "Default"),
+		did: deck(deckID, deckName),
+	})
+
+	dconf = toJSON(obj{
+		"1": obj{
+			"id":       1,
+			"name":     "Default",
+			"mod":      0,
+			"usn":      0,
+			"maxTaken": 60,
+			"autoplay": true,
+			"timer":    0,
+			"replayq":  true,
+			"dyn":      false,
+			"new": obj{
+				"delays":        []float64{1, 10},
+				"ints":          []int{1, 4, 7},
+				"initialFactor": 2500,
+				"separate":      true,
+				"order":         1,
+				"perDay":        20,
+				"bury":          false,
+			},
+			"rev": obj{
+				"perDay":     200,
+				"ease4":      1.3,
+				"fuzz":       0.05,
+				"minSpace":   1,
+				"ivlFct":     1,
+				"maxIvl":     36500,
+				"bury":       false,
+				"hardFactor": 1.2,
+			},
+			"lapse": obj{
+				"delays":      []float64{10},
+				"mult":        0,
+				"minInt":      1,
+				"leechFails":  8,
+				"leechAction": 0,
+			},
+		},
+	})
+
+	conf = toJSON(obj{
+		"nextPos":       1,
+		"estTimes":      true,
+		"activeDecks":   []int64{1},
+		"sortType":      "noteFld",
+		"timeLim":       0,
+		"sortBackwards": false,
+		"addToCur":      true,
+		"curDeck":       1,
+		"newBury":       true,
+		"newSpread":     0,
+		"dueCounts":     true,
+		"curModel":      mid,
+		"collapseTime":  1200,
+	})
+
+	return
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// routerAdmin maintains data.db, for all profiles
+func routerAdmin(apiRouter *gin.RouterGroup) {
+	r := apiRouter.Group("/admin")
+
+	r.GET("/fsck", wrap(func(ctx *gin.Context) error {
+		result, _, e := resource.Fsck(false)
+		if e != nil {
+			return e
+		}
+
+		ctx.JSON(200, gin.H{
+			"result": result,
+		})
+		return nil
+	}))
+
+	r.POST("/fsck", wrap(func(ctx *gin.Context) error {
+		result, after, e := resource.Fsck(true)
+		if e != nil {
+			return e
+		}
+
+		ctx.JSON(201, gin.H{
+			"result":   result,
+			"repaired": after != nil,
+			"after":    after,
+		})
+		return nil
+	}))
+}
@@ -0,0 +1,377 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"mime/multipart"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhquiz/go-zhquiz/server/anki"
+	"github.com/zhquiz/go-zhquiz/server/db"
+	"gorm.io/gorm"
+)
+
+func routerAnki(apiRouter *gin.RouterGroup) {
+	r := apiRouter.Group("/anki")
+
+	r.POST("/fields", wrap(func(ctx *gin.Context) error {
+		var form ankiFileForm
+
+		if e := ctx.ShouldBind(&form); e != nil {
+			return Validation(e)
+		}
+
+		col, e := readAnkiFile(form.File)
+		if e != nil {
+			return Validation(e)
+		}
+
+		result := make([]ankiModelResult, 0)
+
+		for _, m := range col.Models {
+			it := ankiModelResult{
+				Model: m,
+			}
+
+			for _, n := range col.Notes {
+				if n.ModelID == m.ID {
+					if it.Sample == nil {
+						sample := n.Fields
+						it.Sample = &sample
+					}
+					it.Count++
+				}
+			}
+
+			result = append(result, it)
+		}
+
+		ctx.JSON(200, gin.H{
+			"result": result,
+		})
+		return nil
+	}))
+
+	r.POST("/import", wrap(func(ctx *gin.Context) error {
+		var form ankiImportForm
+
+		if e := ctx.ShouldBind(&form); e != nil {
+			return Validation(e)
+		}
+
+		col, e := readAnkiFile(form.File)
+		if e != nil {
+			return Validation(e)
+		}
+
+		reHan := regexp.MustCompile(`\p{Han}`)
+		now := time.Now()
+
+		ids := make([]string, 0)
+		skipped := 0
+
+		if _, e := resource.DB.Backup("import"); e != nil {
+			return fmt.Errorf("cannot back up before import: %w", e)
+		}
+
+		e = resource.DB.Current().Transaction(func(tx *gorm.DB) error {
+			for _, n := range col.Notes {
+				if form.ModelID != 0 && n.ModelID != form.ModelID {
+					continue
+				}
+
+				entry := strings.TrimSpace(strings.SplitN(n.Fields[form.Chinese], "\n", 2)[0])
+				if !reHan.MatchString(entry) {
+					skipped++
+					continue
+				}
+
+				qType := form.Type
+				if qType == "" {
+					t, e := guessQuizType(entry)
+					if e != nil {
+						return e
+					}
+					qType = t
+				}
+
+				body := quizAddBody{
+					Entries:     []string{entry},
+					Type:        qType,
+					Description: n.Fields[form.Description],
+					Tag:         strings.Join(n.Tags, " "),
+					Pinyin: map[string]string{
+						entry: n.Fields[form.Pinyin],
+					},
+					English: map[string]string{
+						entry: n.Fields[form.English],
+					},
+				}
+
+				result, e := addQuizzes(tx, userID(ctx), body)
+				if e != nil {
+					return e
+				}
+
+				for _, r := range result {
+					ids = append(ids, r.IDs...)
+
+					if form.History && n.Interval > 0 && len(r.IDs) > 0 {
+						srsLevel := db.SRSLevelOf(time.Duration(n.Interval) * 24 * time.Hour)
+						nextReview := now.Add(db.SRSInterval(srsLevel))
+
+						if r := tx.Model(&db.Quiz{}).
+							Where("id IN ? AND srs_level IS NULL", r.IDs).
+							Updates(map[string]interface{}{
+								"srs_level":   srsLevel,
+								"next_review": nextReview,
+							}); r.Error != nil {
+							return r.Error
+						}
+					}
+				}
+			}
+
+			return nil
+		})
+
+		if e != nil {
+			return e
+		}
+
+		ctx.JSON(201, gin.H{
+			"ids":     ids,
+			"skipped": skipped,
+		})
+		return nil
+	}))
+}
+
+type ankiModelResult struct {
+	anki.Model
+	Count  int                `json:"count"`
+	Sample *map[string]string `json:"sample"`
+}
+
+type ankiFileForm struct {
+	File *multipart.FileHeader `form:"file" binding:"required"`
+}
+
+type ankiImportForm struct {
+	ankiFileForm
+	ModelID     int64  `form:"modelId"`
+	Chinese     string `form:"chinese" binding:"required"`
+	Pinyin      string `form:"pinyin"`
+	English     string `form:"english"`
+	Description string `form:"description"`
+	Type        string `form:"type" binding:"omitempty,oneof=hanzi vocab sentence"`
+	History     bool   `form:"history"`
+}
+
+func readAnkiFile(fh *multipart.FileHeader) (*anki.Collection, error) {
+	f, e := fh.Open()
+	if e != nil {
+		return nil, e
+	}
+	defer f.Close()
+
+	col, e := anki.Read(f, fh.Size)
+	if e != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", fh.Filename, e)
+	}
+
+	return col, nil
+}
+
+// guessQuizType guesses hanzi, vocab or sentence, from the built-in dictionaries
+func guessQuizType(entry string) (string, error) {
+	if len([]rune(entry)) == 1 {
+		return "hanzi", nil
+	}
+
+	for _, t := range []string{"vocab", "sentence"} {
+		source, _, e := quizSource(entry, t)
+		if e != nil {
+			return "", e
+		}
+
+		if source != "extra" {
+			return t, nil
+		}
+	}
+
+	if regexp.MustCompile(`[\p{P}\s]`).MatchString(entry) {
+		return "sentence", nil
+	}
+
+	return "vocab", nil
+}
+
+// quizCard is a quiz, resolved into front and back of a flashcard
+type quizCard struct {
+	ID        string
+	Entry     string
+	Type      string
+	Direction string
+	Pinyin    string
+	English   string
+	Front     string
+	Back      string
+	Tags      []string
+}
+
+// quizCards resolves quizzes into cards, one per quiz i.e. direction,
+// with tags from quiz_q, including levelN
+func quizCards(tx *gorm.DB, quizzes []db.Quiz) ([]quizCard, error) {
+	var fts []struct {
+		ID  string
+		Tag string
+	}
+
+	if r := tx.Raw("SELECT id ID, tag Tag FROM quiz_q").Scan(&fts); r.Error != nil {
+		return nil, r.Error
+	}
+
+	tagMap := map[string]string{}
+	for _, f := range fts {
+		tagMap[f.ID] = f.Tag
+	}
+
+	cards := make([]quizCard, 0)
+
+	for _, q := range quizzes {
+		c, e := q.Resolve(tx)
+		if e != nil {
+			return nil, e
+		}
+
+		card := quizCard{
+			ID:        q.ID,
+			Entry:     q.Entry,
+			Type:      q.Type,
+			Direction: q.Direction,
+			Pinyin:    joinUnique(c.Pinyin, " / "),
+			English:   joinUnique(c.English, " / "),
+			Tags:      strings.Fields(tagMap[q.ID]),
+		}
+
+		switch q.Direction {
+		case "ec":
+			card.Front = card.English
+			card.Back = joinUnique(append([]string{q.Entry}, card.Pinyin), "\n")
+		case "te":
+			card.Front = joinUnique(c.Traditional, " / ")
+			if card.Front == "" {
+				card.Front = q.Entry
+			}
+			card.Back = joinUnique([]string{q.Entry, card.Pinyin, card.English}, "\n")
+		default:
+			card.Front = q.Entry
+			card.Back = joinUnique([]string{card.Pinyin, card.English}, "\n")
+		}
+
+		cards = append(cards, card)
+	}
+
+	return cards, nil
+}
+
+// joinUnique joins non-empty strings, without duplicates
+func joinUnique(ss []string, sep string) string {
+	set := map[string]bool{}
+	out := make([]string, 0)
+
+	for _, s := range ss {
+		s = strings.TrimSpace(s)
+		if s != "" && !set[s] {
+			set[s] = true
+			out = append(out, s)
+		}
+	}
+
+	return strings.Join(out, sep)
+}
+
+// ankiHTML escapes text for Anki fields, which are HTML
+func ankiHTML(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>")
+}
+
+func writeQuizApkg(w io.Writer, cards []quizCard) error {
+	notes := make([]anki.Card, 0)
+
+	for _, c := range cards {
+		notes = append(notes, anki.Card{
+			GUID:  "zhquiz-" + c.ID,
+			Front: ankiHTML(c.Front),
+			Back:  ankiHTML(c.Back),
+			Tags:  c.Tags,
+		})
+	}
+
+	return anki.Write(w, "ZhQuiz", notes)
+}
+
+// writeQuizTSV writes Anki-importable TSV, with file headers
+func writeQuizTSV(w io.Writer, cards []quizCard) error {
+	if _, e := io.WriteString(w, "#separator:tab\n#html:true\n#guid column:1\n#tags column:9\n"); e != nil {
+		return e
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = '\t'
+
+	for _, c := range cards {
+		if e := cw.Write([]string{
+			"zhquiz-" + c.ID,
+			ankiHTML(c.Front),
+			ankiHTML(c.Back),
+			c.Entry,
+			c.Pinyin,
+			c.English,
+			c.Type,
+			c.Direction,
+			strings.Join(c.Tags, " "),
+		}); e != nil {
+			return e
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeQuizCSV writes plain text CSV, with a header row, for spreadsheets
+func writeQuizCSV(w io.Writer, cards []quizCard) error {
+	cw := csv.NewWriter(w)
+
+	if e := cw.Write([]string{
+		"id", "front", "back", "entry", "pinyin", "english", "type", "direction", "tags",
+	}); e != nil {
+		return e
+	}
+
+	for _, c := range cards {
+		if e := cw.Write([]string{
+			c.ID,
+			c.Front,
+			c.Back,
+			c.Entry,
+			c.Pinyin,
+			c.English,
+			c.Type,
+			c.Direction,
+			strings.Join(c.Tags, " "),
+		}); e != nil {
+			return e
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"mime/multipart"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhquiz/go-zhquiz/server/anki"
+	"github.com/zhquiz/go-zhquiz/server/db"
+)
+
+// exportTest makes a resource with quizzes of 你好, and of 猫咪, which is an extra, in all directions
+func exportTest(t *testing.T) Resource {
+	res := prepareTest(t)
+
+	for _, body := range []quizAddBody{
+		{Entries: []string{"你好"}, Type: "vocab", Tag: "t1"},
+		{Entries: []string{"猫咪"}, Type: "vocab", Pinyin: map[string]string{"猫咪": "mao1 mi1"}, English: map[string]string{"猫咪": "kitty <3"}},
+	} {
+		if _, err := addQuizzes(res.DB.Current(), db.DefaultUserID, body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return res
+}
+
+func TestExportApkg(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	res := exportTest(t)
+
+	var buf bytes.Buffer
+	if err := res.ExportQuizzes(&buf, "apkg", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	col, err := anki.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notes := make([]string, 0)
+	for _, n := range col.Notes {
+		tags := append([]string{}, n.Tags...)
+		sort.Strings(tags)
+		notes = append(notes, n.Fields["Front"]+" | "+n.Fields["Back"]+" | "+strings.Join(tags, " "))
+	}
+	sort.Strings(notes)
+
+	want := []string{
+		"hello | 你好\nni3 hao3 | level1 t1",
+		"kitty <3 | 猫咪\nmao1 mi1 | level",
+		"你好 | ni3 hao3\nhello | level1 t1",
+		"你好 | 你好\nni3 hao3\nhello | level1 t1",
+		// Extras have no traditional, so no te
+		"猫咪 | mao1 mi1\nkitty <3 | level",
+	}
+	if !reflect.DeepEqual(notes, want) {
+		t.Errorf("exported %q, not %q", notes, want)
+	}
+
+	// Imported back, as a new profile would
+	if r := res.DB.Current().Where("1 = 1").Delete(&db.Quiz{}); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+
+	r := gin.New()
+	res.Register(r, &Options{Token: "test"})
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for k, v := range map[string]string{
+		"modelId": "0",
+		"chinese": "Front",
+		"english": "Back",
+		"type":    "vocab",
+	} {
+		mw.WriteField(k, v)
+	}
+	fw, err := mw.CreateFormFile("file", "export.apkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(buf.Bytes())
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/api/anki/import", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set(CSRFHeader, "test")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != 201 {
+		t.Fatalf("import is %d: %s", w.Code, w.Body.String())
+	}
+
+	var quizzes []db.Quiz
+	if r := res.DB.Current().Order("entry, direction").Find(&quizzes); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+
+	entries := make([]string, 0)
+	for _, q := range quizzes {
+		entries = append(entries, q.Entry+" "+q.Direction)
+	}
+	if want := []string{"你好 ec", "你好 se", "你好 te", "猫咪 ec", "猫咪 se"}; !reflect.DeepEqual(entries, want) {
+		t.Errorf("imported %v, not %v", entries, want)
+	}
+
+	var tags []string
+	if r := res.DB.Current().Raw("SELECT tag FROM quiz_q WHERE entry = '你好'").Scan(&tags); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	for _, tag := range tags {
+		if !strings.Contains(" "+tag+" ", " t1 ") {
+			t.Errorf("tags of 你好 are %q", tag)
+		}
+	}
+}
+
+func TestExportTSV(t *testing.T) {
+	res := exportTest(t)
+
+	var buf bytes.Buffer
+	if err := res.ExportQuizzes(&buf, "tsv", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(buf.String(), "#separator:tab\n#html:true\n#guid column:1\n#tags column:9\n") {
+		t.Errorf("file headers are missing: %q", buf.String())
+	}
+
+	cr := csv.NewReader(&buf)
+	cr.Comma = '\t'
+	cr.Comment = '#'
+
+	rows, err := cr.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]string, 0)
+	for _, row := range rows {
+		if len(row) != 9 || !strings.HasPrefix(row[0], "zhquiz-") {
+			t.Errorf("row is %q", row)
+			continue
+		}
+
+		if row[3] != "猫咪" {
+			continue
+		}
+
+		// Front and back are HTML, as in .apkg, followed by the plain text of the front
+		got = append(got, strings.Join([]string{row[1], row[2], anki.StripHTML(row[1]), row[3], row[4], row[5], row[6], row[7], row[8]}, " | "))
+	}
+	sort.Strings(got)
+
+	want := []string{
+		"kitty &lt;3 | 猫咪<br>mao1 mi1 | kitty <3 | 猫咪 | mao1 mi1 | kitty <3 | vocab | ec | level",
+		"猫咪 | mao1 mi1<br>kitty &lt;3 | 猫咪 | 猫咪 | mao1 mi1 | kitty <3 | vocab | se | level",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("exported %q, not %q", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"errors"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhquiz/go-zhquiz/server/db"
+)
+
+// routerBackup manages backups of data.db, which are shared by all profiles
+func routerBackup(apiRouter *gin.RouterGroup) {
+	r := apiRouter.Group("/backup")
+
+	r.GET("/", wrap(func(ctx *gin.Context) error {
+		result, e := db.Backups()
+		if e != nil {
+			return e
+		}
+
+		ctx.JSON(200, gin.H{
+			"result": result,
+		})
+		return nil
+	}))
+
+	r.POST("/", wrap(func(ctx *gin.Context) error {
+		b, e := resource.DB.Backup("manual")
+		if e != nil {
+			return e
+		}
+
+		ctx.JSON(201, gin.H{
+			"result": b,
+		})
+		return nil
+	}))
+
+	r.POST("/restore", wrap(func(ctx *gin.Context) error {
+		var query backupRestoreQuery
+
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
+		}
+
+		before, e := resource.DB.Restore(query.Name)
+		if e != nil {
+			if errors.Is(e, os.ErrNotExist) {
+				return NotFound(e)
+			}
+			return e
+		}
+
+		ctx.JSON(201, gin.H{
+			"result": "restored",
+			"backup": before,
+		})
+		return nil
+	}))
+}
+
+type backupRestoreQuery struct {
+	Name string `form:"name" binding:"required"`
+}
@@ -1,71 +1,46 @@
 package api
 
 import (
-	"fmt"
-	"log"
-	"net/http"
-	"net/url"
-	"strconv"
-
 	"github.com/gin-gonic/gin"
+	"github.com/zhquiz/go-zhquiz/server/tts"
 )
 
 func routerChinese(apiRouter *gin.RouterGroup) {
 	r := apiRouter.Group("/chinese")
 
-	r.GET("/jieba", func(ctx *gin.Context) {
-		var query struct {
-			Q string `form:"q" binding:"required"`
-		}
+	r.GET("/jieba", wrap(func(ctx *gin.Context) error {
+		var query searchQuery
 
-		if e := ctx.BindQuery(&query); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
 		ctx.JSON(200, gin.H{
 			"result": cutChineseAll(query.Q),
 		})
-	})
+		return nil
+	}))
 
-	r.GET("/speak", func(ctx *gin.Context) {
-		var query struct {
-			Q string `form:"q" binding:"required"`
-		}
+	r.GET("/speak", wrap(func(ctx *gin.Context) error {
+		var query searchQuery
 
-		if e := ctx.BindQuery(&query); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
-		params := url.Values{}
-		params.Add("ie", "UTF-8")
-		params.Add("tl", "zh-CN")
-		params.Add("q", query.Q)
-		params.Add("total", "1")
-		params.Add("idx", "0")
-		params.Add("client", "tw-ob")
-		params.Add("textlen", strconv.Itoa(len(query.Q)))
-
-		req, err := http.NewRequest("GET", fmt.Sprintf("http://translate.google.com/translate_tts?%s", params.Encode()), nil)
-		if err != nil {
-			log.Fatalln(err)
+		dbUser, e := current(ctx).User()
+		if e != nil {
+			return e
 		}
 
-		req.Header.Add("Referrer", "http://translate.google.com/")
-		req.Header.Add("User-Agent", getUserAgent())
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded;charset=utf-8")
-
-		client := &http.Client{}
-		response, err := client.Do(req)
-		if err != nil {
-			panic(err)
+		audio, e := tts.New(dbUser.Meta.Settings.TTS).Speak(ctx.Request.Context(), query.Q)
+		if e != nil {
+			return Upstream(e)
 		}
 
-		defer response.Body.Close()
-
-		ctx.DataFromReader(200, response.ContentLength, response.Header.Get("Content-Type"), response.Body, map[string]string{})
-	})
+		ctx.Data(200, audio.ContentType, audio.Data)
+		return nil
+	}))
 }
 
 func cutChineseAll(s string) []string {
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// Codes of APIError
+const (
+	CodeNotFound            = "not_found"
+	CodeValidation          = "validation"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeConflict            = "conflict"
+	CodeUpstreamUnavailable = "upstream_unavailable"
+	CodeInternal            = "internal"
+)
+
+var codeStatus = map[string]int{
+	CodeNotFound:            http.StatusNotFound,
+	CodeValidation:          http.StatusBadRequest,
+	CodeUnauthorized:        http.StatusUnauthorized,
+	CodeForbidden:           http.StatusForbidden,
+	CodeConflict:            http.StatusConflict,
+	CodeUpstreamUnavailable: http.StatusBadGateway,
+	CodeInternal:            http.StatusInternalServerError,
+}
+
+// APIError is rendered as `{"error": {"code", "message", "details"}}`
+type APIError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+
+	Err error `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Err.Error()
+	}
+
+	return e.Code + ": " + e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Status is HTTP status code of Code
+func (e *APIError) Status() int {
+	if s, ok := codeStatus[e.Code]; ok {
+		return s
+	}
+
+	return http.StatusInternalServerError
+}
+
+func newAPIError(code string, err error) *APIError {
+	return &APIError{
+		Code:    code,
+		Message: err.Error(),
+		Err:     err,
+	}
+}
+
+// NotFound is APIError of CodeNotFound
+func NotFound(err error) *APIError {
+	return newAPIError(CodeNotFound, err)
+}
+
+// Validation is APIError of CodeValidation, with details of invalid fields, if any
+func Validation(err error) *APIError {
+	out := newAPIError(CodeValidation, err)
+
+	var ve validator.ValidationErrors
+	if errors.As(err, &ve) {
+		details := make([]gin.H, 0)
+		for _, fe := range ve {
+			details = append(details, gin.H{
+				"field": fe.Field(),
+				"tag":   fe.Tag(),
+				"param": fe.Param(),
+			})
+		}
+		out.Details = details
+	}
+
+	return out
+}
+
+// Unauthorized is APIError of CodeUnauthorized
+func Unauthorized(err error) *APIError {
+	return newAPIError(CodeUnauthorized, err)
+}
+
+// Forbidden is APIError of CodeForbidden
+func Forbidden(err error) *APIError {
+	return newAPIError(CodeForbidden, err)
+}
+
+// Conflict is APIError of CodeConflict
+func Conflict(err error) *APIError {
+	return newAPIError(CodeConflict, err)
+}
+
+// Upstream is APIError of CodeUpstreamUnavailable, e.g. online services or local engines
+func Upstream(err error) *APIError {
+	return newAPIError(CodeUpstreamUnavailable, err)
+}
+
+// Internal is APIError of CodeInternal
+func Internal(err error) *APIError {
+	return newAPIError(CodeInternal, err)
+}
+
+// toAPIError classifies errors not already APIError
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return NotFound(err)
+	}
+
+	var ve validator.ValidationErrors
+	var se *json.SyntaxError
+	var te *json.UnmarshalTypeError
+	if errors.As(err, &ve) || errors.As(err, &se) || errors.As(err, &te) {
+		return Validation(err)
+	}
+
+	if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return Conflict(err)
+	}
+
+	return Internal(err)
+}
+
+// handlerFunc is gin.HandlerFunc, returning error to be rendered by renderError
+type handlerFunc func(ctx *gin.Context) error
+
+// wrap converts handlerFunc to gin.HandlerFunc
+func wrap(h handlerFunc) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if err := h(ctx); err != nil {
+			ctx.Error(err)
+			ctx.Abort()
+		}
+	}
+}
+
+// renderError renders the last error of handlers, or panic, as APIError
+func renderError() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("panic: %v\n%s", r, debug.Stack())
+
+				err, ok := r.(error)
+				if !ok {
+					err = fmt.Errorf("%v", r)
+				}
+
+				ctx.Error(err)
+				abortWithAPIError(ctx, toAPIError(err))
+			}
+		}()
+
+		ctx.Next()
+
+		if last := ctx.Errors.Last(); last != nil && !ctx.Writer.Written() {
+			abortWithAPIError(ctx, toAPIError(last.Err))
+		}
+	}
+}
+
+func abortWithAPIError(ctx *gin.Context, e *APIError) {
+	ctx.AbortWithStatusJSON(e.Status(), gin.H{
+		"error": e,
+	})
+}
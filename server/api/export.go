@@ -0,0 +1,75 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhquiz/go-zhquiz/server/db"
+	"gorm.io/gorm"
+)
+
+func routerExport(apiRouter *gin.RouterGroup) {
+	apiRouter.GET("/export", wrap(func(ctx *gin.Context) error {
+		out, e := current(ctx).ExportDump()
+		if e != nil {
+			return e
+		}
+
+		ctx.Header("Content-Disposition", fmt.Sprintf(
+			`attachment; filename="zhquiz-%s.json"`,
+			out.CreatedAt.Format("20060102-150405"),
+		))
+		ctx.JSON(200, out)
+		return nil
+	}))
+
+	apiRouter.POST("/import", wrap(func(ctx *gin.Context) error {
+		var query importQuery
+
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
+		}
+
+		if query.Policy == "" {
+			query.Policy = string(db.ImportSkip)
+		}
+
+		var body db.Dump
+
+		if e := ctx.ShouldBindJSON(&body); e != nil {
+			return Validation(e)
+		}
+
+		if body.Version == 0 || body.Version > db.DumpVersion {
+			return Validation(fmt.Errorf("unsupported dump version: %d", body.Version))
+		}
+
+		if _, e := resource.DB.Backup("import"); e != nil {
+			return fmt.Errorf("cannot back up before import: %w", e)
+		}
+
+		start := time.Now()
+		var out *db.ImportResult
+
+		e := resource.DB.Current().Transaction(func(tx *gorm.DB) error {
+			r, e := db.Import(tx, userID(ctx), body, db.ImportPolicy(query.Policy))
+			out = r
+			return e
+		})
+
+		if e != nil {
+			return e
+		}
+
+		ctx.JSON(201, gin.H{
+			"result":   out,
+			"duration": time.Since(start).String(),
+		})
+		return nil
+	}))
+}
+
+type importQuery struct {
+	Policy string `form:"policy" binding:"omitempty,oneof=skip overwrite newer"`
+}
@@ -24,18 +24,11 @@ func routerExtra(apiRouter *gin.RouterGroup) {
 		"tag":         "extra_q.tag tag",
 	}
 
-	r.GET("/q", func(ctx *gin.Context) {
-		var query struct {
-			Q       string  `form:"q"`
-			Select  string  `form:"select"`
-			Sort    string  `form:"sort"`
-			Page    *string `form:"page"`
-			PerPage *string `form:"perPage"`
-		}
+	r.GET("/q", wrap(func(ctx *gin.Context) error {
+		var query extraListQuery
 
-		if e := ctx.BindQuery(&query); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
 		if query.Sort == "" {
@@ -62,8 +55,7 @@ func routerExtra(apiRouter *gin.RouterGroup) {
 		{
 			a, e := strconv.Atoi(*query.Page)
 			if e != nil {
-				ctx.AbortWithError(400, e)
-				return
+				return Validation(e)
 			}
 			page = a
 		}
@@ -72,8 +64,7 @@ func routerExtra(apiRouter *gin.RouterGroup) {
 		{
 			a, e := strconv.Atoi(*query.PerPage)
 			if e != nil {
-				ctx.AbortWithError(400, e)
-				return
+				return Validation(e)
 			}
 			perPage = a
 		}
@@ -88,16 +79,17 @@ func routerExtra(apiRouter *gin.RouterGroup) {
 		}
 
 		if len(sel) == 0 {
-			ctx.AbortWithError(400, fmt.Errorf("not enough select"))
-			return
+			return Validation(fmt.Errorf("not enough select"))
 		}
 
-		q := resource.DB.Current.Model(&db.Extra{}).Joins("LEFT JOIN extra_q ON extra_q.id = extra.id")
+		q := resource.DB.Current().Model(&db.Extra{}).
+			Joins("LEFT JOIN extra_q ON extra_q.id = extra.id").
+			Where("extra.user_id = ?", userID(ctx))
 
 		if query.Q != "" {
 			q = q.Where(`extra.id IN (
 				SELECT id FROM extra_q WHERE extra_q MATCH ?
-			)`, query.Q)
+			)`, matchPinyin(query.Q, "pinyin", false))
 		}
 
 		q = q.Group("extra.id")
@@ -105,13 +97,10 @@ func routerExtra(apiRouter *gin.RouterGroup) {
 		var count int64
 
 		if r := q.Count(&count); r.Error != nil {
-			panic(r.Error)
+			return r.Error
 		}
 
-		out := struct {
-			Result []map[string]interface{} `json:"result"`
-			Count  int64                    `json:"count"`
-		}{
+		out := extraListResult{
 			Result: make([]map[string]interface{}, 0),
 			Count:  count,
 		}
@@ -122,21 +111,18 @@ func routerExtra(apiRouter *gin.RouterGroup) {
 			Limit(perPage).
 			Offset((page - 1) * perPage).
 			Find(&out.Result); r.Error != nil {
-			panic(r.Error)
+			return r.Error
 		}
 
 		ctx.JSON(200, out)
-	})
+		return nil
+	}))
 
-	r.GET("/", func(ctx *gin.Context) {
-		var query struct {
-			Entry  string `form:"entry" binding:"required"`
-			Select string `form:"select"`
-		}
+	r.GET("/", wrap(func(ctx *gin.Context) error {
+		var query extraGetQuery
 
-		if e := ctx.BindQuery(&query); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
 		sel := []string{}
@@ -149,42 +135,33 @@ func routerExtra(apiRouter *gin.RouterGroup) {
 		}
 
 		if len(sel) == 0 {
-			ctx.AbortWithError(400, fmt.Errorf("not enough select"))
-			return
+			return Validation(fmt.Errorf("not enough select"))
 		}
 
 		out := map[string]interface{}{}
 
-		if r := resource.DB.Current.
+		if r := resource.DB.Current().
 			Model(&db.Extra{}).
 			Joins("LEFT JOIN extra_q ON extra_q.id = extra.id").
 			Select(strings.Join(sel, ",")).
-			Where("extra.chinese = ?", query.Entry).
+			Where("extra.user_id = ? AND extra.chinese = ?", userID(ctx), query.Entry).
 			Group("extra.id").
 			First(&out); r.Error != nil {
-			panic(r.Error)
+			return r.Error
 		}
 
 		ctx.JSON(200, out)
-	})
-
-	r.PUT("/", func(ctx *gin.Context) {
-		var body struct {
-			Chinese     string `json:"chinese" binding:"required"`
-			Pinyin      string `json:"pinyin" binding:"required"`
-			English     string `json:"english" binding:"required"`
-			Type        string `json:"type"`
-			Description string `json:"description"`
-			Tag         string `json:"tag"`
-			Forced      bool   `json:"forced"`
-		}
+		return nil
+	}))
 
-		if e := ctx.BindJSON(&body); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+	r.PUT("/", wrap(func(ctx *gin.Context) error {
+		var body extraCreateBody
+
+		if e := ctx.ShouldBindJSON(&body); e != nil {
+			return Validation(e)
 		}
 
-		checkVocab := func() bool {
+		checkVocab := func() (bool, error) {
 			var simplified string
 
 			if r := resource.Zh.Current.Raw(`
@@ -194,9 +171,9 @@ func routerExtra(apiRouter *gin.RouterGroup) {
 			LIMIT 1
 			`, body.Chinese, body.Chinese).First(&simplified); r.Error != nil {
 				if errors.Is(r.Error, gorm.ErrRecordNotFound) {
-					return false
+					return false, nil
 				}
-				panic(r.Error)
+				return false, r.Error
 			}
 
 			ctx.JSON(200, gin.H{
@@ -206,10 +183,10 @@ func routerExtra(apiRouter *gin.RouterGroup) {
 				},
 			})
 
-			return true
+			return true, nil
 		}
 
-		checkHanzi := func() bool {
+		checkHanzi := func() (bool, error) {
 			var entry string
 			if r := resource.Zh.Current.Raw(`
 			SELECT [entry]
@@ -218,10 +195,10 @@ func routerExtra(apiRouter *gin.RouterGroup) {
 			LIMIT 1
 			`, body.Chinese).First(&entry); r.Error != nil {
 				if errors.Is(r.Error, gorm.ErrRecordNotFound) {
-					return false
+					return false, nil
 				}
 
-				panic(r.Error)
+				return false, r.Error
 			}
 
 			ctx.JSON(200, gin.H{
@@ -231,10 +208,10 @@ func routerExtra(apiRouter *gin.RouterGroup) {
 				},
 			})
 
-			return true
+			return true, nil
 		}
 
-		checkSentence := func() bool {
+		checkSentence := func() (bool, error) {
 			var chinese string
 			if r := resource.Zh.Current.Raw(`
 			SELECT chinese
@@ -243,10 +220,10 @@ func routerExtra(apiRouter *gin.RouterGroup) {
 			LIMIT 1
 			`, body.Chinese).First(&chinese); r.Error != nil {
 				if errors.Is(r.Error, gorm.ErrRecordNotFound) {
-					return false
+					return false, nil
 				}
 
-				panic(r.Error)
+				return false, r.Error
 			}
 
 			ctx.JSON(200, gin.H{
@@ -256,26 +233,29 @@ func routerExtra(apiRouter *gin.RouterGroup) {
 				},
 			})
 
-			return true
+			return true, nil
 		}
 
 		if !body.Forced {
-			if checkVocab() {
-				return
+			check := checkSentence
+			if len([]rune(body.Chinese)) == 1 {
+				check = checkHanzi
 			}
 
-			if len([]rune(body.Chinese)) == 1 {
-				if checkHanzi() {
-					return
+			for _, fn := range []func() (bool, error){checkVocab, check} {
+				existing, e := fn()
+				if e != nil {
+					return e
 				}
-			} else {
-				if checkSentence() {
-					return
+
+				if existing {
+					return nil
 				}
 			}
 		}
 
 		it := db.Extra{
+			UserID:      userID(ctx),
 			Chinese:     body.Chinese,
 			Pinyin:      body.Pinyin,
 			English:     body.English,
@@ -284,46 +264,38 @@ func routerExtra(apiRouter *gin.RouterGroup) {
 			Tag:         body.Tag,
 		}
 
-		e := resource.DB.Current.Transaction(func(tx *gorm.DB) error {
-			if r := tx.Create(&it); r.Error != nil {
-				return r.Error
-			}
-
-			return nil
+		e := resource.DB.Current().Transaction(func(tx *gorm.DB) error {
+			return it.Create(tx)
 		})
 
 		if e != nil {
-			panic(e)
+			return e
 		}
 
 		ctx.JSON(201, gin.H{
 			"id": it.ID,
 		})
-	})
+		return nil
+	}))
 
-	r.PATCH("/", func(ctx *gin.Context) {
-		id := ctx.Query("id")
-		if id == "" {
-			ctx.AbortWithError(400, fmt.Errorf("id to update not specified"))
-			return
-		}
+	r.PATCH("/", wrap(func(ctx *gin.Context) error {
+		var query idQuery
 
-		var body struct {
-			Chinese     string `json:"chinese" binding:"required"`
-			Pinyin      string `json:"pinyin" binding:"required"`
-			English     string `json:"english" binding:"required"`
-			Type        string `json:"type"`
-			Description string `json:"description"`
-			Tag         string `json:"tag"`
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
-		if e := ctx.BindJSON(&body); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		id := query.ID
+
+		var body extraUpdateBody
+
+		if e := ctx.ShouldBindJSON(&body); e != nil {
+			return Validation(e)
 		}
 
 		u := db.Extra{
 			ID:          id,
+			UserID:      userID(ctx),
 			Chinese:     body.Chinese,
 			Pinyin:      body.Pinyin,
 			English:     body.English,
@@ -340,7 +312,11 @@ func routerExtra(apiRouter *gin.RouterGroup) {
 			u.Tag = " "
 		}
 
-		e := resource.DB.Current.Transaction(func(tx *gorm.DB) error {
+		e := resource.DB.Current().Transaction(func(tx *gorm.DB) error {
+			if r := tx.Scopes(db.OwnedBy(u.UserID)).Where("id = ?", id).First(&db.Extra{}); r.Error != nil {
+				return r.Error
+			}
+
 			if r := u.Update(tx); r != nil {
 				return r
 			}
@@ -349,25 +325,30 @@ func routerExtra(apiRouter *gin.RouterGroup) {
 		})
 
 		if e != nil {
-			panic(e)
+			return e
 		}
 
 		ctx.JSON(201, gin.H{
 			"result": "updated",
 		})
-	})
+		return nil
+	}))
 
-	r.DELETE("/", func(ctx *gin.Context) {
-		id := ctx.Query("id")
-		if id == "" {
-			ctx.AbortWithError(400, fmt.Errorf("id to update not specified"))
-			return
+	r.DELETE("/", wrap(func(ctx *gin.Context) error {
+		var query idQuery
+
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
-		e := resource.DB.Current.Transaction(func(tx *gorm.DB) error {
-			ex := db.Extra{
-				ID: id,
+		id := query.ID
+
+		e := resource.DB.Current().Transaction(func(tx *gorm.DB) error {
+			var ex db.Extra
+			if r := tx.Scopes(db.OwnedBy(userID(ctx))).Where("id = ?", id).First(&ex); r.Error != nil {
+				return r.Error
 			}
+
 			if e := ex.Delete(tx); e != nil {
 				return e
 			}
@@ -376,11 +357,49 @@ func routerExtra(apiRouter *gin.RouterGroup) {
 		})
 
 		if e != nil {
-			panic(e)
+			return e
 		}
 
 		ctx.JSON(201, gin.H{
 			"result": "deleted",
 		})
-	})
+		return nil
+	}))
+}
+
+type extraListResult struct {
+	Result []map[string]interface{} `json:"result"`
+	Count  int64                    `json:"count"`
+}
+
+type extraListQuery struct {
+	Q       string  `form:"q"`
+	Select  string  `form:"select"`
+	Sort    string  `form:"sort"`
+	Page    *string `form:"page"`
+	PerPage *string `form:"perPage"`
+}
+
+type extraGetQuery struct {
+	Entry  string `form:"entry" binding:"required"`
+	Select string `form:"select"`
+}
+
+type extraCreateBody struct {
+	Chinese     string `json:"chinese" binding:"required"`
+	Pinyin      string `json:"pinyin" binding:"required"`
+	English     string `json:"english" binding:"required"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Tag         string `json:"tag"`
+	Forced      bool   `json:"forced"`
+}
+
+type extraUpdateBody struct {
+	Chinese     string `json:"chinese" binding:"required"`
+	Pinyin      string `json:"pinyin" binding:"required"`
+	English     string `json:"english" binding:"required"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Tag         string `json:"tag"`
 }
@@ -14,23 +14,14 @@ import (
 func routerHanzi(apiRouter *gin.RouterGroup) {
 	r := apiRouter.Group("/hanzi")
 
-	r.GET("/", func(ctx *gin.Context) {
-		var query struct {
-			Entry string `form:"entry" binding:"required"`
-		}
+	r.GET("/", wrap(func(ctx *gin.Context) error {
+		var query romanizedEntryQuery
 
-		if e := ctx.BindQuery(&query); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
-		var out struct {
-			Sub      string `json:"sub"`
-			Sup      string `json:"sup"`
-			Variants string `json:"variants"`
-			Pinyin   string `json:"pinyin"`
-			English  string `json:"english"`
-		}
+		var out hanziResult
 
 		if r := resource.Zh.Current.Raw(`
 		SELECT
@@ -49,66 +40,67 @@ func routerHanzi(apiRouter *gin.RouterGroup) {
 		WHERE [entry] = ?
 		`, query.Entry).First(&out); r.Error != nil {
 			if errors.Is(r.Error, gorm.ErrRecordNotFound) {
-				ctx.AbortWithStatus(404)
-				return
+				return NotFound(errors.New("not found"))
 			}
 
-			panic(r.Error)
+			return r.Error
 		}
 
-		ctx.JSON(200, out)
-	})
+		out.Romanization = query.romanize(out.Pinyin)
 
-	r.GET("/q", func(ctx *gin.Context) {
-		var query struct {
-			Q string `form:"q" binding:"required"`
-		}
+		ctx.JSON(200, out)
+		return nil
+	}))
 
-		if e := ctx.BindQuery(&query); e != nil {
-			ctx.AbortWithError(400, e)
-			return
-		}
+	r.GET("/q", wrap(func(ctx *gin.Context) error {
+		var query searchQuery
 
-		type Result struct {
-			Entry string `json:"entry"`
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
-		result := make([]Result, 0)
+		result := make([]hanziSearchResult, 0)
 
 		if r := resource.Zh.Current.Raw(`
 		SELECT Entry FROM token
 		WHERE Entry IN (
-			SELECT Entry FROM token_q WHERE token_q MATCH @Q AND length(Entry) = 1
+			SELECT Entry FROM token_q WHERE token_q MATCH @q AND length(Entry) = 1
 		)
 		ORDER BY frequency DESC
-		`, query).Find(&result); r.Error != nil {
-			panic(r.Error)
+		`, map[string]interface{}{
+			"q": matchPinyin(query.Q, "pinyin", true),
+		}).Find(&result); r.Error != nil {
+			return r.Error
 		}
 
 		ctx.JSON(200, gin.H{
 			"result": result,
 		})
-	})
+		return nil
+	}))
 
-	r.GET("/random", func(ctx *gin.Context) {
-		var user db.User
-		if r := resource.DB.Current.First(&user); r.Error != nil {
-			panic(r.Error)
+	r.GET("/random", wrap(func(ctx *gin.Context) error {
+		user, e := current(ctx).User()
+		if e != nil {
+			return e
 		}
-		levelMin := *user.Meta.LevelMin
-		if levelMin == 0 {
-			levelMin = 1
+
+		// New profiles have no levels yet
+		var levelMin uint = 1
+		if user.Meta.LevelMin != nil && *user.Meta.LevelMin != 0 {
+			levelMin = *user.Meta.LevelMin
 		}
-		levelMax := *user.Meta.Level
-		if levelMax == 0 {
-			levelMax = 60
+		var levelMax uint = 60
+		if user.Meta.Level != nil && *user.Meta.Level != 0 {
+			levelMax = *user.Meta.Level
 		}
 
 		var existing []db.Quiz
-		if r := resource.DB.Current.
+		if r := resource.DB.Current().
+			Scopes(db.OwnedBy(user.ID)).
 			Where("[type] = 'hanzi' AND srs_level IS NOT NULL AND next_review IS NOT NULL").
 			Find(&existing); r.Error != nil {
-			panic(r.Error)
+			return r.Error
 		}
 
 		var entries []interface{}
@@ -127,19 +119,14 @@ func routerHanzi(apiRouter *gin.RouterGroup) {
 			where = "entry NOT IN @entries AND " + where
 		}
 
-		type Item struct {
-			Result  string `json:"result"`
-			English string `json:"english"`
-			Level   int    `json:"level"`
-		}
-		var items []Item
+		var items []randomResult
 
 		if r := resource.Zh.Current.Raw(fmt.Sprintf(`
 		SELECT entry Result, English, hanzi_level Level
 		FROM token
 		WHERE %s
 		`, where), params).Find(&items); r.Error != nil {
-			panic(r.Error)
+			return r.Error
 		}
 
 		if len(items) < 1 {
@@ -153,16 +140,37 @@ func routerHanzi(apiRouter *gin.RouterGroup) {
 			FROM token
 			WHERE %s
 			`, where), params).Find(&items); r.Error != nil {
-				panic(r.Error)
+				return r.Error
 			}
 		}
 
 		if len(items) < 1 {
-			ctx.AbortWithError(404, fmt.Errorf("no matching entries found"))
-			return
+			return NotFound(fmt.Errorf("no matching entries found"))
 		}
 
 		rand.Seed(time.Now().UnixNano())
 		ctx.JSON(200, items[rand.Intn(len(items))])
-	})
+		return nil
+	}))
+}
+
+type hanziResult struct {
+	Sub      string `json:"sub"`
+	Sup      string `json:"sup"`
+	Variants string `json:"variants"`
+	Pinyin   string `json:"pinyin"`
+	English  string `json:"english"`
+	// Romanization is Pinyin, converted as requested by ?romanization=
+	Romanization string `json:"romanization,omitempty"`
+}
+
+type hanziSearchResult struct {
+	Entry string `json:"entry"`
+}
+
+// randomResult is a random hanzi or vocab, within the user's level
+type randomResult struct {
+	Result  string `json:"result"`
+	English string `json:"english"`
+	Level   int    `json:"level"`
 }
@@ -1,10 +1,15 @@
 package api
 
 import (
+	"crypto/subtle"
+	"fmt"
 	"io"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 	"github.com/wangbin/jiebago"
@@ -20,17 +25,53 @@ var jieba jiebago.Segmenter
 type Resource struct {
 	DB db.DB
 	Zh zh.DB
+
+	// UserID is the profile acted on by methods of Resource, defaulting to db.DefaultUserID
+	UserID string
 }
 
 // Options is server options
 type Options struct {
+	// Token is the CSRF token, required on every mutating API request.
+	// If empty, every mutating API request is rejected.
 	Token string
+	// SkipCSRF disables the check of Origin and Token, so that the UI development server can call the API.
+	// It is only set in debug mode, if opted in, see shared.SkipCSRF.
+	SkipCSRF bool
 }
 
-// Cleanup cleans up Resource.
+// background tracks goroutines that outlive their requests, to be drained by Cleanup
+var background sync.WaitGroup
+
+// goBackground runs fn without blocking the request, but before Cleanup.
+// Panics are logged, rather than crashing the app.
+func goBackground(fn func()) {
+	background.Add(1)
+
+	go func() {
+		defer background.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("background task failed: %v\n", r)
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// Cleanup cleans up Resource, after the server is shut down.
 func (res Resource) Cleanup() {
 	log.Println("Cleaning up")
-	res.DB.Current.Commit()
+	background.Wait()
+
+	if e := res.DB.Close(); e != nil {
+		log.Println(e)
+	}
+
+	if e := res.Zh.Close(); e != nil {
+		log.Println(e)
+	}
 }
 
 // Prepare initializes Resource for reuse and cleanup.
@@ -56,23 +97,38 @@ func (res Resource) Register(r *gin.Engine, opts *Options) {
 		})
 	})
 
-	apiRouter := r.Group("/api")
+	apiRouter := r.Group("/api", renderError(), csrfProtect(opts), profile())
 
-	apiRouter.POST("/openURL", func(c *gin.Context) {
-		url, _ := c.GetQuery("url")
-		if url == "" {
-			c.AbortWithStatus(400)
-			return
+	apiRouter.POST("/openURL", wrap(func(ctx *gin.Context) error {
+		var query openURLQuery
+
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
+		}
+
+		raw := query.URL
+
+		u, e := shared.ParseOpenURL(raw)
+		if e != nil {
+			log.Printf("rejected openURL %q: %v\n", raw, e)
+			return Validation(e)
 		}
 
-		shared.OpenURL(url)
+		if e := shared.OpenURL(u.String()); e != nil {
+			return e
+		}
 
-		c.JSON(201, gin.H{
+		ctx.JSON(201, gin.H{
 			"result": "opened",
 		})
-	})
+		return nil
+	}))
 
 	routerChinese(apiRouter)
+	routerAdmin(apiRouter)
+	routerAnki(apiRouter)
+	routerBackup(apiRouter)
+	routerExport(apiRouter)
 	routerExtra(apiRouter)
 	routerHanzi(apiRouter)
 	routerLibrary(apiRouter)
@@ -80,4 +136,103 @@ func (res Resource) Register(r *gin.Engine, opts *Options) {
 	routerSentence(apiRouter)
 	routerUser(apiRouter)
 	routerVocab(apiRouter)
+	routerOpenAPI(apiRouter)
+	routerProfile(apiRouter)
+
+	// Every API route must be documented in endpoints, so that scripts and the UI can be checked against it
+	if problems := undocumented(r.Routes()); len(problems) > 0 {
+		msg := "OpenAPI document is out of date:\n  " + strings.Join(problems, "\n  ")
+		if shared.IsDebug() {
+			panic(msg)
+		}
+		log.Println(msg)
+	}
+}
+
+// CSRFHeader is the request header carrying Options.Token.
+// The UI reads it from `csrf_token` cookie.
+const CSRFHeader = "CSRF-Token"
+
+// csrfProtect rejects POST, PUT, PATCH and DELETE from other origins,
+// or without the matching CSRF token, unless Options.SkipCSRF.
+func csrfProtect(opts *Options) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		switch ctx.Request.Method {
+		case "GET", "HEAD", "OPTIONS":
+			ctx.Next()
+			return
+		}
+
+		if opts.SkipCSRF {
+			ctx.Next()
+			return
+		}
+
+		if origin := ctx.GetHeader("Origin"); origin != "" {
+			u, e := url.Parse(origin)
+			if e != nil || u.Host != ctx.Request.Host {
+				abortWithAPIError(ctx, Forbidden(fmt.Errorf("cross-origin request from %s", origin)))
+				return
+			}
+		}
+
+		token := ctx.GetHeader(CSRFHeader)
+		if token == "" {
+			token = ctx.GetHeader("X-" + CSRFHeader)
+		}
+
+		if opts.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(opts.Token)) != 1 {
+			abortWithAPIError(ctx, Forbidden(fmt.Errorf("invalid CSRF token")))
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// AuthRequired requires password of every request, either as HTTP Basic auth with any username,
+// which browsers prompt for and remember, or as Bearer token, for scripts.
+func AuthRequired(password string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		given := ""
+		if _, p, ok := ctx.Request.BasicAuth(); ok {
+			given = p
+		} else if s := ctx.GetHeader("Authorization"); strings.HasPrefix(s, "Bearer ") {
+			given = strings.TrimPrefix(s, "Bearer ")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(given), []byte(password)) == 1 {
+			ctx.Next()
+			return
+		}
+
+		ctx.Header("WWW-Authenticate", `Basic realm="ZhQuiz", charset="UTF-8"`)
+		abortWithAPIError(ctx, Unauthorized(fmt.Errorf("password required")))
+	}
+}
+
+type openURLQuery struct {
+	URL string `form:"url" binding:"required"`
+}
+
+type idQuery struct {
+	ID string `form:"id" binding:"required"`
+}
+
+type entryQuery struct {
+	Entry string `form:"entry" binding:"required"`
+}
+
+type searchQuery struct {
+	Q string `form:"q" binding:"required"`
+}
+
+type romanizedEntryQuery struct {
+	entryQuery
+	romanizationQuery
+}
+
+type romanizedSearchQuery struct {
+	searchQuery
+	romanizationQuery
 }
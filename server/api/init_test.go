@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCSRFProtect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newApp := func(token string, skip bool) *gin.Engine {
+		r := gin.New()
+		r.Use(csrfProtect(&Options{Token: token, SkipCSRF: skip}))
+		r.GET("/api/x", func(ctx *gin.Context) { ctx.Status(200) })
+		r.POST("/api/x", func(ctx *gin.Context) { ctx.Status(201) })
+		return r
+	}
+
+	for _, c := range []struct {
+		name   string
+		token  string
+		method string
+		header map[string]string
+		status int
+		// skip is Options.SkipCSRF
+		skip bool
+	}{
+		{"same origin", "secret", "POST", map[string]string{"Origin": "http://example.com", CSRFHeader: "secret"}, 201, false},
+		{"no origin", "secret", "POST", map[string]string{CSRFHeader: "secret"}, 201, false},
+		{"x- header", "secret", "POST", map[string]string{"X-" + CSRFHeader: "secret"}, 201, false},
+		{"other origin", "secret", "POST", map[string]string{"Origin": "http://evil.com", CSRFHeader: "secret"}, 403, false},
+		{"other port", "secret", "POST", map[string]string{"Origin": "http://example.com:8080", CSRFHeader: "secret"}, 403, false},
+		{"missing token", "secret", "POST", map[string]string{"Origin": "http://example.com"}, 403, false},
+		{"wrong token", "secret", "POST", map[string]string{"Origin": "http://example.com", CSRFHeader: "wrong"}, 403, false},
+		{"no server token", "", "POST", map[string]string{CSRFHeader: ""}, 403, false},
+		{"get", "secret", "GET", map[string]string{"Origin": "http://evil.com"}, 200, false},
+		// Opted in, in debug mode
+		{"skipped, other origin", "secret", "POST", map[string]string{"Origin": "http://localhost:8080"}, 201, true},
+		{"skipped, no server token", "", "POST", map[string]string{}, 201, true},
+	} {
+		req := httptest.NewRequest(c.method, "http://example.com/api/x", nil)
+		for k, v := range c.header {
+			req.Header.Set(k, v)
+		}
+
+		w := httptest.NewRecorder()
+		newApp(c.token, c.skip).ServeHTTP(w, req)
+
+		if w.Code != c.status {
+			t.Errorf("%s: status %d, not %d", c.name, w.Code, c.status)
+		}
+	}
+}
@@ -13,36 +13,24 @@ import (
 func routerLibrary(apiRouter *gin.RouterGroup) {
 	r := apiRouter.Group("/library")
 
-	r.GET("/q", func(ctx *gin.Context) {
-		var query struct {
-			Q       string `form:"q"`
-			Page    string `form:"page" binding:"required"`
-			PerPage string `form:"perPage" binding:"required"`
-		}
+	r.GET("/q", wrap(func(ctx *gin.Context) error {
+		var query libraryListQuery
 
-		if e := ctx.BindQuery(&query); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
 		page, err := strconv.Atoi(query.Page)
 		if err != nil {
-			ctx.AbortWithError(400, err)
-			return
+			return Validation(err)
 		}
 
 		perPage, err := strconv.Atoi(query.PerPage)
 		if err != nil {
-			ctx.AbortWithError(400, err)
-			return
+			return Validation(err)
 		}
 
-		type Result struct {
-			ID      string   `json:"id"`
-			Title   string   `json:"title"`
-			Entries []string `json:"entries"`
-		}
-		result := make([]Result, 0)
+		result := make([]libraryResult, 0)
 
 		type lib struct {
 			ID    string
@@ -52,34 +40,42 @@ func routerLibrary(apiRouter *gin.RouterGroup) {
 		var preresult []lib
 		count := 0
 
+		// Built-in libraries, from zh.db, have IDs starting with space, and are shared by all profiles
+		owned := "(library_q.id LIKE ' %' OR library_q.id IN (SELECT id FROM library WHERE user_id = @userID))"
+		cond := map[string]interface{}{
+			"userID": userID(ctx),
+			"q":      query.Q,
+		}
+
 		if query.Q != "" {
-			if r := resource.DB.Current.Raw(fmt.Sprintf(`
-			SELECT ID, Title, Entry FROM library_q WHERE library_q MATCH ?
+			if r := resource.DB.Current().Raw(fmt.Sprintf(`
+			SELECT ID, Title, Entry FROM library_q WHERE library_q MATCH @q AND %s
 			ORDER BY rank
 			LIMIT %d OFFSET %d
-			`, perPage, (page-1)*perPage), query.Q).Find(&preresult); r.Error != nil {
-				panic(r.Error)
+			`, owned, perPage, (page-1)*perPage), cond).Find(&preresult); r.Error != nil {
+				return r.Error
 			}
 
-			if err := resource.DB.Current.Raw(`
-			SELECT COUNT(*) FROM library_q WHERE library_q MATCH ?
-			`, query.Q).Row().Scan(&count); err != nil {
-				panic(err)
+			if err := resource.DB.Current().Raw(fmt.Sprintf(`
+			SELECT COUNT(*) FROM library_q WHERE library_q MATCH @q AND %s
+			`, owned), cond).Row().Scan(&count); err != nil {
+				return err
 			}
 		} else {
-			if r := resource.DB.Current.Raw(fmt.Sprintf(`
+			if r := resource.DB.Current().Raw(fmt.Sprintf(`
 			SELECT library.id ID, library.Title Title, Entry FROM library_q
 			LEFT JOIN library ON library.id = library_q.id
+			WHERE %s
 			ORDER BY updated_at DESC
 			LIMIT %d OFFSET %d
-			`, perPage, (page-1)*perPage)).Find(&preresult); r.Error != nil {
-				panic(r.Error)
+			`, owned, perPage, (page-1)*perPage), cond).Find(&preresult); r.Error != nil {
+				return r.Error
 			}
 
-			if err := resource.DB.Current.Raw(`
-			SELECT COUNT(*) FROM library_q
-			`).Row().Scan(&count); err != nil {
-				panic(err)
+			if err := resource.DB.Current().Raw(fmt.Sprintf(`
+			SELECT COUNT(*) FROM library_q WHERE %s
+			`, owned), cond).Row().Scan(&count); err != nil {
+				return err
 			}
 		}
 
@@ -90,7 +86,7 @@ func routerLibrary(apiRouter *gin.RouterGroup) {
 				p.ID = ""
 			}
 
-			result = append(result, Result{
+			result = append(result, libraryResult{
 				ID:      p.ID,
 				Title:   p.Title,
 				Entries: entries,
@@ -101,29 +97,25 @@ func routerLibrary(apiRouter *gin.RouterGroup) {
 			"result": result,
 			"count":  count,
 		})
-	})
+		return nil
+	}))
 
-	r.PUT("/", func(ctx *gin.Context) {
-		var body struct {
-			Title       string   `json:"title" binding:"required"`
-			Entries     []string `json:"entries" binding:"required,min=1"`
-			Description string   `json:"description"`
-			Tag         string   `json:"tag"`
-		}
+	r.PUT("/", wrap(func(ctx *gin.Context) error {
+		var body libraryBody
 
-		if e := ctx.BindJSON(&body); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		if e := ctx.ShouldBindJSON(&body); e != nil {
+			return Validation(e)
 		}
 
 		it := db.Library{
+			UserID:      userID(ctx),
 			Title:       body.Title,
 			Entries:     body.Entries,
 			Description: body.Description,
 			Tag:         body.Tag,
 		}
 
-		e := resource.DB.Current.Transaction(func(tx *gorm.DB) error {
+		e := resource.DB.Current().Transaction(func(tx *gorm.DB) error {
 			if e := it.Create(tx); e != nil {
 				return e
 			}
@@ -132,42 +124,44 @@ func routerLibrary(apiRouter *gin.RouterGroup) {
 		})
 
 		if e != nil {
-			panic(e)
+			return e
 		}
 
 		ctx.JSON(201, gin.H{
 			"id": it.ID,
 		})
-	})
+		return nil
+	}))
 
-	r.PATCH("/", func(ctx *gin.Context) {
-		id := ctx.Query("id")
-		if id == "" {
-			ctx.AbortWithError(400, fmt.Errorf("id to update not specified"))
-			return
-		}
+	r.PATCH("/", wrap(func(ctx *gin.Context) error {
+		var query idQuery
 
-		var body struct {
-			Title       string   `json:"title" binding:"required"`
-			Entries     []string `json:"entries" binding:"required,min=1"`
-			Description string   `json:"description"`
-			Tag         string   `json:"tag"`
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
-		if e := ctx.BindJSON(&body); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		id := query.ID
+
+		var body libraryBody
+
+		if e := ctx.ShouldBindJSON(&body); e != nil {
+			return Validation(e)
 		}
 
 		u := db.Library{
 			ID:          id,
+			UserID:      userID(ctx),
 			Title:       body.Title,
 			Entries:     body.Entries,
 			Description: body.Description,
 			Tag:         body.Tag,
 		}
 
-		e := resource.DB.Current.Transaction(func(tx *gorm.DB) error {
+		e := resource.DB.Current().Transaction(func(tx *gorm.DB) error {
+			if r := tx.Scopes(db.OwnedBy(u.UserID)).Where("id = ?", id).First(&db.Library{}); r.Error != nil {
+				return r.Error
+			}
+
 			if e := u.Update(tx); e != nil {
 				return e
 			}
@@ -176,24 +170,28 @@ func routerLibrary(apiRouter *gin.RouterGroup) {
 		})
 
 		if e != nil {
-			panic(e)
+			return e
 		}
 
 		ctx.JSON(201, gin.H{
 			"result": "updated",
 		})
-	})
+		return nil
+	}))
+
+	r.DELETE("/", wrap(func(ctx *gin.Context) error {
+		var query idQuery
 
-	r.DELETE("/", func(ctx *gin.Context) {
-		id := ctx.Query("id")
-		if id == "" {
-			ctx.AbortWithError(400, fmt.Errorf("id to update not specified"))
-			return
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
-		e := resource.DB.Current.Transaction(func(tx *gorm.DB) error {
-			lib := db.Library{
-				ID: id,
+		id := query.ID
+
+		e := resource.DB.Current().Transaction(func(tx *gorm.DB) error {
+			var lib db.Library
+			if r := tx.Scopes(db.OwnedBy(userID(ctx))).Where("id = ?", id).First(&lib); r.Error != nil {
+				return r.Error
 			}
 
 			if e := lib.Delete(tx); e != nil {
@@ -204,11 +202,31 @@ func routerLibrary(apiRouter *gin.RouterGroup) {
 		})
 
 		if e != nil {
-			panic(e)
+			return e
 		}
 
 		ctx.JSON(201, gin.H{
 			"result": "deleted",
 		})
-	})
+		return nil
+	}))
+}
+
+type libraryResult struct {
+	ID      string   `json:"id"`
+	Title   string   `json:"title"`
+	Entries []string `json:"entries"`
+}
+
+type libraryListQuery struct {
+	Q       string `form:"q"`
+	Page    string `form:"page" binding:"required"`
+	PerPage string `form:"perPage" binding:"required"`
+}
+
+type libraryBody struct {
+	Title       string   `json:"title" binding:"required"`
+	Entries     []string `json:"entries" binding:"required,min=1"`
+	Description string   `json:"description"`
+	Tag         string   `json:"tag"`
 }
@@ -0,0 +1,782 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhquiz/go-zhquiz/server/db"
+)
+
+// endpoint documents a route of apiRouter, in the OpenAPI document.
+// Query, Body and Form are the types bound by the handler.
+// Response is a sample value, where gin.H is documented key by key.
+type endpoint struct {
+	Summary string
+
+	Query interface{}
+	Body  interface{}
+	// Form is multipart/form-data, for file uploads
+	Form interface{}
+
+	// Status defaults to 200
+	Status   int
+	Response interface{}
+	// ContentType is of non-JSON responses, i.e. audio and downloads
+	ContentType string
+}
+
+// endpoints is keyed by `METHOD /full/path`, as in gin.RouteInfo.
+// Every route under /api must have an entry; see undocumented.
+var endpoints = map[string]endpoint{
+	"POST /api/openURL": {
+		Summary:  "Open a URL in the default browser",
+		Query:    openURLQuery{},
+		Status:   201,
+		Response: gin.H{"result": ""},
+	},
+	"GET /api/openapi.json": {
+		Summary:  "This document",
+		Response: map[string]interface{}{},
+	},
+
+	"GET /api/admin/fsck": {
+		Summary:  "Check FTS tables against their main tables, for all profiles",
+		Response: gin.H{"result": db.VerifyResult{}},
+	},
+	"POST /api/admin/fsck": {
+		Summary:  "Check FTS tables, and rebuild them if there are issues, after backing up",
+		Status:   201,
+		Response: gin.H{"result": db.VerifyResult{}, "repaired": false, "after": db.VerifyResult{}},
+	},
+
+	"POST /api/anki/fields": {
+		Summary:  "List note types of an .apkg, with counts and sample fields",
+		Form:     ankiFileForm{},
+		Response: gin.H{"result": []ankiModelResult{}},
+	},
+	"POST /api/anki/import": {
+		Summary:  "Import notes of an .apkg as quizzes",
+		Form:     ankiImportForm{},
+		Status:   201,
+		Response: gin.H{"ids": []string{}, "skipped": 0},
+	},
+
+	"GET /api/backup/": {
+		Summary:  "List backups of data.db, latest first",
+		Response: gin.H{"result": []db.BackupInfo{}},
+	},
+	"POST /api/backup/": {
+		Summary:  "Back up data.db now",
+		Status:   201,
+		Response: gin.H{"result": db.BackupInfo{}},
+	},
+	"POST /api/backup/restore": {
+		Summary:  "Replace data.db with a backup, after backing up the current data",
+		Query:    backupRestoreQuery{},
+		Status:   201,
+		Response: gin.H{"result": "", "backup": db.BackupInfo{}},
+	},
+
+	"GET /api/chinese/jieba": {
+		Summary:  "Segment Chinese text",
+		Query:    searchQuery{},
+		Response: gin.H{"result": []string{}},
+	},
+	"GET /api/chinese/speak": {
+		Summary:     "Speak Chinese text, with the user's TTS settings",
+		Query:       searchQuery{},
+		ContentType: "audio/*",
+	},
+
+	"GET /api/export": {
+		Summary:  "Export user data",
+		Response: db.Dump{},
+	},
+	"POST /api/import": {
+		Summary:  "Import user data, exported by GET /api/export",
+		Query:    importQuery{},
+		Body:     db.Dump{},
+		Status:   201,
+		Response: gin.H{"result": db.ImportResult{}, "duration": ""},
+	},
+
+	"GET /api/extra/q": {
+		Summary:  "Search user-defined items",
+		Query:    extraListQuery{},
+		Response: extraListResult{},
+	},
+	"GET /api/extra/": {
+		Summary:  "Get a user-defined item, with selected fields",
+		Query:    extraGetQuery{},
+		Response: map[string]interface{}{},
+	},
+	"PUT /api/extra/": {
+		Summary:  "Create a user-defined item, unless already in the dictionaries",
+		Body:     extraCreateBody{},
+		Status:   201,
+		Response: gin.H{"id": ""},
+	},
+	"PATCH /api/extra/": {
+		Summary:  "Update a user-defined item",
+		Query:    idQuery{},
+		Body:     extraUpdateBody{},
+		Status:   201,
+		Response: gin.H{"result": ""},
+	},
+	"DELETE /api/extra/": {
+		Summary:  "Delete a user-defined item, and its quizzes",
+		Query:    idQuery{},
+		Status:   201,
+		Response: gin.H{"result": ""},
+	},
+
+	"GET /api/hanzi/": {
+		Summary:  "Get a Hanzi",
+		Query:    romanizedEntryQuery{},
+		Response: hanziResult{},
+	},
+	"GET /api/hanzi/q": {
+		Summary:  "Search Hanzi",
+		Query:    searchQuery{},
+		Response: gin.H{"result": []hanziSearchResult{}},
+	},
+	"GET /api/hanzi/random": {
+		Summary:  "Get a random Hanzi, within the user's level",
+		Response: randomResult{},
+	},
+
+	"GET /api/library/q": {
+		Summary:  "Search libraries",
+		Query:    libraryListQuery{},
+		Response: gin.H{"result": []libraryResult{}, "count": 0},
+	},
+	"PUT /api/library/": {
+		Summary:  "Create a library",
+		Body:     libraryBody{},
+		Status:   201,
+		Response: gin.H{"id": ""},
+	},
+	"PATCH /api/library/": {
+		Summary:  "Update a library",
+		Query:    idQuery{},
+		Body:     libraryBody{},
+		Status:   201,
+		Response: gin.H{"result": ""},
+	},
+	"DELETE /api/library/": {
+		Summary:  "Delete a library",
+		Query:    idQuery{},
+		Status:   201,
+		Response: gin.H{"result": ""},
+	},
+
+	"GET /api/profile/": {
+		Summary:  "List profiles, and the current one",
+		Response: gin.H{"result": []profileResult{}, "current": ""},
+	},
+	"POST /api/profile/": {
+		Summary:  "Create a profile",
+		Body:     profileBody{},
+		Status:   201,
+		Response: gin.H{"id": ""},
+	},
+	"PATCH /api/profile/": {
+		Summary:  "Rename a profile",
+		Query:    idQuery{},
+		Body:     profileBody{},
+		Status:   201,
+		Response: gin.H{"result": ""},
+	},
+	"DELETE /api/profile/": {
+		Summary:  "Delete a profile, other than the default one, with its quizzes, extra vocabularies and libraries, after backing up",
+		Query:    idQuery{},
+		Status:   201,
+		Response: gin.H{"result": ""},
+	},
+	"POST /api/profile/switch": {
+		Summary:  "Switch the current profile, by setting `profile` cookie",
+		Query:    idQuery{},
+		Status:   201,
+		Response: gin.H{"result": ""},
+	},
+
+	"GET /api/quiz/many": {
+		Summary:  "Get quizzes, with selected fields",
+		Query:    quizManyQuery{},
+		Response: gin.H{"result": []map[string]interface{}{}},
+	},
+	"POST /api/quiz/many": {
+		Summary:  "Get quizzes, with selected fields",
+		Body:     getterBody{},
+		Response: gin.H{"result": []map[string]interface{}{}},
+	},
+	"POST /api/quiz/srsLevel": {
+		Summary: "Get SRS levels of entries",
+		Body:    quizSrsLevelBody{},
+		Response: gin.H{"result": []gin.H{{
+			"entry":    "",
+			"srsLevel": (*int8)(nil),
+		}}},
+	},
+	"GET /api/quiz/leech": {
+		Summary:  "List quizzes that are often wrong",
+		Query:    quizLeechQuery{},
+		Response: gin.H{"result": []db.Quiz{}, "count": int64(0)},
+	},
+	"PATCH /api/quiz/mark": {
+		Summary:  "Mark a quiz, and reschedule it",
+		Query:    quizMarkQuery{},
+		Status:   201,
+		Response: gin.H{"result": ""},
+	},
+	"POST /api/quiz/undo": {
+		Summary:  "Undo the latest marks of the current session",
+		Query:    quizUndoQuery{},
+		Status:   201,
+		Response: gin.H{"result": []string{}},
+	},
+	"GET /api/quiz/history": {
+		Summary:  "List review logs",
+		Query:    quizHistoryQuery{},
+		Response: gin.H{"result": []db.ReviewLog{}, "count": int64(0)},
+	},
+	"GET /api/quiz/export": {
+		Summary:     "Export quizzes for Anki, as .apkg, TSV or CSV",
+		Query:       quizExportQuery{},
+		ContentType: "application/octet-stream",
+	},
+	"GET /api/quiz/init": {
+		Summary:  "Start a quiz session, saving the settings",
+		Query:    quizInitQuery{},
+		Response: gin.H{"quiz": []quizInitOutput{}, "upcoming": []quizInitOutput{}},
+	},
+	"PUT /api/quiz/": {
+		Summary:  "Create quizzes for all directions of entries",
+		Body:     quizAddBody{},
+		Status:   201,
+		Response: gin.H{"result": []QuizAddResult{}, "ids": []string{}},
+	},
+	"POST /api/quiz/delete": {
+		Summary:  "Delete quizzes",
+		Body:     quizDeleteBody{},
+		Status:   201,
+		Response: gin.H{"result": ""},
+	},
+
+	"GET /api/sentence/": {
+		Summary:  "Get a sentence",
+		Query:    romanizedEntryQuery{},
+		Response: sentenceResult{},
+	},
+	"GET /api/sentence/q": {
+		Summary:  "Search example sentences, from the user's providers",
+		Query:    sentenceListQuery{},
+		Response: sentenceListResult{},
+	},
+	"POST /api/sentence/import": {
+		Summary:  "Import sentences into the sentence cache",
+		Query:    sentenceImportQuery{},
+		Form:     sentenceImportForm{},
+		Status:   201,
+		Response: gin.H{"created": 0, "skipped": 0},
+	},
+	"GET /api/sentence/random": {
+		Summary:  "Get a random sentence, within the level",
+		Query:    sentenceRandomQuery{},
+		Response: sentenceRandomResult{},
+	},
+
+	"GET /api/user/": {
+		Summary:  "Get user settings, with selected fields",
+		Query:    userQuery{},
+		Response: map[string]interface{}{},
+	},
+	"PATCH /api/user/": {
+		Summary:  "Update user settings",
+		Body:     userUpdateBody{},
+		Status:   201,
+		Response: gin.H{"result": ""},
+	},
+
+	"GET /api/vocab/": {
+		Summary:  "Get a vocab, from CEDICT",
+		Query:    romanizedEntryQuery{},
+		Response: gin.H{"result": []VocabResult{}},
+	},
+	"GET /api/vocab/q": {
+		Summary:  "Search vocab",
+		Query:    romanizedSearchQuery{},
+		Response: gin.H{"result": []VocabResult{}},
+	},
+	"GET /api/vocab/level": {
+		Summary:  "List vocab by level, with the user's SRS levels",
+		Response: gin.H{"result": []vocabLevelResult{}},
+	},
+	"GET /api/vocab/random": {
+		Summary:  "Get a random vocab, within the user's level",
+		Response: randomResult{},
+	},
+}
+
+// undocumented lists routes under /api without an endpoint, and endpoints without a route
+func undocumented(routes gin.RoutesInfo) []string {
+	out := make([]string, 0)
+	registered := map[string]bool{}
+
+	for _, r := range routes {
+		if !strings.HasPrefix(r.Path, "/api/") {
+			continue
+		}
+
+		k := r.Method + " " + r.Path
+		registered[k] = true
+
+		if _, ok := endpoints[k]; !ok {
+			out = append(out, k+": no endpoint")
+		}
+	}
+
+	for k := range endpoints {
+		if !registered[k] {
+			out = append(out, k+": no route")
+		}
+	}
+
+	sort.Strings(out)
+	return out
+}
+
+var openAPIDoc struct {
+	sync.Once
+	b []byte
+}
+
+func routerOpenAPI(apiRouter *gin.RouterGroup) {
+	apiRouter.GET("/openapi.json", wrap(func(ctx *gin.Context) error {
+		openAPIDoc.Do(func() {
+			b, e := json.Marshal(newOpenAPI().document())
+			if e != nil {
+				panic(e)
+			}
+			openAPIDoc.b = b
+		})
+
+		ctx.Data(200, "application/json; charset=utf-8", openAPIDoc.b)
+		return nil
+	}))
+}
+
+type openAPI struct {
+	// schemas are components/schemas, keyed by package.Type
+	schemas map[string]interface{}
+}
+
+func newOpenAPI() *openAPI {
+	return &openAPI{
+		schemas: map[string]interface{}{},
+	}
+}
+
+func (o *openAPI) document() gin.H {
+	paths := map[string]gin.H{}
+
+	for k, ep := range endpoints {
+		ks := strings.SplitN(k, " ", 2)
+		method, p := strings.ToLower(ks[0]), ks[1]
+
+		if paths[p] == nil {
+			paths[p] = gin.H{}
+		}
+		paths[p][method] = o.operation(method, ep)
+	}
+
+	o.schemas["api.APIError"] = o.structSchema(reflect.TypeOf(APIError{}), "json")
+
+	return gin.H{
+		"openapi": "3.0.3",
+		"info": gin.H{
+			"title":   "ZhQuiz API",
+			"version": "1",
+		},
+		"paths": paths,
+		"security": []gin.H{
+			{},
+			{"password": []string{}},
+			{"token": []string{}},
+		},
+		"components": gin.H{
+			"schemas": o.schemas,
+			"securitySchemes": gin.H{
+				"password": gin.H{
+					"type":        "http",
+					"scheme":      "basic",
+					"description": "Any username, with ZHQUIZ_PASSWORD. Only if set, in --serve mode.",
+				},
+				"token": gin.H{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "ZHQUIZ_PASSWORD. Only if set, in --serve mode.",
+				},
+				"csrf": gin.H{
+					"type":        "apiKey",
+					"in":          "header",
+					"name":        CSRFHeader,
+					"description": "From `csrf_token` cookie. Not required in debug mode.",
+				},
+			},
+		},
+	}
+}
+
+func (o *openAPI) operation(method string, ep endpoint) gin.H {
+	out := gin.H{
+		"summary": ep.Summary,
+	}
+
+	// Overrides the document's security, so each alternative also needs csrf
+	if method != "get" {
+		out["security"] = []gin.H{
+			{"csrf": []string{}},
+			{"csrf": []string{}, "password": []string{}},
+			{"csrf": []string{}, "token": []string{}},
+		}
+	}
+
+	if ep.Query != nil {
+		out["parameters"] = o.parameters(reflect.TypeOf(ep.Query))
+	}
+
+	if ep.Body != nil {
+		out["requestBody"] = gin.H{
+			"required": true,
+			"content": gin.H{
+				"application/json": gin.H{
+					"schema": o.schemaOf(reflect.TypeOf(ep.Body)),
+				},
+			},
+		}
+	}
+
+	if ep.Form != nil {
+		out["requestBody"] = gin.H{
+			"required": true,
+			"content": gin.H{
+				"multipart/form-data": gin.H{
+					"schema": o.structSchema(reflect.TypeOf(ep.Form), "form"),
+				},
+			},
+		}
+	}
+
+	status := ep.Status
+	if status == 0 {
+		status = 200
+	}
+
+	res := gin.H{
+		"description": http.StatusText(status),
+	}
+
+	if ep.ContentType != "" {
+		res["content"] = gin.H{
+			ep.ContentType: gin.H{
+				"schema": gin.H{"type": "string", "format": "binary"},
+			},
+		}
+	} else if ep.Response != nil {
+		res["content"] = gin.H{
+			"application/json": gin.H{
+				"schema": o.schemaOfValue(ep.Response),
+			},
+		}
+	}
+
+	out["responses"] = gin.H{
+		strconv.Itoa(status): res,
+		"default": gin.H{
+			"description": "APIError",
+			"content": gin.H{
+				"application/json": gin.H{
+					"schema": gin.H{
+						"type":     "object",
+						"required": []string{"error"},
+						"properties": gin.H{
+							"error": gin.H{"$ref": "#/components/schemas/api.APIError"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return out
+}
+
+// parameters converts a query struct, with `form` and `binding` tags
+func (o *openAPI) parameters(t reflect.Type) []gin.H {
+	out := make([]gin.H, 0)
+
+	for _, f := range fields(t, "form") {
+		schema := o.schemaOf(derefType(f.Type))
+		required := applyBinding(schema, f.Tag.Get("binding"))
+
+		out = append(out, gin.H{
+			"name":     f.Name,
+			"in":       "query",
+			"required": required,
+			"schema":   schema,
+		})
+	}
+
+	return out
+}
+
+// schemaOfValue documents gin.H by its sample values, or else by the type of v
+func (o *openAPI) schemaOfValue(v interface{}) gin.H {
+	switch v := v.(type) {
+	case gin.H:
+		keys := make([]string, 0)
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		props := gin.H{}
+		for _, k := range keys {
+			if v[k] == nil {
+				props[k] = gin.H{}
+			} else {
+				props[k] = o.schemaOfValue(v[k])
+			}
+		}
+
+		return gin.H{
+			"type":       "object",
+			"required":   keys,
+			"properties": props,
+		}
+	case []gin.H:
+		if len(v) > 0 {
+			return gin.H{
+				"type":  "array",
+				"items": o.schemaOfValue(v[0]),
+			}
+		}
+	}
+
+	return o.schemaOf(reflect.TypeOf(v))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var fileType = reflect.TypeOf(multipart.FileHeader{})
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+func (o *openAPI) schemaOf(t reflect.Type) gin.H {
+	if t.Kind() == reflect.Ptr {
+		out := o.schemaOf(t.Elem())
+		if _, isRef := out["$ref"]; isRef {
+			return gin.H{
+				"nullable": true,
+				"allOf":    []gin.H{out},
+			}
+		}
+
+		out["nullable"] = true
+		return out
+	}
+
+	switch t {
+	case timeType:
+		return gin.H{"type": "string", "format": "date-time"}
+	case fileType:
+		return gin.H{"type": "string", "format": "binary"}
+	}
+
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return gin.H{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return gin.H{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return gin.H{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return gin.H{"type": "number"}
+	case reflect.String:
+		return gin.H{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return gin.H{"type": "string", "format": "byte"}
+		}
+
+		return gin.H{
+			"type":  "array",
+			"items": o.schemaOf(t.Elem()),
+		}
+	case reflect.Map:
+		return gin.H{
+			"type":                 "object",
+			"additionalProperties": o.schemaOf(t.Elem()),
+		}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return o.structSchema(t, "json")
+		}
+
+		name := path.Base(t.PkgPath()) + "." + t.Name()
+		if _, ok := o.schemas[name]; !ok {
+			// Placeholder, for recursive types
+			o.schemas[name] = gin.H{}
+			o.schemas[name] = o.structSchema(t, "json")
+		}
+
+		return gin.H{"$ref": "#/components/schemas/" + name}
+	}
+
+	// interface{}
+	return gin.H{}
+}
+
+func (o *openAPI) structSchema(t reflect.Type, tagKey string) gin.H {
+	props := gin.H{}
+	required := make([]string, 0)
+
+	for _, f := range fields(t, tagKey) {
+		ft := f.Type
+		if tagKey == "form" {
+			ft = derefType(ft)
+		}
+
+		schema := o.schemaOf(ft)
+		if applyBinding(schema, f.Tag.Get("binding")) {
+			required = append(required, f.Name)
+		}
+		props[f.Name] = schema
+	}
+
+	out := gin.H{
+		"type":       "object",
+		"properties": props,
+	}
+
+	if len(required) > 0 {
+		out["required"] = required
+	}
+
+	return out
+}
+
+// fields lists serialized fields of struct t, named by tagKey, i.e. json or form.
+// Embedded structs are flattened.
+func fields(t reflect.Type, tagKey string) []reflect.StructField {
+	out := make([]reflect.StructField, 0)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get(tagKey), ",")[0]
+
+		if name == "-" {
+			continue
+		}
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			out = append(out, fields(f.Type, tagKey)...)
+			continue
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name != "" {
+			f.Name = name
+		}
+
+		out = append(out, f)
+	}
+
+	return out
+}
+
+// applyBinding adds validator rules to schema, and returns if it is required.
+// Rules after `dive` apply to array items.
+func applyBinding(schema gin.H, binding string) bool {
+	if binding == "" {
+		return false
+	}
+
+	required := false
+	target := schema
+
+	for _, rule := range strings.Split(binding, ",") {
+		kv := strings.SplitN(rule, "=", 2)
+		param := ""
+		if len(kv) > 1 {
+			param = kv[1]
+		}
+
+		switch kv[0] {
+		case "required":
+			required = true
+		case "dive":
+			if items, ok := target["items"].(gin.H); ok {
+				target = items
+			}
+		case "oneof":
+			enum := make([]string, 0)
+			for _, s := range strings.Fields(param) {
+				enum = append(enum, strings.Trim(s, "'"))
+			}
+			target["enum"] = enum
+		case "min":
+			n, e := strconv.Atoi(param)
+			if e != nil {
+				panic(fmt.Errorf("bad binding %q: %w", binding, e))
+			}
+
+			switch target["type"] {
+			case "array":
+				target["minItems"] = n
+			case "string":
+				target["minLength"] = n
+			default:
+				target["minimum"] = n
+			}
+		case "max":
+			n, e := strconv.Atoi(param)
+			if e != nil {
+				panic(fmt.Errorf("bad binding %q: %w", binding, e))
+			}
+
+			switch target["type"] {
+			case "array":
+				target["maxItems"] = n
+			case "string":
+				target["maxLength"] = n
+			default:
+				target["maximum"] = n
+			}
+		}
+	}
+
+	return required
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
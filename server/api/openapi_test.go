@@ -0,0 +1,18 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEndpointsDocumented(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	Resource{}.Register(r, &Options{Token: "test"})
+
+	for _, p := range undocumented(r.Routes()) {
+		t.Error(p)
+	}
+}
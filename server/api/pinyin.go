@@ -0,0 +1,64 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/zhquiz/go-zhquiz/server/pinyin"
+)
+
+var reFTSBareword = regexp.MustCompile(`^[\p{L}\p{N}\s]+$`)
+
+// matchPinyin extends FTS5 query q, if it is pinyin or Zhuyin, to also match syllables in column,
+// so that "nǐhǎo", "ni3hao3", "nihao" and "ㄋㄧˇㄏㄠˇ" all match. Tones, if typed, must match exactly.
+//
+// Tables in data.db index both toneless and numbered syllables; see db.parsePinyin.
+// For tables in zh.db, which may only have numbered syllables, set anyTone to expand toneless syllables to all tones.
+func matchPinyin(q string, column string, anyTone bool) string {
+	ss, ok := pinyin.Split(q)
+	if !ok {
+		ss, ok = pinyin.SplitZhuyin(q)
+	}
+	if !ok {
+		return q
+	}
+
+	terms := make([]string, 0, len(ss))
+	for _, s := range ss {
+		if s.Tone == 0 && anyTone {
+			alt := []string{s.Toneless()}
+			for tone := 1; tone <= 5; tone++ {
+				alt = append(alt, fmt.Sprintf("%s%d", s.Toneless(), tone))
+			}
+			terms = append(terms, "("+strings.Join(alt, " OR ")+")")
+			continue
+		}
+
+		terms = append(terms, s.Numbered())
+	}
+
+	// e.g. xi'an and ˙ㄇㄚ are not valid FTS5 syntax, unless quoted
+	if !reFTSBareword.MatchString(q) {
+		q = `"` + strings.ReplaceAll(q, `"`, `""`) + `"`
+	}
+
+	return fmt.Sprintf("(%s) OR %s:(%s)", q, column, strings.Join(terms, " AND "))
+}
+
+// romanizationQuery requests an extra romanization of pinyin, as romanize
+type romanizationQuery struct {
+	Romanization string `form:"romanization" binding:"omitempty,oneof=pinyin zhuyin"`
+}
+
+// romanize converts CEDICT pinyin, e.g. ni3 hao3, to tone marks (pinyin) or Zhuyin, or to "" if not requested
+func (q romanizationQuery) romanize(s string) string {
+	switch q.Romanization {
+	case "pinyin":
+		return pinyin.Marked(s)
+	case "zhuyin":
+		return pinyin.Zhuyin(s)
+	}
+
+	return ""
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMatchPinyin(t *testing.T) {
+	for _, c := range []struct {
+		q       string
+		anyTone bool
+		want    string
+	}{
+		{"nihao", false, "(nihao) OR pinyin:(ni AND hao)"},
+		{"ni3hao3", false, "(ni3hao3) OR pinyin:(ni3 AND hao3)"},
+		{"nǐhǎo", false, "(nǐhǎo) OR pinyin:(ni3 AND hao3)"},
+		{"ni hao3", true, "(ni hao3) OR pinyin:((ni OR ni1 OR ni2 OR ni3 OR ni4 OR ni5) AND hao3)"},
+		{"lve4", false, "(lve4) OR pinyin:(lve4)"},
+		{"lu:e4", false, `("lu:e4") OR pinyin:(lve4)`},
+		{"xi'an", false, `("xi'an") OR pinyin:(xi AND an)`},
+		{"ㄋㄧˇㄏㄠˇ", false, "(ㄋㄧˇㄏㄠˇ) OR pinyin:(ni3 AND hao3)"},
+		{"˙ㄇㄚ", false, `("˙ㄇㄚ") OR pinyin:(ma5)`},
+		// Not pinyin, so kept as typed
+		{"hello", false, "hello"},
+		{"你好", true, "你好"},
+		{`"ni hao"`, false, `"ni hao"`},
+	} {
+		if out := matchPinyin(c.q, "pinyin", c.anyTone); out != c.want {
+			t.Errorf("%q is %q, not %q", c.q, out, c.want)
+		}
+	}
+}
+
+// Queries are valid FTS5, and match pinyin as indexed in data.db and in zh.db
+func TestMatchPinyinFTS(t *testing.T) {
+	d, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, stmt := range []string{
+		"CREATE VIRTUAL TABLE q USING fts5(chinese, pinyin)",
+		// As db.parsePinyin, for data.db
+		"INSERT INTO q VALUES ('你好', 'ni hao ni3 hao3')",
+		"INSERT INTO q VALUES ('西安', 'xi an xi1 an1')",
+		// Numbered only, for zh.db
+		"INSERT INTO q VALUES ('略', 'lve4')",
+	} {
+		if r := d.Exec(stmt); r.Error != nil {
+			t.Fatal(r.Error)
+		}
+	}
+
+	for _, c := range []struct {
+		q       string
+		anyTone bool
+		want    []string
+	}{
+		{"nihao", false, []string{"你好"}},
+		{"nǐhǎo", false, []string{"你好"}},
+		{"ni3hao2", false, []string{}},
+		{"xi'an", false, []string{"西安"}},
+		{"xian", false, []string{}},
+		{"ㄋㄧˇㄏㄠˇ", false, []string{"你好"}},
+		{"˙ㄇㄚ", false, []string{}},
+		{"lüe", false, []string{}},
+		{"lüe", true, []string{"略"}},
+		{"lu:e4", false, []string{"略"}},
+		{"你好", false, []string{"你好"}},
+	} {
+		out := []string{}
+		if r := d.Raw("SELECT chinese FROM q WHERE q MATCH ? ORDER BY rowid", matchPinyin(c.q, "pinyin", c.anyTone)).Scan(&out); r.Error != nil {
+			t.Errorf("%q: %v", c.q, r.Error)
+			continue
+		}
+
+		if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%q matched %v, not %v", c.q, out, c.want)
+		}
+	}
+}
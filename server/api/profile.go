@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jkomyno/nanoid"
+	"github.com/zhquiz/go-zhquiz/server/db"
+	"gorm.io/gorm"
+)
+
+// ProfileCookie holds the ID of the current profile, see db.User.
+// Without it, or if the profile is gone, requests act on db.DefaultUserID.
+const ProfileCookie = "profile"
+
+type profileKey struct{}
+
+// profile resolves the current profile of the request, from ProfileCookie
+func profile() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := db.DefaultUserID
+
+		if c, e := ctx.Cookie(ProfileCookie); e == nil && c != "" && c != id {
+			var count int64
+			if r := resource.DB.Current().Model(&db.User{}).Where("id = ?", c).Count(&count); r.Error == nil && count > 0 {
+				id = c
+			}
+		}
+
+		ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), profileKey{}, id))
+		ctx.Next()
+	}
+}
+
+// userID gets the current profile of the request
+func userID(ctx *gin.Context) string {
+	return profileOf(ctx.Request.Context())
+}
+
+// profileOf gets the current profile from request context, e.g. in sentence providers
+func profileOf(c context.Context) string {
+	if id, ok := c.Value(profileKey{}).(string); ok {
+		return id
+	}
+
+	return db.DefaultUserID
+}
+
+// current is resource, acting on the current profile of the request
+func current(ctx *gin.Context) Resource {
+	return resource.As(userID(ctx))
+}
+
+func routerProfile(apiRouter *gin.RouterGroup) {
+	r := apiRouter.Group("/profile")
+
+	r.GET("/", wrap(func(ctx *gin.Context) error {
+		result := make([]profileResult, 0)
+
+		if r := resource.DB.Current().Model(&db.User{}).
+			Select("id", "name", "created_at").
+			Order("created_at").
+			Find(&result); r.Error != nil {
+			return r.Error
+		}
+
+		ctx.JSON(200, gin.H{
+			"result":  result,
+			"current": userID(ctx),
+		})
+		return nil
+	}))
+
+	r.POST("/", wrap(func(ctx *gin.Context) error {
+		var body profileBody
+
+		if e := ctx.ShouldBindJSON(&body); e != nil {
+			return Validation(e)
+		}
+
+		u := db.User{
+			Name: body.Name,
+		}
+
+		for u.ID == "" {
+			id, e := nanoid.Nanoid(6)
+			if e != nil {
+				return e
+			}
+
+			var count int64
+			if r := resource.DB.Current().Model(&db.User{}).Where("id = ?", id).Count(&count); r.Error != nil {
+				return r.Error
+			}
+
+			if count == 0 {
+				u.ID = id
+			}
+		}
+
+		if r := resource.DB.Current().Create(&u); r.Error != nil {
+			return r.Error
+		}
+
+		ctx.JSON(201, gin.H{
+			"id": u.ID,
+		})
+		return nil
+	}))
+
+	r.PATCH("/", wrap(func(ctx *gin.Context) error {
+		var query idQuery
+
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
+		}
+
+		var body profileBody
+
+		if e := ctx.ShouldBindJSON(&body); e != nil {
+			return Validation(e)
+		}
+
+		r := resource.DB.Current().Model(&db.User{}).Where("id = ?", query.ID).Update("name", body.Name)
+		if r.Error != nil {
+			return r.Error
+		}
+
+		if r.RowsAffected == 0 {
+			return NotFound(fmt.Errorf("no such profile: %s", query.ID))
+		}
+
+		ctx.JSON(201, gin.H{
+			"result": "updated",
+		})
+		return nil
+	}))
+
+	r.DELETE("/", wrap(func(ctx *gin.Context) error {
+		var query idQuery
+
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
+		}
+
+		if query.ID == db.DefaultUserID {
+			return Validation(errors.New("cannot delete the default profile"))
+		}
+
+		var u db.User
+		if r := resource.DB.Current().Select("id").Where("id = ?", query.ID).First(&u); r.Error != nil {
+			return r.Error
+		}
+
+		if _, e := resource.DB.Backup("delete-profile"); e != nil {
+			return fmt.Errorf("cannot back up before deleting profile: %w", e)
+		}
+
+		if e := resource.DB.Current().Transaction(func(tx *gorm.DB) error {
+			return u.Delete(tx)
+		}); e != nil {
+			return e
+		}
+
+		// Requests would fall back to the default profile anyway
+		if userID(ctx) == u.ID {
+			ctx.SetSameSite(http.SameSiteStrictMode)
+			ctx.SetCookie(ProfileCookie, "", -1, "/", "", false, true)
+		}
+
+		ctx.JSON(201, gin.H{
+			"result": "deleted",
+		})
+		return nil
+	}))
+
+	r.POST("/switch", wrap(func(ctx *gin.Context) error {
+		var query idQuery
+
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
+		}
+
+		var u db.User
+		if r := resource.DB.Current().Select("id").Where("id = ?", query.ID).First(&u); r.Error != nil {
+			return r.Error
+		}
+
+		ctx.SetSameSite(http.SameSiteStrictMode)
+		ctx.SetCookie(ProfileCookie, u.ID, 10*365*24*60*60, "/", "", false, true)
+
+		ctx.JSON(201, gin.H{
+			"result": "switched",
+		})
+		return nil
+	}))
+}
+
+type profileResult struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type profileBody struct {
+	Name string `json:"name" binding:"required"`
+}
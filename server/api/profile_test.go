@@ -0,0 +1,272 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhquiz/go-zhquiz/server/db"
+)
+
+// profileTest registers routes of a new resource
+func profileTest(t *testing.T) (Resource, *gin.Engine) {
+	gin.SetMode(gin.TestMode)
+
+	res := prepareTest(t)
+	r := gin.New()
+	res.Register(r, &Options{Token: "test"})
+
+	return res, r
+}
+
+// serveAs serves a request as profile, by ProfileCookie, if not empty
+func serveAs(r *gin.Engine, profile string, method string, target string, body string) *httptest.ResponseRecorder {
+	var b io.Reader
+	if body != "" {
+		b = strings.NewReader(body)
+	}
+
+	req := httptest.NewRequest(method, target, b)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(CSRFHeader, "test")
+	if profile != "" {
+		req.AddCookie(&http.Cookie{Name: ProfileCookie, Value: profile})
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+// listProfiles gets names of profiles by ID, and the current one
+func listProfiles(t *testing.T, r *gin.Engine, profile string) (map[string]string, string) {
+	w := serveAs(r, profile, "GET", "/api/profile/", "")
+	if w.Code != 200 {
+		t.Fatalf("%d: %s", w.Code, w.Body.String())
+	}
+
+	var out struct {
+		Result  []profileResult `json:"result"`
+		Current string          `json:"current"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[string]string{}
+	for _, p := range out.Result {
+		names[p.ID] = p.Name
+	}
+
+	return names, out.Current
+}
+
+// createProfile creates a profile named name, and gets its ID
+func createProfile(t *testing.T, r *gin.Engine, name string) string {
+	w := serveAs(r, "", "POST", "/api/profile/", `{"name": "`+name+`"}`)
+	if w.Code != 201 {
+		t.Fatalf("%d: %s", w.Code, w.Body.String())
+	}
+
+	var out struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil || out.ID == "" {
+		t.Fatalf("created %s: %v", w.Body.String(), err)
+	}
+
+	return out.ID
+}
+
+func TestProfileCookie(t *testing.T) {
+	_, r := profileTest(t)
+	id := createProfile(t, r, "p2")
+
+	for _, c := range []struct {
+		cookie string
+		want   string
+	}{
+		{"", db.DefaultUserID},
+		{db.DefaultUserID, db.DefaultUserID},
+		{id, id},
+		// Unknown or deleted profiles fall back to the default
+		{"unknown", db.DefaultUserID},
+	} {
+		if _, current := listProfiles(t, r, c.cookie); current != c.want {
+			t.Errorf("cookie %q is profile %q, not %q", c.cookie, current, c.want)
+		}
+	}
+}
+
+func TestProfileRoutes(t *testing.T) {
+	_, r := profileTest(t)
+
+	if w := serveAs(r, "", "POST", "/api/profile/", `{}`); w.Code != 400 {
+		t.Errorf("created without name: %d", w.Code)
+	}
+
+	id := createProfile(t, r, "p2")
+
+	if names, _ := listProfiles(t, r, ""); len(names) != 2 || names[id] != "p2" {
+		t.Errorf("profiles %v", names)
+	}
+
+	// Rename
+	if w := serveAs(r, "", "PATCH", "/api/profile/?id="+id, `{"name": "p3"}`); w.Code != 201 {
+		t.Errorf("renamed: %d %s", w.Code, w.Body.String())
+	}
+	if names, _ := listProfiles(t, r, ""); names[id] != "p3" {
+		t.Errorf("not renamed: %v", names)
+	}
+	if w := serveAs(r, "", "PATCH", "/api/profile/?id=unknown", `{"name": "p4"}`); w.Code != 404 {
+		t.Errorf("renamed unknown: %d", w.Code)
+	}
+
+	// Switch
+	w := serveAs(r, "", "POST", "/api/profile/switch?id="+id, "")
+	if w.Code != 201 {
+		t.Fatalf("switched: %d %s", w.Code, w.Body.String())
+	}
+
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == ProfileCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || cookie.Value != id || !cookie.HttpOnly {
+		t.Fatalf("switched with cookie %+v", cookie)
+	}
+	if _, current := listProfiles(t, r, cookie.Value); current != id {
+		t.Errorf("switched to %q, not %q", current, id)
+	}
+
+	if w := serveAs(r, "", "POST", "/api/profile/switch?id=unknown", ""); w.Code != 404 {
+		t.Errorf("switched to unknown: %d", w.Code)
+	}
+}
+
+func TestProfileDelete(t *testing.T) {
+	res, r := profileTest(t)
+	id := createProfile(t, r, "p2")
+
+	for _, profile := range []string{"", id} {
+		if w := serveAs(r, profile, "PUT", "/api/quiz/", `{"entries": ["你好"], "type": "vocab"}`); w.Code != 201 {
+			t.Fatalf("%d: %s", w.Code, w.Body.String())
+		}
+		if w := serveAs(r, profile, "PUT", "/api/library/", `{"title": "L", "entries": ["你好"]}`); w.Code != 201 {
+			t.Fatalf("%d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	if w := serveAs(r, "", "DELETE", "/api/profile/?id="+db.DefaultUserID, ""); w.Code != 400 {
+		t.Errorf("deleted the default profile: %d", w.Code)
+	}
+	if w := serveAs(r, "", "DELETE", "/api/profile/?id=unknown", ""); w.Code != 404 {
+		t.Errorf("deleted unknown: %d", w.Code)
+	}
+
+	w := serveAs(r, id, "DELETE", "/api/profile/?id="+id, "")
+	if w.Code != 201 {
+		t.Fatalf("deleted: %d %s", w.Code, w.Body.String())
+	}
+
+	// The cookie of the deleted profile is cleared
+	for _, c := range w.Result().Cookies() {
+		if c.Name == ProfileCookie && c.MaxAge >= 0 {
+			t.Errorf("cookie kept %+v", c)
+		}
+	}
+
+	if names, _ := listProfiles(t, r, ""); len(names) != 1 {
+		t.Errorf("profiles after delete %v", names)
+	}
+
+	tx := res.DB.Current()
+	for _, m := range []interface{}{&db.Quiz{}, &db.Library{}} {
+		var n, other int64
+		if r := tx.Model(m).Where("user_id = ?", id).Count(&n); r.Error != nil || n != 0 {
+			t.Errorf("%T of deleted profile: %d, %v", m, n, r.Error)
+		}
+		if r := tx.Model(m).Where("user_id = ?", db.DefaultUserID).Count(&other); r.Error != nil || other == 0 {
+			t.Errorf("%T of the default profile are deleted: %v", m, r.Error)
+		}
+	}
+
+	v, err := db.Verify(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.OK() {
+		t.Errorf("FTS issues after delete: %+v", v.Issues)
+	}
+
+	backups, err := db.Backups()
+	if err != nil || len(backups) != 1 {
+		t.Errorf("backups %v: %v", backups, err)
+	}
+}
+
+// TestProfileIsolation checks that quizzes of a profile are invisible from another
+func TestProfileIsolation(t *testing.T) {
+	_, r := profileTest(t)
+	id := createProfile(t, r, "p2")
+
+	w := serveAs(r, id, "PUT", "/api/quiz/", `{"entries": ["你好"], "type": "vocab"}`)
+	if w.Code != 201 {
+		t.Fatalf("%d: %s", w.Code, w.Body.String())
+	}
+
+	var created struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || len(created.IDs) == 0 {
+		t.Fatalf("created %s: %v", w.Body.String(), err)
+	}
+
+	// many counts quizzes of 你好 visible to profile
+	many := func(profile string) int {
+		w := serveAs(r, profile, "GET", "/api/quiz/many?entries=%E4%BD%A0%E5%A5%BD&type=vocab&select=id", "")
+		if w.Code != 200 {
+			t.Fatalf("%d: %s", w.Code, w.Body.String())
+		}
+
+		var out struct {
+			Result []map[string]interface{} `json:"result"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+
+		return len(out.Result)
+	}
+
+	if n := many(id); n != len(created.IDs) {
+		t.Errorf("profile sees %d of its %d quizzes", n, len(created.IDs))
+	}
+	if n := many(""); n != 0 {
+		t.Errorf("default profile sees %d quizzes of another", n)
+	}
+
+	// Nor can it delete them
+	body, _ := json.Marshal(gin.H{"ids": created.IDs})
+	if w := serveAs(r, "", "POST", "/api/quiz/delete", string(body)); w.Code != 201 {
+		t.Fatalf("%d: %s", w.Code, w.Body.String())
+	}
+	if n := many(id); n != len(created.IDs) {
+		t.Errorf("deleted by another profile: %d left", n)
+	}
+
+	// The same quizzes are created anew in the default profile
+	if w := serveAs(r, "", "PUT", "/api/quiz/", `{"entries": ["你好"], "type": "vocab"}`); w.Code != 201 {
+		t.Fatalf("%d: %s", w.Code, w.Body.String())
+	}
+	if n := many(""); n != len(created.IDs) {
+		t.Errorf("default profile has %d quizzes, not %d", n, len(created.IDs))
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"errors"
 	"fmt"
+	"log"
 	"math/rand"
 	"regexp"
 	"sort"
@@ -21,18 +22,11 @@ import (
 func routerQuiz(apiRouter *gin.RouterGroup) {
 	r := apiRouter.Group("/quiz")
 
-	r.GET("/many", func(ctx *gin.Context) {
-		var query struct {
-			IDs       string `form:"ids"`
-			Entries   string `form:"entries"`
-			Type      string `form:"type" binding:"oneof=hanzi vocab sentence extra ''"`
-			Source    string `form:"source"`
-			Direction string `form:"direction"`
-			Select    string `form:"select"`
-		}
+	r.GET("/many", wrap(func(ctx *gin.Context) error {
+		var query quizManyQuery
 
-		if e := ctx.BindQuery(&query); e != nil {
-			ctx.AbortWithError(400, e)
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
 		var ids []string
@@ -45,7 +39,7 @@ func routerQuiz(apiRouter *gin.RouterGroup) {
 			entries = strings.Split(query.Entries, ",")
 		}
 
-		quizGetter(ctx, getterBody{
+		return quizGetter(ctx, getterBody{
 			IDs:       ids,
 			Entries:   entries,
 			Type:      query.Type,
@@ -53,27 +47,23 @@ func routerQuiz(apiRouter *gin.RouterGroup) {
 			Direction: query.Direction,
 			Select:    strings.Split(query.Select, ","),
 		})
-	})
+	}))
 
-	r.POST("/many", func(ctx *gin.Context) {
+	r.POST("/many", wrap(func(ctx *gin.Context) error {
 		var body getterBody
 
-		if e := ctx.BindJSON(&body); e != nil {
-			ctx.AbortWithError(400, e)
+		if e := ctx.ShouldBindJSON(&body); e != nil {
+			return Validation(e)
 		}
 
-		quizGetter(ctx, body)
-	})
+		return quizGetter(ctx, body)
+	}))
 
-	r.POST("/srsLevel", func(ctx *gin.Context) {
-		var body struct {
-			Entries []string `form:"entries" binding:"required,min=1"`
-			Type    string   `form:"type" binding:"oneof=hanzi vocab sentence extra ''"`
-		}
+	r.POST("/srsLevel", wrap(func(ctx *gin.Context) error {
+		var body quizSrsLevelBody
 
-		if e := ctx.BindJSON(&body); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		if e := ctx.ShouldBindJSON(&body); e != nil {
+			return Validation(e)
 		}
 
 		out := make([]gin.H, 0)
@@ -93,12 +83,13 @@ func routerQuiz(apiRouter *gin.RouterGroup) {
 
 			var quizzes []db.Quiz
 
-			clause := resource.DB.Current.Model(&db.Quiz{}).
+			clause := resource.DB.Current().Model(&db.Quiz{}).
+				Scopes(db.OwnedBy(userID(ctx))).
 				Select("entry", "srs_level").
 				Where(where, cond)
 
 			if r := clause.Find(&quizzes); r.Error != nil {
-				panic(r.Error)
+				return r.Error
 			}
 
 			for _, q := range quizzes {
@@ -112,37 +103,25 @@ func routerQuiz(apiRouter *gin.RouterGroup) {
 		ctx.JSON(200, gin.H{
 			"result": out,
 		})
-	})
+		return nil
+	}))
 
-	r.GET("/leech", func(ctx *gin.Context) {
-		var query struct {
-			Q       string `form:"q"`
-			Page    string `form:"page" binding:"required"`
-			PerPage string `form:"perPage" binding:"required"`
-			Sort    string `form:"sort"`
-			Order   string `form:"order" binding:"oneof=desc asc"`
-		}
+	r.GET("/leech", wrap(func(ctx *gin.Context) error {
+		var query quizLeechQuery
 
-		if e := ctx.BindQuery(&query); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
 		page := 1
-		p, e := strconv.Atoi(query.Page)
-		if e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		if query.Page != nil {
+			page = *query.Page
 		}
-		page = p
 
 		perPage := 5
-		p, e = strconv.Atoi(query.PerPage)
-		if e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		if query.PerPage != nil {
+			perPage = *query.PerPage
 		}
-		perPage = p
 
 		sort := map[string]string{
 			"id":        "id",
@@ -162,74 +141,151 @@ func routerQuiz(apiRouter *gin.RouterGroup) {
 
 		var count int64 = 0
 
-		q := resource.DB.Current.Model(&db.Quiz{}).
+		q := resource.DB.Current().Model(&db.Quiz{}).
+			Scopes(db.OwnedBy(userID(ctx))).
 			Select("id", "entry", "type", "direction", "last_right", "wrong_streak").
-			Where("wrong_streak >= 2")
+			Where("wrong_streak >= ?", db.LeechStreak)
 
 		if query.Q != "" {
-			q = q.Where(qSearch(query.Q))
+			cond, e := qSearch(query.Q)
+			if e != nil {
+				return e
+			}
+			q = q.Where(cond)
 		}
 
 		if r := q.Count(&count); r.Error != nil {
-			panic(r.Error)
+			return r.Error
 		}
 
 		if r := q.Limit(perPage).Order(sort).Offset((page - 1) * perPage).Find(&result); r.Error != nil {
-			panic(r.Error)
+			return r.Error
 		}
 
 		ctx.JSON(200, gin.H{
 			"result": result,
 			"count":  count,
 		})
-	})
+		return nil
+	}))
 
-	r.PATCH("/mark", func(ctx *gin.Context) {
-		var query struct {
-			ID   string `form:"id" binding:"required"`
-			Type string `form:"type" binding:"required,oneof=right wrong repeat"`
+	r.PATCH("/mark", wrap(func(ctx *gin.Context) error {
+		var query quizMarkQuery
+
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
-		if e := ctx.BindQuery(&query); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		if e := current(ctx).MarkQuiz(query.ID, db.Grade(query.Type), query.Latency); e != nil {
+			return e
 		}
 
-		var quiz db.Quiz
-		if r := resource.DB.Current.
-			Where("id = ?", query.ID).
-			First(&quiz); r.Error != nil {
-			panic(r.Error)
+		ctx.JSON(201, gin.H{
+			"result": "updated",
+		})
+		return nil
+	}))
+
+	r.POST("/undo", wrap(func(ctx *gin.Context) error {
+		var query quizUndoQuery
+
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
-		quiz.UpdateSRSLevel(map[string]int8{
-			"right":  1,
-			"wrong":  -1,
-			"repeat": 0,
-		}[query.Type])
+		n := 1
+		if query.N != nil {
+			n = int(*query.N)
+		}
+
+		var ids []string
+
+		e := resource.DB.Current().Transaction(func(tx *gorm.DB) error {
+			out, e := db.Undo(tx, userID(ctx), n)
+			ids = out
+			return e
+		})
 
-		if r := resource.DB.Current.Save(&quiz); r.Error != nil {
-			panic(r.Error)
+		if e != nil {
+			return e
 		}
 
 		ctx.JSON(201, gin.H{
-			"result": "updated",
+			"result": ids,
 		})
-	})
+		return nil
+	}))
+
+	r.GET("/history", wrap(func(ctx *gin.Context) error {
+		var query quizHistoryQuery
 
-	r.GET("/init", func(ctx *gin.Context) {
-		var query struct {
-			Type         string `form:"type"`
-			Stage        string `form:"stage"`
-			Direction    string `form:"direction"`
-			IncludeUndue string `form:"includeUndue"`
-			IncludeExtra string `form:"includeExtra"`
-			Q            string `form:"q"`
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
-		if e := ctx.BindQuery(&query); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		page := 1
+		if query.Page != nil {
+			page = *query.Page
+		}
+
+		perPage := 10
+		if query.PerPage != nil {
+			perPage = *query.PerPage
+		}
+
+		result := make([]db.ReviewLog, 0)
+
+		var count int64 = 0
+
+		q := resource.DB.Current().Model(&db.ReviewLog{}).
+			Where("quiz_id IN (SELECT id FROM quiz WHERE user_id = ?)", userID(ctx))
+
+		if query.ID != "" {
+			q = q.Where("quiz_id = ?", query.ID)
+		}
+
+		if r := q.Count(&count); r.Error != nil {
+			return r.Error
+		}
+
+		if r := q.Limit(perPage).Order("created_at DESC, id DESC").Offset((page - 1) * perPage).Find(&result); r.Error != nil {
+			return r.Error
+		}
+
+		ctx.JSON(200, gin.H{
+			"result": result,
+			"count":  count,
+		})
+		return nil
+	}))
+
+	r.GET("/export", wrap(func(ctx *gin.Context) error {
+		var query quizExportQuery
+
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
+		}
+
+		filename := "zhquiz-" + time.Now().Format("20060102-150405") + "." + query.Format
+		ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+		switch query.Format {
+		case "apkg":
+			ctx.Header("Content-Type", "application/octet-stream")
+		case "tsv":
+			ctx.Header("Content-Type", "text/tab-separated-values; charset=utf-8")
+		default:
+			ctx.Header("Content-Type", "text/csv; charset=utf-8")
+		}
+
+		return current(ctx).ExportQuizzes(ctx.Writer, query.Format, query.Q)
+	}))
+
+	r.GET("/init", wrap(func(ctx *gin.Context) error {
+		var query quizInitQuery
+
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
 		if len(query.Type) == 0 {
@@ -237,7 +293,7 @@ func routerQuiz(apiRouter *gin.RouterGroup) {
 				"quiz":     make([]string, 0),
 				"upcoming": make([]string, 0),
 			})
-			return
+			return nil
 		}
 
 		if len(query.Stage) == 0 {
@@ -245,7 +301,7 @@ func routerQuiz(apiRouter *gin.RouterGroup) {
 				"quiz":     make([]string, 0),
 				"upcoming": make([]string, 0),
 			})
-			return
+			return nil
 		}
 
 		if len(query.Direction) == 0 {
@@ -253,18 +309,21 @@ func routerQuiz(apiRouter *gin.RouterGroup) {
 				"quiz":     make([]string, 0),
 				"upcoming": make([]string, 0),
 			})
-			return
+			return nil
 		}
 
 		qType := strings.Split(query.Type, ",")
 		stage := strings.Split(query.Stage, ",")
 		direction := strings.Split(query.Direction, ",")
 
+		res := current(ctx)
+
 		// No need to await
-		go func() {
-			var user db.User
-			if r := resource.DB.Current.First(&user); r.Error != nil {
-				panic(r.Error)
+		goBackground(func() {
+			user, e := res.User()
+			if e != nil {
+				log.Printf("cannot save quiz settings: %v\n", e)
+				return
 			}
 
 			user.Meta.Settings.Quiz.Direction = direction
@@ -274,48 +333,22 @@ func routerQuiz(apiRouter *gin.RouterGroup) {
 			user.Meta.Settings.Quiz.IncludeUndue = (query.IncludeUndue != "")
 			user.Meta.Settings.Quiz.Q = query.Q
 
-			if r := resource.DB.Current.Where("id = ?", user.ID).Updates(&db.User{
+			if r := resource.DB.Current().Where("id = ?", user.ID).Updates(&db.User{
 				Meta: user.Meta,
 			}); r.Error != nil {
-				panic(r.Error)
+				log.Printf("cannot save quiz settings: %v\n", r.Error)
 			}
-		}()
-
-		q := resource.DB.Current.Model(&db.Quiz{})
-
-		if query.Q != "" {
-			q = q.Where(qSearch(query.Q))
-		}
-
-		var orCond []string
-
-		stageSet := util.MakeSet(stage)
-		if stageSet["new"] {
-			orCond = append(orCond, "srs_level IS NULL")
-		}
-
-		if stageSet["learning"] {
-			orCond = append(orCond, "srs_level < 3")
-		}
-
-		if stageSet["graduated"] {
-			orCond = append(orCond, "srs_level >= 3")
-		}
-
-		if len(orCond) > 0 {
-			q = q.Where(strings.Join(orCond, " OR "))
-		}
+		})
 
-		if !stageSet["leech"] {
-			q = q.Where("NOT (wrong_streak > 2)")
+		q, e := quizQuery(resource.DB.Current().Scopes(db.OwnedBy(res.UserID)), qType, stage, direction, query.Q)
+		if e != nil {
+			return e
 		}
 
 		var quizzes []db.Quiz
 
-		if r := q.
-			Where("[type] IN ? AND [direction] IN ?", qType, direction).
-			Find(&quizzes); r.Error != nil {
-			panic(r.Error)
+		if r := q.Find(&quizzes); r.Error != nil {
+			return r.Error
 		}
 
 		quiz := make([]quizInitOutput, 0)
@@ -407,253 +440,366 @@ func routerQuiz(apiRouter *gin.RouterGroup) {
 			"quiz":     quiz,
 			"upcoming": upcoming,
 		})
-	})
+		return nil
+	}))
 
-	r.PUT("/", func(ctx *gin.Context) {
-		var body struct {
-			Entries     []string          `json:"entries" binding:"required,min=1"`
-			Type        string            `json:"type" binding:"required,oneof=hanzi vocab sentence extra"`
-			Description string            `json:"description"`
-			Pinyin      map[string]string `json:"pinyin"`
-			English     map[string]string `json:"english"`
-		}
-		if e := ctx.BindJSON(&body); e != nil {
-			ctx.AbortWithError(400, e)
+	r.PUT("/", wrap(func(ctx *gin.Context) error {
+		var body quizAddBody
+		if e := ctx.ShouldBindJSON(&body); e != nil {
+			return Validation(e)
 		}
 
-		if body.Pinyin == nil {
-			body.Pinyin = make(map[string]string)
+		var result []QuizAddResult
+
+		e := resource.DB.Current().Transaction(func(tx *gorm.DB) error {
+			r, e := addQuizzes(tx, userID(ctx), body)
+			result = r
+			return e
+		})
+
+		if e != nil {
+			return e
 		}
 
-		if body.English == nil {
-			body.English = make(map[string]string)
+		ids := make([]string, 0)
+		for _, r := range result {
+			ids = append(ids, r.IDs...)
 		}
 
-		var existingQ []db.Quiz
+		ctx.JSON(201, gin.H{
+			"result": result,
+			"ids":    ids,
+		})
+		return nil
+	}))
+
+	r.POST("/delete", wrap(func(ctx *gin.Context) error {
+		var body quizDeleteBody
 
-		if r := resource.DB.Current.
-			Where("entry IN ? AND type = ?", body.Entries, body.Type).
-			Find(&existingQ); r.Error != nil {
-			panic(r.Error)
+		if e := ctx.ShouldBindJSON(&body); e != nil {
+			return Validation(e)
 		}
 
-		lookup := map[string]map[string]db.Quiz{}
+		e := resource.DB.Current().Transaction(func(tx *gorm.DB) error {
+			var quizzes []db.Quiz
+			if r := tx.Scopes(db.OwnedBy(userID(ctx))).Where("id IN ?", body.IDs).Find(&quizzes); r.Error != nil {
+				return r.Error
+			}
 
-		for _, it := range existingQ {
-			if lookup[it.Entry] == nil {
-				lookup[it.Entry] = map[string]db.Quiz{}
+			for _, q := range quizzes {
+				if e := q.Delete(tx); e != nil {
+					return e
+				}
 			}
-			lookup[it.Entry][it.Direction] = it
+
+			return nil
+		})
+
+		if e != nil {
+			return e
+		}
+
+		ctx.JSON(201, gin.H{
+			"result": "deleted",
+		})
+		return nil
+	}))
+}
+
+type quizManyQuery struct {
+	IDs       string `form:"ids"`
+	Entries   string `form:"entries"`
+	Type      string `form:"type" binding:"oneof=hanzi vocab sentence extra ''"`
+	Source    string `form:"source"`
+	Direction string `form:"direction"`
+	Select    string `form:"select"`
+}
+
+type quizSrsLevelBody struct {
+	Entries []string `json:"entries" binding:"required,min=1"`
+	Type    string   `json:"type" binding:"oneof=hanzi vocab sentence extra ''"`
+}
+
+type quizLeechQuery struct {
+	Q       string `form:"q"`
+	Page    *int   `form:"page" binding:"omitempty,min=1"`
+	PerPage *int   `form:"perPage" binding:"omitempty,min=1,max=100"`
+	Sort    string `form:"sort"`
+	Order   string `form:"order" binding:"oneof=desc asc"`
+}
+
+type quizMarkQuery struct {
+	ID      string `form:"id" binding:"required"`
+	Type    string `form:"type" binding:"required,oneof=again hard good easy repeat right wrong"`
+	Latency *uint  `form:"latency"`
+}
+
+type quizUndoQuery struct {
+	N *uint `form:"n" binding:"omitempty,min=1,max=100"`
+}
+
+type quizHistoryQuery struct {
+	ID      string `form:"id"`
+	Page    *int   `form:"page" binding:"omitempty,min=1"`
+	PerPage *int   `form:"perPage" binding:"omitempty,min=1,max=100"`
+}
+
+type quizExportQuery struct {
+	Format string `form:"format" binding:"required,oneof=apkg tsv csv"`
+	Q      string `form:"q"`
+}
+
+type quizInitQuery struct {
+	Type         string `form:"type"`
+	Stage        string `form:"stage"`
+	Direction    string `form:"direction"`
+	IncludeUndue string `form:"includeUndue"`
+	IncludeExtra string `form:"includeExtra"`
+	Q            string `form:"q"`
+}
+
+type quizDeleteBody struct {
+	IDs []string `json:"ids" binding:"required,min=1"`
+}
+
+type quizAddBody struct {
+	Entries     []string          `json:"entries" binding:"required,min=1"`
+	Type        string            `json:"type" binding:"required,oneof=hanzi vocab sentence extra"`
+	Description string            `json:"description"`
+	Tag         string            `json:"tag"`
+	Pinyin      map[string]string `json:"pinyin"`
+	English     map[string]string `json:"english"`
+}
+
+// QuizAddResult is IDs of all directions of an entry, whether new or existing
+type QuizAddResult struct {
+	IDs    []string `json:"ids"`
+	Entry  string   `json:"entry"`
+	Type   string   `json:"type"`
+	Source string   `json:"source"`
+}
+
+// addQuizzes creates quizzes of a profile for all directions of entries,
+// along with Extra, if entries are not in zh.db
+func addQuizzes(tx *gorm.DB, userID string, body quizAddBody) ([]QuizAddResult, error) {
+	if body.Pinyin == nil {
+		body.Pinyin = make(map[string]string)
+	}
+
+	if body.English == nil {
+		body.English = make(map[string]string)
+	}
+
+	var existingQ []db.Quiz
+
+	if r := tx.
+		Scopes(db.OwnedBy(userID)).
+		Where("entry IN ? AND type = ?", body.Entries, body.Type).
+		Find(&existingQ); r.Error != nil {
+		return nil, r.Error
+	}
+
+	lookup := map[string]map[string]db.Quiz{}
+
+	for _, it := range existingQ {
+		if lookup[it.Entry] == nil {
+			lookup[it.Entry] = map[string]db.Quiz{}
 		}
+		lookup[it.Entry][it.Direction] = it
+	}
+
+	result := make([]QuizAddResult, 0)
 
-		type Result struct {
-			IDs    []string `json:"ids"`
-			Entry  string   `json:"entry"`
-			Type   string   `json:"type"`
-			Source string   `json:"source"`
+	var newQ []db.Quiz
+	var newExtra []db.Extra
+
+	for _, entry := range body.Entries {
+		subresult := QuizAddResult{
+			IDs:   make([]string, 0),
+			Entry: entry,
+			Type:  body.Type,
 		}
-		result := make([]Result, 0)
-		ids := make([]string, 0)
 
-		var newQ []db.Quiz
-		var newExtra []db.Extra
+		source, directions, e := quizSource(entry, body.Type)
+		if e != nil {
+			return nil, e
+		}
+		subresult.Source = source
 
-		for _, entry := range body.Entries {
-			subresult := Result{
-				IDs:    make([]string, 0),
-				Entry:  entry,
-				Type:   body.Type,
-				Source: "",
+		var extraCount int64
+		if subresult.Source == "extra" {
+			if r := tx.Model(&db.Extra{}).Scopes(db.OwnedBy(userID)).Where("chinese = ?", entry).Count(&extraCount); r.Error != nil {
+				return nil, r.Error
 			}
-			result = append(result, subresult)
+		}
 
-			directions := []string{"se", "ec"}
+		if subresult.Source == "extra" && extraCount == 0 {
+			pinyin := body.Pinyin[entry]
+			english := body.English[entry]
 
-			switch body.Type {
-			case "vocab":
-				var items []zh.Vocab
-				if r := resource.Zh.Current.
-					Where("simplified = ? OR traditional = ?", entry, entry).
-					Find(&items); r.Error != nil {
-					panic(r.Error)
+			if pinyin == "" || english == "" {
+				p, en, e := guessPinyinEnglish(entry)
+				if e != nil {
+					return nil, e
 				}
 
-				if len(items) > 0 {
-					for _, it := range items {
-						if len(directions) < 3 && it.Traditional != "" {
-							directions = append(directions, "te")
-						}
-					}
-				} else {
-					subresult.Source = "extra"
+				if pinyin == "" {
+					pinyin = p
 				}
-			case "hanzi":
-				if r := resource.Zh.Current.
-					Where("entry = ? AND length(entry) = 1 AND english IS NOT NULL", entry).
-					First(&zh.Token{}); r.Error != nil {
-					if !errors.Is(r.Error, gorm.ErrRecordNotFound) {
-						panic(r.Error)
-					}
-					subresult.Source = "extra"
-				}
-			case "sentence":
-				if r := resource.Zh.Current.
-					Where("chinese = ?", entry).
-					First(&zh.Sentence{}); r.Error != nil {
-					if !errors.Is(r.Error, gorm.ErrRecordNotFound) {
-						panic(r.Error)
-					}
-					subresult.Source = "extra"
+
+				if english == "" {
+					english = en
 				}
 			}
 
-			if subresult.Source == "extra" {
-				pinyin := body.Pinyin[entry]
-				english := body.English[entry]
-
-				if pinyin == "" || english == "" {
-					pSegs := make([]string, 0)
-					eSegs := make([]string, 0)
-					reHan := regexp.MustCompile(`\p{Han}+`)
-
-					for _, seg := range cutChinese(entry) {
-						if reHan.MatchString(seg) {
-							var vocab zh.Vocab
-							if r := resource.Zh.Current.Where("simplified = ? OR traditional = ?", seg, seg).Order("frequency DESC").First(&vocab); r.Error != nil {
-								if !errors.Is(r.Error, gorm.ErrRecordNotFound) {
-									panic(r.Error)
-								}
-							}
-
-							if vocab.English != "" {
-								pSegs = append(pSegs, vocab.Pinyin)
-								eSegs = append(eSegs, vocab.English)
-							} else {
-								pSegs = append(pSegs, seg)
-								eSegs = append(eSegs, seg)
-							}
-						} else {
-							pSegs = append(pSegs, seg)
-							eSegs = append(eSegs, seg)
-						}
+			newExtra = append(newExtra, db.Extra{
+				UserID:      userID,
+				Chinese:     entry,
+				Pinyin:      pinyin,
+				English:     english,
+				Type:        subresult.Type,
+				Description: body.Description,
+				Tag:         body.Tag,
+			})
+		}
+
+		lookupDir := lookup[entry]
+		if lookupDir == nil {
+			lookupDir = map[string]db.Quiz{}
+		}
+
+		for _, d := range directions {
+			if lookupDir[d].ID == "" {
+				id := ""
+
+				for {
+					id1, err := nanoid.Nanoid(6)
+					if err != nil {
+						return nil, err
 					}
 
-					if pinyin == "" {
-						pinyin = strings.Join(pSegs, " ")
+					var count int64
+					if r := tx.Model(db.Quiz{}).Where("id = ?", id1).Count(&count); r.Error != nil {
+						return nil, r.Error
 					}
 
-					if english == "" {
-						english = strings.Join(eSegs, "; ")
+					if count == 0 {
+						id = id1
+						break
 					}
 				}
 
-				newExtra = append(newExtra, db.Extra{
-					Chinese:     entry,
-					Pinyin:      pinyin,
-					English:     english,
+				newQ = append(newQ, db.Quiz{
+					ID:          id,
+					UserID:      userID,
+					Entry:       entry,
 					Type:        subresult.Type,
+					Direction:   d,
+					Source:      subresult.Source,
 					Description: body.Description,
+					Tag:         body.Tag,
 				})
-			}
 
-			lookupDir := lookup[entry]
-			if lookupDir == nil {
-				lookupDir = map[string]db.Quiz{}
+				subresult.IDs = append(subresult.IDs, id)
+			} else {
+				subresult.IDs = append(subresult.IDs, lookupDir[d].ID)
 			}
+		}
 
-			for _, d := range directions {
-				if lookupDir[d].ID == "" {
-					id := ""
+		result = append(result, subresult)
+	}
 
-					for {
-						id1, err := nanoid.Nanoid(6)
-						if err != nil {
-							panic(err)
-						}
+	for _, it := range newExtra {
+		if e := it.Create(tx); e != nil {
+			return nil, e
+		}
+	}
 
-						var count int64
-						if r := resource.DB.Current.Model(db.Quiz{}).Where("id = ?", id1).Count(&count); r.Error != nil {
-							panic(err)
-						}
+	for _, it := range newQ {
+		if e := it.Create(tx); e != nil {
+			return nil, e
+		}
+	}
 
-						if count == 0 {
-							id = id1
-							break
-						}
-					}
+	return result, nil
+}
 
-					newQ = append(newQ, db.Quiz{
-						ID:          id,
-						Entry:       entry,
-						Type:        subresult.Type,
-						Direction:   d,
-						Source:      subresult.Source,
-						Description: body.Description,
-					})
+// quizSource checks if entry is in CEDICT, token or sentence table of zh.db;
+// or else, it is "extra". Also returns quiz directions available.
+func quizSource(entry string, qType string) (string, []string, error) {
+	source := ""
+	directions := []string{"se", "ec"}
+
+	switch qType {
+	case "vocab":
+		var items []zh.Vocab
+		if r := resource.Zh.Current.
+			Where("simplified = ? OR traditional = ?", entry, entry).
+			Find(&items); r.Error != nil {
+			return "", nil, r.Error
+		}
 
-					subresult.IDs = append(subresult.IDs, id)
-					ids = append(ids, id)
-				} else {
-					subresult.IDs = append(subresult.IDs, lookupDir[d].ID)
-					ids = append(ids, lookupDir[d].ID)
+		if len(items) > 0 {
+			for _, it := range items {
+				if len(directions) < 3 && it.Traditional != "" {
+					directions = append(directions, "te")
 				}
 			}
+		} else {
+			source = "extra"
 		}
-
-		e := resource.DB.Current.Transaction(func(tx *gorm.DB) error {
-			for _, it := range newExtra {
-				it.Create(tx)
-			}
-
-			for _, it := range newQ {
-				it.Create(tx)
+	case "hanzi":
+		if r := resource.Zh.Current.
+			Where("entry = ? AND length(entry) = 1 AND english IS NOT NULL", entry).
+			First(&zh.Token{}); r.Error != nil {
+			if !errors.Is(r.Error, gorm.ErrRecordNotFound) {
+				return "", nil, r.Error
 			}
-
-			return nil
-		})
-
-		if e != nil {
-			panic(e)
+			source = "extra"
 		}
-
-		ctx.JSON(201, gin.H{
-			"result": result,
-			"ids":    ids,
-		})
-	})
-
-	r.POST("/delete", func(ctx *gin.Context) {
-		var body struct {
-			IDs []string `json:"ids" binding:"required,min=1"`
-		}
-
-		if e := ctx.BindJSON(&body); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+	case "sentence":
+		if r := resource.Zh.Current.
+			Where("chinese = ?", entry).
+			First(&zh.Sentence{}); r.Error != nil {
+			if !errors.Is(r.Error, gorm.ErrRecordNotFound) {
+				return "", nil, r.Error
+			}
+			source = "extra"
 		}
+	}
 
-		e := resource.DB.Current.Transaction(func(tx *gorm.DB) error {
-			for _, id := range body.IDs {
-				q := db.Quiz{
-					ID: id,
-				}
+	return source, directions, nil
+}
 
-				if e := q.Delete(tx); e != nil {
-					return e
+// guessPinyinEnglish makes up pinyin and english from CEDICT, segment by segment
+func guessPinyinEnglish(entry string) (string, string, error) {
+	pSegs := make([]string, 0)
+	eSegs := make([]string, 0)
+	reHan := regexp.MustCompile(`\p{Han}+`)
+
+	for _, seg := range cutChinese(entry) {
+		if reHan.MatchString(seg) {
+			var vocab zh.Vocab
+			if r := resource.Zh.Current.Where("simplified = ? OR traditional = ?", seg, seg).Order("frequency DESC").First(&vocab); r.Error != nil {
+				if !errors.Is(r.Error, gorm.ErrRecordNotFound) {
+					return "", "", r.Error
 				}
 			}
 
-			return nil
-		})
-
-		if e != nil {
-			panic(e)
+			if vocab.English != "" {
+				pSegs = append(pSegs, vocab.Pinyin)
+				eSegs = append(eSegs, vocab.English)
+			} else {
+				pSegs = append(pSegs, seg)
+				eSegs = append(eSegs, seg)
+			}
+		} else {
+			pSegs = append(pSegs, seg)
+			eSegs = append(eSegs, seg)
 		}
+	}
 
-		ctx.JSON(201, gin.H{
-			"result": "deleted",
-		})
-	})
+	return strings.Join(pSegs, " "), strings.Join(eSegs, "; "), nil
 }
 
 type quizInitOutput struct {
@@ -696,7 +842,7 @@ type getterBody struct {
 	Select    []string `json:"select" binding:"required,min=1"`
 }
 
-func quizGetter(ctx *gin.Context, body getterBody) {
+func quizGetter(ctx *gin.Context, body getterBody) error {
 	sel := []string{}
 	sMap := map[string]string{
 		"id":        "quiz.id id",
@@ -714,8 +860,7 @@ func quizGetter(ctx *gin.Context, body getterBody) {
 	}
 
 	if len(sel) == 0 {
-		ctx.AbortWithError(400, fmt.Errorf("not enough select"))
-		return
+		return Validation(fmt.Errorf("not enough select"))
 	}
 
 	andWhere := make([]string, 0)
@@ -728,8 +873,7 @@ func quizGetter(ctx *gin.Context, body getterBody) {
 		andWhere = append(andWhere, "quiz.entry IN @entries")
 		cond["entries"] = body.Entries
 	} else {
-		ctx.AbortWithError(400, fmt.Errorf("either IDs or Entries must be specified"))
-		return
+		return Validation(fmt.Errorf("either IDs or Entries must be specified"))
 	}
 
 	if body.Type != "" {
@@ -749,21 +893,64 @@ func quizGetter(ctx *gin.Context, body getterBody) {
 
 	out := make([]map[string]interface{}, 0)
 
-	clause := resource.DB.Current.Model(&db.Quiz{}).
+	clause := resource.DB.Current().Model(&db.Quiz{}).
+		Scopes(db.OwnedBy(userID(ctx))).
 		Select(sel).
 		Where(strings.Join(andWhere, " AND "), cond)
 
 	if r := clause.Find(&out); r.Error != nil {
-		panic(r.Error)
+		return r.Error
 	}
 
 	ctx.JSON(200, gin.H{
 		"result": out,
 	})
+
+	return nil
+}
+
+// quizQuery filters quizzes by type, stage and direction, as in quiz settings.
+// Stage is new, learning or graduated; leeches are excluded unless in stage.
+func quizQuery(tx *gorm.DB, qType []string, stage []string, direction []string, q string) (*gorm.DB, error) {
+	out := tx.Model(&db.Quiz{})
+
+	if q != "" {
+		cond, e := qSearch(q)
+		if e != nil {
+			return nil, e
+		}
+		out = out.Where(cond)
+	}
+
+	var orCond []string
+
+	stageSet := util.MakeSet(stage)
+	if stageSet["new"] {
+		orCond = append(orCond, "srs_level IS NULL")
+	}
+
+	if stageSet["learning"] {
+		orCond = append(orCond, "srs_level < 3")
+	}
+
+	if stageSet["graduated"] {
+		orCond = append(orCond, "srs_level >= 3")
+	}
+
+	if len(orCond) > 0 {
+		out = out.Where(strings.Join(orCond, " OR "))
+	}
+
+	// NOT (wrong_streak > 2) would also exclude quizzes never marked, as NULL is not true
+	if !stageSet["leech"] {
+		out = out.Where("wrong_streak IS NULL OR wrong_streak < ?", db.LeechStreak)
+	}
+
+	return out.Where("[type] IN ? AND [direction] IN ?", qType, direction), nil
 }
 
-func qSearch(q string) *gorm.DB {
-	qBuilder := resource.DB.Current.Model(&db.Quiz{})
+func qSearch(q string) (*gorm.DB, error) {
+	qBuilder := resource.DB.Current().Model(&db.Quiz{})
 	segs := make([]string, 0)
 
 	reCmp := regexp.MustCompile(`([><]=?)(\d+)`)
@@ -787,14 +974,15 @@ func qSearch(q string) *gorm.DB {
 
 	level := ""
 	for _, seg := range strings.Split(q, " ") {
+		// Bare words, e.g. level, are searched for
 		kv := strings.SplitN(seg, ":", 2)
 
-		switch kv[0] {
-		case "srsLevel":
+		switch {
+		case len(kv) == 2 && kv[0] == "srsLevel":
 			if e := parseV("srs_level", kv[1], qBuilder); e != nil {
-				panic(e)
+				return nil, e
 			}
-		case "level":
+		case len(kv) == 2 && kv[0] == "level":
 			level = kv[1]
 		default:
 			if seg != "" {
@@ -806,15 +994,15 @@ func qSearch(q string) *gorm.DB {
 	if len(segs) > 0 {
 		qBuilder = qBuilder.Where(`id IN (
 			SELECT id FROM quiz_q WHERE quiz_q MATCH ?
-		)`, strings.Join(segs, " "))
+		)`, matchPinyin(strings.Join(segs, " "), "pinyin", false))
 	}
 
 	if level != "" {
-		orCond := resource.DB.Current
+		orCond := resource.DB.Current()
 
 		quizzes := make([]db.Quiz, 0)
 		if r := qBuilder.Find(&quizzes); r.Error != nil {
-			panic(r.Error)
+			return nil, r.Error
 		}
 
 		hanzis := make([]string, 0)
@@ -840,10 +1028,10 @@ func qSearch(q string) *gorm.DB {
 			ts := make([]zh.Token, 0)
 			tBuilder := resource.Zh.Current.Where("entry IN ?", hanzis)
 			if e := parseV("hanzi_level", level, tBuilder); e != nil {
-				panic(e)
+				return nil, e
 			}
 			if r := tBuilder.Find(&ts); r.Error != nil {
-				panic(r.Error)
+				return nil, r.Error
 			}
 			hanzis = []string{}
 			for _, t := range ts {
@@ -859,10 +1047,10 @@ func qSearch(q string) *gorm.DB {
 			ts := make([]zh.Token, 0)
 			tBuilder := resource.Zh.Current.Where("entry IN ?", vocabs)
 			if e := parseV("vocab_level", level, tBuilder); e != nil {
-				panic(e)
+				return nil, e
 			}
 			if r := tBuilder.Find(&ts); r.Error != nil {
-				panic(r.Error)
+				return nil, r.Error
 			}
 			vocabs = []string{}
 			for _, t := range ts {
@@ -878,10 +1066,10 @@ func qSearch(q string) *gorm.DB {
 			ts := make([]zh.Sentence, 0)
 			tBuilder := resource.Zh.Current.Where("chinese IN ?", sentences)
 			if e := parseV("level", level, tBuilder); e != nil {
-				panic(e)
+				return nil, e
 			}
 			if r := tBuilder.Find(&ts); r.Error != nil {
-				panic(r.Error)
+				return nil, r.Error
 			}
 			sentences = []string{}
 			for _, t := range ts {
@@ -896,5 +1084,5 @@ func qSearch(q string) *gorm.DB {
 		qBuilder = qBuilder.Where(orCond.Or("FALSE"))
 	}
 
-	return qBuilder
+	return qBuilder, nil
 }
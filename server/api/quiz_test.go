@@ -0,0 +1,208 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhquiz/go-zhquiz/server/db"
+	"github.com/zhquiz/go-zhquiz/shared"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// prepareTest makes resource in a temporary directory, with zh.db of 你好 only
+func prepareTest(t *testing.T) Resource {
+	dir, err := ioutil.TempDir("", "zhquiz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	if err := os.MkdirAll(filepath.Join(dir, "assets"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "assets", "dict.txt"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	zhDB, err := gorm.Open(sqlite.Open(filepath.Join(dir, "assets", "zh.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		"CREATE TABLE token (entry, pinyin, english, frequency, hanzi_level, vocab_level)",
+		"CREATE TABLE vocab (simplified, traditional, pinyin, english, frequency, source)",
+		"CREATE TABLE sentence (id, chinese, pinyin, english, frequency, level)",
+		"CREATE TABLE library (title, entries)",
+		"CREATE VIRTUAL TABLE token_q USING fts5(entry, pinyin, english, description, tag)",
+		"INSERT INTO token VALUES ('你好', 'ni3 hao3', 'hello', 1, NULL, 1)",
+		"INSERT INTO vocab VALUES ('你好', '你好', 'ni3 hao3', 'hello', 1, '')",
+	} {
+		if r := zhDB.Exec(stmt); r.Error != nil {
+			t.Fatal(r.Error)
+		}
+	}
+	if sqlDB, err := zhDB.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	shared.ExecDir = dir
+	os.Setenv("USER_DATA_DIR", dir)
+
+	res := Prepare()
+	t.Cleanup(res.Cleanup)
+
+	return res
+}
+
+func TestQSearch(t *testing.T) {
+	res := prepareTest(t)
+
+	q := db.Quiz{ID: "q1", Entry: "你好", Type: "vocab", Direction: "se", Source: "vocab"}
+	if err := q.Create(res.DB.Current()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		q    string
+		want int
+	}{
+		{"", 1},
+		{"srsLevel:>1", 0},
+		{"srsLevel:", 1},
+		{"level:", 1},
+		// Bare keys are words to search for
+		{"srsLevel", 0},
+		{"level", 0},
+		{"level 你好", 0},
+	} {
+		tx, err := qSearch(c.q)
+		if err != nil {
+			t.Errorf("%q: %v", c.q, err)
+			continue
+		}
+
+		var quizzes []db.Quiz
+		if r := tx.Find(&quizzes); r.Error != nil || len(quizzes) != c.want {
+			t.Errorf("%q found %d, not %d: %v", c.q, len(quizzes), c.want, r.Error)
+		}
+	}
+}
+
+func TestPageBounds(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	res := prepareTest(t)
+	r := gin.New()
+	res.Register(r, &Options{Token: "test"})
+
+	for _, path := range []string{"/api/quiz/history?", "/api/quiz/leech?order=desc&"} {
+		for _, c := range []struct {
+			query  string
+			status int
+		}{
+			{"", 200},
+			{"page=2&perPage=100", 200},
+			{"page=0", 400},
+			{"page=-1", 400},
+			{"perPage=0", 400},
+			{"perPage=101", 400},
+			{"perPage=abc", 400},
+		} {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", path+c.query, nil))
+
+			if w.Code != c.status {
+				t.Errorf("%s%s is %d, not %d: %s", path, c.query, w.Code, c.status, w.Body.String())
+			}
+		}
+	}
+}
+
+// Stats and /api/quiz/leech agree on leeches
+func TestLeech(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	res := prepareTest(t)
+	r := gin.New()
+	res.Register(r, &Options{Token: "test"})
+
+	for i, streak := range []uint{1, db.LeechStreak, db.LeechStreak + 1} {
+		s := streak
+		q := db.Quiz{Entry: "你好", Type: "vocab", Direction: []string{"se", "ec", "te"}[i], Source: "vocab", WrongStreak: &s}
+		if err := q.Create(res.DB.Current()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := res.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Leech != 2 {
+		t.Errorf("stats counted %d leeches, not 2", stats.Leech)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/quiz/leech?order=desc", nil))
+
+	var out struct {
+		Count int64 `json:"count"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil || out.Count != stats.Leech {
+		t.Errorf("/api/quiz/leech counted %d, not %d: %s", out.Count, stats.Leech, w.Body.String())
+	}
+}
+
+func TestQuizQueryLeech(t *testing.T) {
+	res := prepareTest(t)
+
+	streak := func(n uint) *uint { return &n }
+	level := func(n int8) *int8 { return &n }
+
+	for _, q := range []db.Quiz{
+		{ID: "new", Direction: "se"},
+		{ID: "right", Direction: "ec", SRSLevel: level(1), WrongStreak: streak(0)},
+		{ID: "wrong", Direction: "te", SRSLevel: level(0), WrongStreak: streak(1)},
+		{ID: "leech", Entry: "好", Direction: "se", SRSLevel: level(0), WrongStreak: streak(db.LeechStreak)},
+	} {
+		if q.Entry == "" {
+			q.Entry = "你好"
+		}
+		q.Type = "vocab"
+		q.Source = "vocab"
+
+		if err := q.Create(res.DB.Current()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, c := range []struct {
+		stage []string
+		want  []string
+	}{
+		{[]string{"new"}, []string{"new"}},
+		{[]string{"new", "learning"}, []string{"new", "right", "wrong"}},
+		{[]string{"learning", "leech"}, []string{"leech", "right", "wrong"}},
+		{[]string{"leech"}, []string{"leech", "new", "right", "wrong"}},
+	} {
+		tx, err := quizQuery(res.DB.Current(), []string{"vocab"}, c.stage, []string{"se", "ec", "te"}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []string
+		if r := tx.Order("id").Pluck("id", &ids); r.Error != nil {
+			t.Fatal(r.Error)
+		}
+		if !reflect.DeepEqual(ids, c.want) {
+			t.Errorf("%v found %v, not %v", c.stage, ids, c.want)
+		}
+	}
+}
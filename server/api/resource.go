@@ -0,0 +1,307 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/zhquiz/go-zhquiz/server/db"
+	"gorm.io/gorm"
+)
+
+// Methods of Resource are shared by API handlers and the command line,
+// which runs without the HTTP server.
+
+// As gets Resource acting on another profile
+func (res Resource) As(userID string) Resource {
+	res.UserID = userID
+	return res
+}
+
+func (res Resource) userID() string {
+	if res.UserID == "" {
+		return db.DefaultUserID
+	}
+
+	return res.UserID
+}
+
+// User loads the profile acted on
+func (res Resource) User() (*db.User, error) {
+	var user db.User
+	if r := res.DB.Current().Where("id = ?", res.userID()).First(&user); r.Error != nil {
+		return nil, r.Error
+	}
+
+	return &user, nil
+}
+
+// AddQuizzes creates quizzes for all directions of entries
+func (res Resource) AddQuizzes(entries []string, qType string) ([]QuizAddResult, error) {
+	body := quizAddBody{
+		Entries: entries,
+		Type:    qType,
+	}
+
+	if e := binding.Validator.ValidateStruct(body); e != nil {
+		return nil, Validation(e)
+	}
+
+	var result []QuizAddResult
+
+	e := res.DB.Current().Transaction(func(tx *gorm.DB) error {
+		r, e := addQuizzes(tx, res.userID(), body)
+		result = r
+		return e
+	})
+
+	return result, e
+}
+
+// MarkQuiz records an answer, and reschedules the quiz, with the user's scheduler
+func (res Resource) MarkQuiz(id string, g db.Grade, latency *uint) error {
+	user, e := res.User()
+	if e != nil {
+		return e
+	}
+
+	return res.DB.Current().Transaction(func(tx *gorm.DB) error {
+		var quiz db.Quiz
+		if r := tx.
+			Scopes(db.OwnedBy(user.ID)).
+			Where("id = ?", id).
+			First(&quiz); r.Error != nil {
+			return r.Error
+		}
+
+		return quiz.Mark(tx, db.NewScheduler(user.Meta), g, latency)
+	})
+}
+
+// DueQuizzes gets quizzes due now, in random order. Empty filters default to the user's quiz settings.
+func (res Resource) DueQuizzes(qType []string, stage []string, direction []string, q string) ([]db.Quiz, error) {
+	user, e := res.User()
+	if e != nil {
+		return nil, e
+	}
+
+	settings := user.Meta.Settings.Quiz
+
+	if len(qType) == 0 {
+		qType = settings.Type
+	}
+	if len(qType) == 0 {
+		qType = []string{"hanzi", "vocab", "sentence"}
+	}
+
+	if len(stage) == 0 {
+		stage = settings.Stage
+	}
+
+	if len(direction) == 0 {
+		direction = settings.Direction
+	}
+	if len(direction) == 0 {
+		direction = []string{"se", "ec", "te"}
+	}
+
+	if q == "" {
+		q = settings.Q
+	}
+
+	cond, e := quizQuery(res.DB.Current().Scopes(db.OwnedBy(user.ID)), qType, stage, direction, q)
+	if e != nil {
+		return nil, e
+	}
+
+	var quizzes []db.Quiz
+	if r := cond.Find(&quizzes); r.Error != nil {
+		return nil, r.Error
+	}
+
+	now := time.Now()
+	out := make([]db.Quiz, 0)
+
+	for _, it := range quizzes {
+		if it.NextReview == nil || it.NextReview.Before(now) {
+			out = append(out, it)
+		}
+	}
+
+	rand.Seed(now.UnixNano())
+	rand.Shuffle(len(out), func(i, j int) {
+		out[i], out[j] = out[j], out[i]
+	})
+
+	return out, nil
+}
+
+// QuizStats counts quizzes by type and stage
+type QuizStats struct {
+	Type      map[string]int64 `json:"type"`
+	Total     int64            `json:"total"`
+	New       int64            `json:"new"`
+	Learning  int64            `json:"learning"`
+	Graduated int64            `json:"graduated"`
+	Leech     int64            `json:"leech"`
+	Due       int64            `json:"due"`
+	// ReviewedToday counts marks since midnight, in local time
+	ReviewedToday int64 `json:"reviewedToday"`
+}
+
+// Stats counts quizzes by type and stage, and reviews done today
+func (res Resource) Stats() (*QuizStats, error) {
+	out := QuizStats{
+		Type: map[string]int64{},
+	}
+
+	var quizzes []db.Quiz
+	if r := res.DB.Current().
+		Scopes(db.OwnedBy(res.userID())).
+		Select("type", "srs_level", "next_review", "wrong_streak").
+		Find(&quizzes); r.Error != nil {
+		return nil, r.Error
+	}
+
+	now := time.Now()
+
+	for _, it := range quizzes {
+		out.Total++
+		out.Type[it.Type]++
+
+		if it.SRSLevel == nil {
+			out.New++
+		} else if *it.SRSLevel < 3 {
+			out.Learning++
+		} else {
+			out.Graduated++
+		}
+
+		if it.WrongStreak != nil && *it.WrongStreak >= db.LeechStreak {
+			out.Leech++
+		}
+
+		if it.NextReview == nil || it.NextReview.Before(now) {
+			out.Due++
+		}
+	}
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if r := res.DB.Current().
+		Model(&db.ReviewLog{}).
+		Where("created_at >= ?", midnight).
+		Where("quiz_id IN (SELECT id FROM quiz WHERE user_id = ?)", res.userID()).
+		Count(&out.ReviewedToday); r.Error != nil {
+		return nil, r.Error
+	}
+
+	return &out, nil
+}
+
+// ExportQuizzes writes quizzes matching q for Anki, as apkg, tsv or csv
+func (res Resource) ExportQuizzes(w io.Writer, format string, q string) error {
+	cond := res.DB.Current().Model(&db.Quiz{}).Scopes(db.OwnedBy(res.userID()))
+
+	if q != "" {
+		c, e := qSearch(q)
+		if e != nil {
+			return e
+		}
+		cond = cond.Where(c)
+	}
+
+	var quizzes []db.Quiz
+
+	if r := cond.Order("created_at").Find(&quizzes); r.Error != nil {
+		return r.Error
+	}
+
+	cards, e := quizCards(res.DB.Current(), quizzes)
+	if e != nil {
+		return e
+	}
+
+	switch format {
+	case "apkg":
+		return writeQuizApkg(w, cards)
+	case "tsv":
+		return writeQuizTSV(w, cards)
+	case "csv":
+		return writeQuizCSV(w, cards)
+	}
+
+	return Validation(fmt.Errorf("unknown format: %s", format))
+}
+
+// ExportDump writes all user data, as JSON to be imported by POST /api/import
+func (res Resource) ExportDump() (*db.Dump, error) {
+	var out *db.Dump
+
+	e := res.DB.Current().Transaction(func(tx *gorm.DB) error {
+		d, e := db.Export(tx, res.userID())
+		out = d
+		return e
+	})
+
+	return out, e
+}
+
+// Fsck verifies FTS tables of all profiles, and if repair, rebuilds them after backing up, if there are issues.
+// After is nil, unless rebuilt.
+func (res Resource) Fsck(repair bool) (before *db.VerifyResult, after *db.VerifyResult, err error) {
+	before, err = db.Verify(res.DB.Current())
+	if err != nil || !repair || before.OK() {
+		return
+	}
+
+	if _, e := res.DB.Backup("fsck"); e != nil {
+		return before, nil, fmt.Errorf("cannot back up before repair: %w", e)
+	}
+
+	err = res.DB.Current().Transaction(func(tx *gorm.DB) error {
+		if e := db.RebuildFTS(tx); e != nil {
+			return e
+		}
+
+		r, e := db.Verify(tx)
+		after = r
+		return e
+	})
+
+	return
+}
+
+// SearchVocab searches CEDICT by simplified or traditional, or else by pinyin or english
+func (res Resource) SearchVocab(q string, limit int) ([]VocabResult, error) {
+	if q == "" {
+		return nil, Validation(errors.New("nothing to search"))
+	}
+
+	result := make([]VocabResult, 0)
+
+	where := "simplified LIKE @q OR traditional LIKE @q"
+	cond := map[string]interface{}{
+		"q": "%" + q + "%",
+	}
+
+	if regexp.MustCompile(`^[^\p{Han}]+$`).MatchString(q) {
+		cond["q"] = matchPinyin(q, "pinyin", true)
+		where = "simplified IN (SELECT entry FROM token_q WHERE token_q MATCH @q)"
+	}
+
+	if r := res.Zh.Current.Raw(fmt.Sprintf(`
+	SELECT Simplified, Traditional, vocab.Pinyin, vocab.English
+	FROM vocab
+	WHERE %s
+	ORDER BY frequency DESC
+	LIMIT %d
+	`, where, limit), cond).Find(&result); r.Error != nil {
+		return nil, r.Error
+	}
+
+	return result, nil
+}
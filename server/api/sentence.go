@@ -1,77 +1,79 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log"
 	"math/rand"
-	"net/http"
-	"net/url"
-	"regexp"
+	"mime/multipart"
 	"strconv"
-	"strings"
 	"time"
 
-	"github.com/PuerkitoBio/goquery"
 	"github.com/gin-gonic/gin"
 	"github.com/zhquiz/go-zhquiz/server/db"
+	"github.com/zhquiz/go-zhquiz/server/sentence"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 func routerSentence(apiRouter *gin.RouterGroup) {
 	r := apiRouter.Group("/sentence")
 
-	r.GET("/", func(ctx *gin.Context) {
-		var query struct {
-			Entry string `form:"entry" binding:"required"`
-		}
+	cache := sentence.Cache{DB: &resource.DB}
 
-		if e := ctx.BindQuery(&query); e != nil {
-			ctx.AbortWithError(400, e)
-			return
-		}
+	providers := map[string]sentence.Provider{
+		"tatoeba": sentence.Limit(sentence.Tatoeba{DB: &resource.Zh}, 5*time.Second, 0),
+		"cache":   sentence.Limit(cache, 5*time.Second, 0),
+		"corpus": sentence.Limit(&sentence.Corpus{Path: func(c context.Context) string {
+			user, e := resource.As(profileOf(c)).User()
+			if e != nil {
+				return ""
+			}
+			return user.Meta.Settings.Sentence.Corpus
+		}}, 5*time.Second, 0),
+		"jukuu": sentence.Limit(sentence.Saved{Provider: sentence.Jukuu{}, Cache: cache}, 10*time.Second, time.Second),
+	}
+
+	r.GET("/", wrap(func(ctx *gin.Context) error {
+		var query romanizedEntryQuery
 
-		type Result struct {
-			Chinese string `json:"chinese"`
-			English string `json:"english"`
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
-		var result Result
+
+		var result sentenceResult
 
 		if r := resource.Zh.Current.Raw(`
-		SELECT Chinese, English
+		SELECT Chinese, Pinyin, English
 		FROM sentence
 		WHERE chinese = ?
 		`, query.Entry).First(&result); r.Error != nil {
 			if errors.Is(r.Error, gorm.ErrRecordNotFound) {
-				ctx.AbortWithStatus(404)
-				return
+				return NotFound(errors.New("not found"))
 			}
 
-			panic(r.Error)
+			return r.Error
 		}
 
+		result.Romanization = query.romanize(result.Pinyin)
+
 		ctx.JSON(200, result)
-	})
+		return nil
+	}))
 
-	r.GET("/q", func(ctx *gin.Context) {
-		var query struct {
-			Q        string  `form:"q"`
-			Page     *string `form:"page"`
-			PerPage  *string `form:"perPage"`
-			Generate *string `form:"generate"`
-		}
+	r.GET("/q", wrap(func(ctx *gin.Context) error {
+		var query sentenceListQuery
 
-		if e := ctx.BindQuery(&query); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
 		page := 0
 		if query.Page != nil {
 			i, err := strconv.Atoi(*query.Page)
-			if err != nil {
-				ctx.AbortWithError(400, errors.New("page must be int"))
-				return
+			if err != nil || i < 0 {
+				return Validation(errors.New("page must be non-negative int"))
 			}
 			page = i
 		}
@@ -80,9 +82,8 @@ func routerSentence(apiRouter *gin.RouterGroup) {
 		perPage := 5
 		if query.PerPage != nil {
 			i, err := strconv.Atoi(*query.PerPage)
-			if err != nil {
-				ctx.AbortWithError(400, errors.New("perPage must be int"))
-				return
+			if err != nil || i < 0 {
+				return Validation(errors.New("perPage must be non-negative int"))
 			}
 			perPage = i
 			isCount = true
@@ -92,23 +93,24 @@ func routerSentence(apiRouter *gin.RouterGroup) {
 		if query.Generate != nil {
 			i, err := strconv.Atoi(*query.Generate)
 			if err != nil {
-				ctx.AbortWithError(400, errors.New("generate must be int"))
-				return
+				return Validation(errors.New("generate must be int"))
 			}
 			generate = i
 		}
 
-		var user db.User
-		if r := resource.DB.Current.First(&user); r.Error != nil {
-			panic(r.Error)
+		user, e := current(ctx).User()
+		if e != nil {
+			return e
 		}
-		levelMin := *user.Meta.LevelMin
-		if levelMin == 0 {
-			levelMin = 1
+
+		// New profiles have no levels yet
+		var levelMin uint = 1
+		if user.Meta.LevelMin != nil && *user.Meta.LevelMin != 0 {
+			levelMin = *user.Meta.LevelMin
 		}
-		levelMax := *user.Meta.Level
-		if levelMax == 0 {
-			levelMax = 60
+		var levelMax uint = 60
+		if user.Meta.Level != nil && *user.Meta.Level != 0 {
+			levelMax = *user.Meta.Level
 		}
 
 		var sentenceMin uint = 0
@@ -121,187 +123,145 @@ func routerSentence(apiRouter *gin.RouterGroup) {
 			sentenceMax = *user.Meta.Settings.Sentence.Max
 		}
 
-		type Result struct {
-			ID      int64  `json:"-"`
-			Chinese string `json:"chinese"`
-			English string `json:"english"`
+		if generate < perPage {
+			generate = perPage
 		}
-		result := make([]Result, 0)
 
-		andCond := []string{
-			"[level] >= @levelMin",
-			"[level] <= @levelMax",
+		q := sentence.Query{
+			Q:         query.Q,
+			LevelMin:  levelMin,
+			LevelMax:  levelMax,
+			LengthMin: sentenceMin,
+			LengthMax: sentenceMax,
+			Limit:     generate,
+			Random:    page == 0,
 		}
 
-		cond := map[string]interface{}{
-			"q":           query.Q,
-			"levelMin":    levelMin,
-			"levelMax":    levelMax,
-			"sentenceMin": sentenceMin,
-			"sentenceMax": sentenceMax,
-		}
-
-		if query.Q != "" {
-			if regexp.MustCompile(`\p{Han}`).MatchString(query.Q) {
-				cond["q"] = "%" + string(regexp.MustCompile(`[^\p{Han}]+`).ReplaceAll([]byte(query.Q), []byte("%"))) + "%"
-				andCond = append(andCond, "chinese LIKE @q")
-			} else {
-				andCond = append(andCond, `id IN (
-					SELECT id FROM sentence_q WHERE sentence_q MATCH @q
-				)`)
-			}
-		} else {
-			if sentenceMin != 0 {
-				andCond = append(andCond, "length(chinese) >= @sentenceMin")
-			}
+		if page != 0 {
+			q.Offset = (page - 1) * perPage
+		}
+
+		priority := user.Meta.Settings.Sentence.Providers
+		if len(priority) == 0 {
+			priority = sentence.DefaultPriority
+		}
 
-			if sentenceMax != 0 {
-				andCond = append(andCond, "length(chinese) <= @sentenceMax")
+		ps := make([]sentence.Provider, 0)
+		for _, name := range priority {
+			if p := providers[name]; p != nil {
+				ps = append(ps, p)
 			}
 		}
 
-		order := "ORDER BY RANDOM()"
-		if page != 0 {
-			order = fmt.Sprintf(`
-			ORDER BY level, frequency DESC
-			LIMIT %d OFFSET %d
-			`, perPage, (page-1)*perPage)
+		// Counting needs all merged results, as providers may have the same sentences
+		sq := q
+		if isCount {
+			sq.Offset, sq.Limit = 0, 0
 		}
 
-		if r := resource.Zh.Current.Raw(fmt.Sprintf(`
-		SELECT ID, Chinese, English
-		FROM sentence
-		WHERE %s
-		%s
-		`, strings.Join(andCond, " AND "), order), cond).Find(&result); r.Error != nil {
-			panic(r.Error)
+		result, errs := sentence.Search(ctx.Request.Context(), ps, sq)
+		for _, e := range errs {
+			log.Printf("sentence provider failed: %v\n", e)
 		}
 
-		for i, it := range result {
-			result[i].English = strings.Split(it.English, "\u001f")[0]
+		if len(result) == 0 && len(errs) > 0 {
+			return Upstream(errs[0])
 		}
 
-		out := struct {
-			Result []Result `json:"result"`
-			Count  *int     `json:"count"`
-		}{
+		out := sentenceListResult{
 			Result: result,
 		}
 
 		if isCount {
-			var count int
-			if r := resource.Zh.Current.Raw(fmt.Sprintf(`
-			SELECT COUNT(*)
-			FROM sentence
-			WHERE %s
-			`, strings.Join(andCond, " AND ")), cond).Scan(&count); r.Error != nil {
-				panic(r.Error)
-			}
+			count := len(result)
 			out.Count = &count
+			out.Result = sentence.Page(result, q.Offset, q.Limit)
 		}
 
-		if generate < perPage {
-			generate = perPage
+		ctx.JSON(200, out)
+		return nil
+	}))
+
+	r.POST("/import", wrap(func(ctx *gin.Context) error {
+		var query sentenceImportQuery
+
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
-		if len(out.Result) <= generate {
-			var dbSentences []db.Sentence
-			if r := resource.DB.Current.Where("chinese LIKE ?", cond["q"]).Limit(generate - len(out.Result)).Order("RANDOM()").Find(&dbSentences); r.Error != nil {
-				panic(r.Error)
-			}
+		var form sentenceImportForm
 
-			for _, s := range dbSentences {
-				out.Result = append(out.Result, Result{
-					Chinese: s.Chinese,
-					English: s.English,
-				})
-			}
+		if e := ctx.ShouldBind(&form); e != nil {
+			return Validation(e)
+		}
 
-			if len(out.Result) <= generate {
-				func() {
-					resp, err := http.Get(fmt.Sprintf("http://www.jukuu.com/search.php?q=%s", url.QueryEscape(query.Q)))
-					if err != nil {
-						return
-					}
-
-					doc, err := goquery.NewDocumentFromReader(resp.Body)
-					if err != nil {
-						return
-					}
-
-					moreResult := make([]Result, generate)
-
-					doc.Find("table tr.c td:last-child").Each(func(i int, item *goquery.Selection) {
-						if i < len(moreResult) {
-							moreResult[i].Chinese = item.Text()
-						}
-					})
-
-					doc.Find("table tr.e td:last-child").Each(func(i int, item *goquery.Selection) {
-						if i < len(moreResult) {
-							moreResult[i].English = item.Text()
-						}
-					})
-
-					var dbSentences []db.Sentence
-
-					for _, r := range moreResult {
-						if r.Chinese != "" {
-							dbSentences = append(dbSentences, db.Sentence{
-								Chinese: r.Chinese,
-								English: r.English,
-							})
-						}
-					}
-
-					if len(dbSentences) > 0 {
-						if r := resource.DB.Current.Clauses(clause.OnConflict{
-							DoNothing: true,
-						}).Create(dbSentences); r.Error != nil {
-							panic(r.Error)
-						}
-					}
-
-					if r := resource.DB.Current.Where("chinese LIKE ?", cond["q"]).Limit(generate - len(out.Result)).Order("RANDOM()").Find(&dbSentences); r.Error != nil {
-						panic(r.Error)
-					}
-
-					for _, s := range dbSentences {
-						out.Result = append(out.Result, Result{
-							Chinese: s.Chinese,
-							English: s.English,
-						})
-					}
-				}()
-			}
+		fh := form.File
+
+		f, e := fh.Open()
+		if e != nil {
+			return e
+		}
+		defer f.Close()
+
+		var ss []sentence.Sentence
 
-			if len(out.Result) > generate {
-				var newResult []Result
-				for _, r := range out.Result {
-					if len(newResult) < generate {
-						newResult = append(newResult, r)
-					}
+		switch query.Format {
+		case "tatoeba":
+			ss, e = sentence.ParseTatoeba(f)
+		case "srt":
+			var english io.Reader
+			if form.English != nil {
+				enF, err := form.English.Open()
+				if err != nil {
+					return err
 				}
-				out.Result = newResult
+				defer enF.Close()
+				english = enF
 			}
+
+			ss, e = sentence.ParseSRT(f, english)
+		default:
+			ss, e = sentence.ParseTSV(f)
 		}
 
-		if out.Result == nil {
-			out.Result = make([]Result, 0)
+		if e != nil {
+			return Validation(fmt.Errorf("cannot parse %s: %w", fh.Filename, e))
 		}
 
-		ctx.JSON(200, out)
-	})
+		dbSentences := make([]db.Sentence, 0)
+		for _, s := range ss {
+			dbSentences = append(dbSentences, db.Sentence{
+				Chinese: s.Chinese,
+				English: s.English,
+			})
+		}
+
+		var created int
 
-	r.GET("/random", func(ctx *gin.Context) {
-		var query struct {
-			Level    string `form:"level"`
-			LevelMin string `form:"levelMin"`
+		if _, e := resource.DB.Backup("import"); e != nil {
+			return fmt.Errorf("cannot back up before import: %w", e)
 		}
 
-		if e := ctx.BindQuery(&query); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		if e := resource.DB.Current().Transaction(func(tx *gorm.DB) error {
+			n, e := db.CreateSentences(tx, dbSentences)
+			created = n
+			return e
+		}); e != nil {
+			return e
+		}
+
+		ctx.JSON(201, gin.H{
+			"created": created,
+			"skipped": len(dbSentences) - created,
+		})
+		return nil
+	}))
+
+	r.GET("/random", wrap(func(ctx *gin.Context) error {
+		var query sentenceRandomQuery
+
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
 		level := 60
@@ -309,8 +269,7 @@ func routerSentence(apiRouter *gin.RouterGroup) {
 		if query.Level != "" {
 			v, e := strconv.Atoi(query.Level)
 			if e != nil {
-				ctx.AbortWithError(400, e)
-				return
+				return Validation(e)
 			}
 			level = v
 		}
@@ -320,16 +279,14 @@ func routerSentence(apiRouter *gin.RouterGroup) {
 		if query.LevelMin != "" {
 			v, e := strconv.Atoi(query.LevelMin)
 			if e != nil {
-				ctx.AbortWithError(400, e)
-				return
+				return Validation(e)
 			}
 			levelMin = v
 		}
 
-		var dbUser db.User
-
-		if r := resource.DB.Current.Select("Meta").First(&dbUser); r.Error != nil {
-			panic(r.Error)
+		dbUser, e := current(ctx).User()
+		if e != nil {
+			return e
 		}
 
 		where := "[type] = @type AND srs_level IS NOT NULL AND next_review IS NOT NULL"
@@ -348,10 +305,11 @@ func routerSentence(apiRouter *gin.RouterGroup) {
 		}
 
 		var existing []db.Quiz
-		if r := resource.DB.Current.
+		if r := resource.DB.Current().
+			Scopes(db.OwnedBy(dbUser.ID)).
 			Where(where, cond).
 			Find(&existing); r.Error != nil {
-			panic(r.Error)
+			return r.Error
 		}
 
 		var entries []interface{}
@@ -380,42 +338,83 @@ func routerSentence(apiRouter *gin.RouterGroup) {
 			where = "chinese NOT IN @entries AND " + where
 		}
 
-		type Result struct {
-			ID      int64   `json:"-"`
-			Result  string  `json:"result"`
-			English string  `json:"english"`
-			Level   float64 `json:"level"`
-		}
-		var result []Result
+		var result []sentenceRandomResult
 
 		if r := resource.Zh.Current.Raw(fmt.Sprintf(`
-		SELECT ID, chinese Result, Level, English
+		SELECT ID, chinese Result, Pinyin, Level, English
 		FROM sentence
 		WHERE %s
 		`, where), cond).Find(&result); r.Error != nil {
-			panic(r.Error)
+			return r.Error
 		}
 
 		if len(result) < 1 {
-			result = []Result{}
+			result = []sentenceRandomResult{}
 
 			if r := resource.Zh.Current.Raw(fmt.Sprintf(`
-			SELECT ID, chinese Result, Level
+			SELECT ID, chinese Result, Pinyin, Level
 			FROM sentence
 			WHERE %s
 			`, where), cond).Find(&result); r.Error != nil {
-				panic(r.Error)
+				return r.Error
 			}
 		}
 
 		if len(result) < 1 {
-			ctx.AbortWithError(404, fmt.Errorf("no matching entries found"))
-			return
+			return NotFound(fmt.Errorf("no matching entries found"))
 		}
 
 		rand.Seed(time.Now().UnixNano())
 		r := result[rand.Intn(len(result))]
+		r.Romanization = query.romanize(r.Pinyin)
 
 		ctx.JSON(200, r)
-	})
+		return nil
+	}))
+}
+
+type sentenceResult struct {
+	Chinese string `json:"chinese"`
+	Pinyin  string `json:"-"`
+	English string `json:"english"`
+	// Romanization is Pinyin, converted as requested by ?romanization=
+	Romanization string `json:"romanization,omitempty"`
+}
+
+type sentenceListResult struct {
+	Result []sentence.Sentence `json:"result"`
+	Count  *int                `json:"count"`
+}
+
+type sentenceRandomResult struct {
+	ID      int64   `json:"-"`
+	Result  string  `json:"result"`
+	Pinyin  string  `json:"-"`
+	English string  `json:"english"`
+	Level   float64 `json:"level"`
+	// Romanization is Pinyin, converted as requested by ?romanization=
+	Romanization string `json:"romanization,omitempty"`
+}
+
+type sentenceListQuery struct {
+	Q        string  `form:"q"`
+	Page     *string `form:"page"`
+	PerPage  *string `form:"perPage"`
+	Generate *string `form:"generate"`
+}
+
+type sentenceImportQuery struct {
+	Format string `form:"format" binding:"required,oneof=tsv tatoeba srt"`
+}
+
+type sentenceImportForm struct {
+	File *multipart.FileHeader `form:"file" binding:"required"`
+	// English is the translated subtitles, for srt
+	English *multipart.FileHeader `form:"english"`
+}
+
+type sentenceRandomQuery struct {
+	Level    string `form:"level"`
+	LevelMin string `form:"levelMin"`
+	romanizationQuery
 }
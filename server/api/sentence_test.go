@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhquiz/go-zhquiz/server/db"
+)
+
+// TestSentencePages pages through sentences of providers with the same sentences
+func TestSentencePages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	res := prepareTest(t)
+	r := gin.New()
+	res.Register(r, &Options{Token: "test"})
+
+	for _, stmt := range []string{
+		"INSERT INTO sentence VALUES (1, '你好', 'ni3 hao3', 'hello', 2, 1)",
+		"INSERT INTO sentence VALUES (2, '你好呀', 'ni3 hao3 ya5', 'hi', 1, 2)",
+	} {
+		if r := res.Zh.Current.Exec(stmt); r.Error != nil {
+			t.Fatal(r.Error)
+		}
+	}
+
+	if _, err := db.CreateSentences(res.DB.Current(), []db.Sentence{
+		{Chinese: "你好", English: "hello"},
+		{Chinese: "你好吗", English: "how are you"},
+		{Chinese: "好久", English: "long time"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without jukuu, which is online
+	req := httptest.NewRequest("PATCH", "/api/user/", strings.NewReader(`{"settings.sentence.providers": ["tatoeba", "cache"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(CSRFHeader, "test")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != 201 {
+		t.Fatalf("%d: %s", w.Code, w.Body.String())
+	}
+
+	seen := map[string]int{}
+
+	for page, want := range []int{3, 1, 0} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/api/sentence/q?q=%%E5%%A5%%BD&page=%d&perPage=3", page+1), nil))
+		if w.Code != 200 {
+			t.Fatalf("page %d is %d: %s", page+1, w.Code, w.Body.String())
+		}
+
+		var out sentenceListResult
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+
+		if out.Count == nil {
+			t.Errorf("page %d is not counted", page+1)
+		} else if *out.Count != 4 {
+			t.Errorf("page %d counts %d, not 4", page+1, *out.Count)
+		}
+
+		if len(out.Result) != want {
+			t.Errorf("page %d has %d sentences, not %d: %v", page+1, len(out.Result), want, out.Result)
+		}
+
+		for _, s := range out.Result {
+			seen[s.Chinese]++
+		}
+	}
+
+	for _, c := range []string{"你好", "你好呀", "你好吗", "好久"} {
+		if seen[c] != 1 {
+			t.Errorf("%s is on %d pages", c, seen[c])
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/sentence/q?q=%E5%A5%BD&page=-1&perPage=3", nil))
+	if w.Code != 400 {
+		t.Errorf("negative page is %d", w.Code)
+	}
+}
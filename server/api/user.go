@@ -7,31 +7,35 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/zhquiz/go-zhquiz/server/db"
+	"github.com/zhquiz/go-zhquiz/server/sentence"
+	"github.com/zhquiz/go-zhquiz/server/tts"
 )
 
 func routerUser(apiRouter *gin.RouterGroup) {
 	r := apiRouter.Group("/user")
 
-	r.GET("/", func(ctx *gin.Context) {
-		var query struct {
-			Select string `form:"select" binding:"required"`
-		}
+	r.GET("/", wrap(func(ctx *gin.Context) error {
+		var query userQuery
 
-		if e := ctx.BindQuery(&query); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
 		qSel := strings.Split(query.Select, ",")
 		sel := []string{}
 		sMap := map[string]string{
-			"level":                     "json_extract(meta, '$.level') [level]",
-			"levelMin":                  "json_extract(meta, '$.levelMin') levelMin",
-			"forvo":                     "json_extract(meta, '$.forvo') forvo",
-			"settings.quiz":             "json_extract(meta, '$.settings.quiz') [settings.quiz]",
-			"settings.level.whatToShow": "json_extract(meta, '$.settings.level.whatToShow') [settings.level.whatToShow]",
-			"settings.sentence.min":     "json_extract(meta, '$.settings.sentence.min') [settings.sentence.min]",
-			"settings.sentence.max":     "json_extract(meta, '$.settings.sentence.max') [settings.sentence.max]",
+			"level":                       "json_extract(meta, '$.level') [level]",
+			"levelMin":                    "json_extract(meta, '$.levelMin') levelMin",
+			"forvo":                       "json_extract(meta, '$.forvo') forvo",
+			"settings.quiz":               "json_extract(meta, '$.settings.quiz') [settings.quiz]",
+			"settings.quiz.scheduler":     "json_extract(meta, '$.settings.quiz.scheduler') [settings.quiz.scheduler]",
+			"settings.quiz.fsrs":          "json_extract(meta, '$.settings.quiz.fsrs') [settings.quiz.fsrs]",
+			"settings.level.whatToShow":   "json_extract(meta, '$.settings.level.whatToShow') [settings.level.whatToShow]",
+			"settings.sentence.min":       "json_extract(meta, '$.settings.sentence.min') [settings.sentence.min]",
+			"settings.sentence.max":       "json_extract(meta, '$.settings.sentence.max') [settings.sentence.max]",
+			"settings.sentence.providers": "json_extract(meta, '$.settings.sentence.providers') [settings.sentence.providers]",
+			"settings.sentence.corpus":    "json_extract(meta, '$.settings.sentence.corpus') [settings.sentence.corpus]",
+			"settings.tts":                "json_extract(meta, '$.settings.tts') [settings.tts]",
 		}
 
 		for _, s := range qSel {
@@ -42,14 +46,16 @@ func routerUser(apiRouter *gin.RouterGroup) {
 		}
 
 		if len(sel) == 0 {
-			ctx.AbortWithError(400, fmt.Errorf("nothing to select"))
-			return
+			return Validation(fmt.Errorf("nothing to select"))
 		}
 
 		getter := map[string]interface{}{}
 
-		if r := resource.DB.Current.Model(&db.User{}).Select(strings.Join(sel, ",")).First(&getter); r.Error != nil {
-			panic(r.Error)
+		if r := resource.DB.Current().Model(&db.User{}).
+			Where("id = ?", userID(ctx)).
+			Select(strings.Join(sel, ",")).
+			First(&getter); r.Error != nil {
+			return r.Error
 		}
 
 		out := map[string]interface{}{}
@@ -68,26 +74,19 @@ func routerUser(apiRouter *gin.RouterGroup) {
 		}
 
 		ctx.JSON(200, out)
-	})
+		return nil
+	}))
 
-	r.PATCH("/", func(ctx *gin.Context) {
-		var body struct {
-			LevelMin    *uint  `json:"levelMin"`
-			Level       *uint  `json:"level"`
-			SentenceMin *uint  `json:"sentenceMin"`
-			SentenceMax *uint  `json:"sentenceMax"`
-			WhatToShow  string `json:"settings.level.whatToShow"`
-		}
+	r.PATCH("/", wrap(func(ctx *gin.Context) error {
+		var body userUpdateBody
 
-		if e := ctx.BindJSON(&body); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		if e := ctx.ShouldBindJSON(&body); e != nil {
+			return Validation(e)
 		}
 
-		var dbUser db.User
-
-		if r := resource.DB.Current.First(&dbUser); r.Error != nil {
-			panic(r.Error)
+		dbUser, e := current(ctx).User()
+		if e != nil {
+			return e
 		}
 
 		if body.Level != nil {
@@ -114,12 +113,60 @@ func routerUser(apiRouter *gin.RouterGroup) {
 			dbUser.Meta.Settings.Level.WhatToShow = body.WhatToShow
 		}
 
-		if r := resource.DB.Current.Save(&dbUser); r.Error != nil {
-			panic(r.Error)
+		if body.Scheduler != "" {
+			dbUser.Meta.Settings.Quiz.Scheduler = body.Scheduler
+		}
+
+		if body.FSRS != nil {
+			dbUser.Meta.Settings.Quiz.FSRS = *body.FSRS
+		}
+
+		if body.Providers != nil {
+			dbUser.Meta.Settings.Sentence.Providers = body.Providers
+		}
+
+		if body.Corpus != nil {
+			if *body.Corpus != "" {
+				if _, e := sentence.CorpusPath(*body.Corpus); e != nil {
+					return Validation(e)
+				}
+			}
+
+			dbUser.Meta.Settings.Sentence.Corpus = *body.Corpus
+		}
+
+		if body.TTS != nil {
+			if p := body.TTS.Provider; p != "" && p != "local" && p != "google" {
+				return Validation(fmt.Errorf("unknown tts provider: %s", p))
+			}
+
+			dbUser.Meta.Settings.TTS = *body.TTS
+		}
+
+		if r := resource.DB.Current().Save(dbUser); r.Error != nil {
+			return r.Error
 		}
 
 		ctx.JSON(201, gin.H{
 			"result": "updated",
 		})
-	})
+		return nil
+	}))
+}
+
+type userQuery struct {
+	Select string `form:"select" binding:"required"`
+}
+
+type userUpdateBody struct {
+	LevelMin    *uint            `json:"levelMin"`
+	Level       *uint            `json:"level"`
+	SentenceMin *uint            `json:"sentenceMin"`
+	SentenceMax *uint            `json:"sentenceMax"`
+	WhatToShow  string           `json:"settings.level.whatToShow"`
+	Scheduler   string           `json:"settings.quiz.scheduler" binding:"omitempty,oneof=leitner fsrs"`
+	FSRS        *db.FSRSSettings `json:"settings.quiz.fsrs"`
+	TTS         *tts.Settings    `json:"settings.tts"`
+	Providers   []string         `json:"settings.sentence.providers" binding:"omitempty,dive,oneof=tatoeba cache corpus jukuu"`
+	Corpus      *string          `json:"settings.sentence.corpus"`
 }
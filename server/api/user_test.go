@@ -0,0 +1,76 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhquiz/go-zhquiz/shared"
+)
+
+func TestUserTTSCommand(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	res := prepareTest(t)
+	r := gin.New()
+	res.Register(r, &Options{Token: "test"})
+
+	for _, c := range []struct {
+		command string
+		status  int
+	}{
+		{"", 201},
+		{"piper", 201},
+		{"/bin/sh", 400},
+		{"/usr/bin/espeak", 400},
+		{"sh", 400},
+	} {
+		req := httptest.NewRequest("PATCH", "/api/user/", strings.NewReader(`{"settings.tts": {"command": "`+c.command+`"}}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(CSRFHeader, "test")
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != c.status {
+			t.Errorf("%q is %d, not %d: %s", c.command, w.Code, c.status, w.Body.String())
+		}
+	}
+}
+
+func TestUserCorpus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	res := prepareTest(t)
+	r := gin.New()
+	res.Register(r, &Options{Token: "test"})
+
+	if err := ioutil.WriteFile(filepath.Join(shared.UserDataDir(), "mine.tsv"), []byte("你好\thello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		corpus string
+		status int
+	}{
+		{"", 201},
+		{"mine.tsv", 201},
+		{filepath.Join(shared.UserDataDir(), "mine.tsv"), 201},
+		{"../mine.tsv", 400},
+		{"/etc/passwd", 400},
+	} {
+		req := httptest.NewRequest("PATCH", "/api/user/", strings.NewReader(`{"settings.sentence.corpus": "`+c.corpus+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(CSRFHeader, "test")
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != c.status {
+			t.Errorf("%q is %d, not %d: %s", c.corpus, w.Code, c.status, w.Body.String())
+		}
+	}
+}
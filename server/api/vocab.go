@@ -3,7 +3,6 @@ package api
 import (
 	"fmt"
 	"math/rand"
-	"regexp"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,24 +12,14 @@ import (
 func routerVocab(apiRouter *gin.RouterGroup) {
 	r := apiRouter.Group("/vocab")
 
-	r.GET("/", func(ctx *gin.Context) {
-		var query struct {
-			Entry string `form:"entry" binding:"required"`
-		}
-
-		if e := ctx.BindQuery(&query); e != nil {
-			ctx.AbortWithError(400, e)
-			return
-		}
+	r.GET("/", wrap(func(ctx *gin.Context) error {
+		var query romanizedEntryQuery
 
-		type Result struct {
-			Simplified  string `json:"simplified"`
-			Traditional string `json:"traditional"`
-			Pinyin      string `json:"pinyin"`
-			English     string `json:"english"`
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
-		result := make([]Result, 0)
+		result := make([]VocabResult, 0)
 
 		if r := resource.Zh.Current.Raw(`
 		SELECT Simplified, Traditional, Pinyin, English English
@@ -38,68 +27,48 @@ func routerVocab(apiRouter *gin.RouterGroup) {
 		WHERE Simplified = ? OR Traditional = ?
 		ORDER BY frequency DESC
 		`, query.Entry, query.Entry).Find(&result); r.Error != nil {
-			panic(r.Error)
+			return r.Error
+		}
+
+		for i, it := range result {
+			result[i].Romanization = query.romanize(it.Pinyin)
 		}
 
 		ctx.JSON(200, gin.H{
 			"result": result,
 		})
-	})
+		return nil
+	}))
 
-	r.GET("/q", func(ctx *gin.Context) {
-		var query struct {
-			Q string `form:"q" binding:"required"`
-		}
+	r.GET("/q", wrap(func(ctx *gin.Context) error {
+		var query romanizedSearchQuery
 
-		if e := ctx.BindQuery(&query); e != nil {
-			ctx.AbortWithError(400, e)
-			return
+		if e := ctx.ShouldBindQuery(&query); e != nil {
+			return Validation(e)
 		}
 
-		type Result struct {
-			Simplified  string `json:"simplified"`
-			Traditional string `json:"traditional"`
-			Pinyin      string `json:"pinyin"`
-			English     string `json:"english"`
+		result, e := current(ctx).SearchVocab(query.Q, 10)
+		if e != nil {
+			return e
 		}
 
-		var result []Result
-
-		where := "simplified LIKE @q OR traditional LIKE @q"
-		cond := map[string]interface{}{
-			"q": "%" + query.Q + "%",
-		}
-
-		if regexp.MustCompile(`^[^\p{Han}]+$`).MatchString(query.Q) {
-			cond["q"] = query.Q
-			where = "simplified IN (SELECT entry FROM token_q WHERE token_q MATCH @q)"
-		}
-
-		if r := resource.Zh.Current.Raw(fmt.Sprintf(`
-		SELECT Simplified, Traditional, vocab.Pinyin, vocab.English
-		FROM vocab
-		WHERE %s
-		ORDER BY frequency DESC
-		LIMIT 10
-		`, where), cond).Find(&result); r.Error != nil {
-			panic(r.Error)
-		}
-
-		if len(result) == 0 {
-			result = make([]Result, 0)
+		for i, it := range result {
+			result[i].Romanization = query.romanize(it.Pinyin)
 		}
 
 		ctx.JSON(200, gin.H{
 			"result": result,
 		})
-	})
+		return nil
+	}))
 
-	r.GET("/level", func(ctx *gin.Context) {
+	r.GET("/level", wrap(func(ctx *gin.Context) error {
 		var existing []db.Quiz
-		if r := resource.DB.Current.
+		if r := resource.DB.Current().
+			Scopes(db.OwnedBy(userID(ctx))).
 			Where("[type] = 'vocab' AND srs_level IS NOT NULL").
 			Find(&existing); r.Error != nil {
-			panic(r.Error)
+			return r.Error
 		}
 
 		srsLevelMap := map[string]*int8{}
@@ -107,13 +76,7 @@ func routerVocab(apiRouter *gin.RouterGroup) {
 			srsLevelMap[it.Entry] = it.SRSLevel
 		}
 
-		type Item struct {
-			Entry    string `json:"entry"`
-			Level    int    `json:"level"`
-			Source   string `json:"source"`
-			SRSLevel *int8  `json:"srs_level"`
-		}
-		var items []Item
+		var items []vocabLevelResult
 
 		if r := resource.Zh.Current.Raw(`
 		SELECT Entry, vocab_level Level, COALESCE((
@@ -122,7 +85,7 @@ func routerVocab(apiRouter *gin.RouterGroup) {
 		FROM token
 		WHERE vocab_level IS NOT NULL
 		`).Find(&items); r.Error != nil {
-			panic(r.Error)
+			return r.Error
 		}
 
 		for i, it := range items {
@@ -132,27 +95,31 @@ func routerVocab(apiRouter *gin.RouterGroup) {
 		ctx.JSON(200, gin.H{
 			"result": items,
 		})
-	})
+		return nil
+	}))
 
-	r.GET("/random", func(ctx *gin.Context) {
-		var user db.User
-		if r := resource.DB.Current.First(&user); r.Error != nil {
-			panic(r.Error)
+	r.GET("/random", wrap(func(ctx *gin.Context) error {
+		user, e := current(ctx).User()
+		if e != nil {
+			return e
 		}
-		levelMin := *user.Meta.LevelMin
-		if levelMin == 0 {
-			levelMin = 1
+
+		// New profiles have no levels yet
+		var levelMin uint = 1
+		if user.Meta.LevelMin != nil && *user.Meta.LevelMin != 0 {
+			levelMin = *user.Meta.LevelMin
 		}
-		levelMax := *user.Meta.Level
-		if levelMax == 0 {
-			levelMax = 60
+		var levelMax uint = 60
+		if user.Meta.Level != nil && *user.Meta.Level != 0 {
+			levelMax = *user.Meta.Level
 		}
 
 		var existing []db.Quiz
-		if r := resource.DB.Current.
+		if r := resource.DB.Current().
+			Scopes(db.OwnedBy(user.ID)).
 			Where("[type] = 'vocab' AND srs_level IS NOT NULL AND next_review IS NOT NULL").
 			Find(&existing); r.Error != nil {
-			panic(r.Error)
+			return r.Error
 		}
 
 		var entries []interface{}
@@ -172,19 +139,14 @@ func routerVocab(apiRouter *gin.RouterGroup) {
 			sqlString = "entry NOT IN @entries AND " + sqlString
 		}
 
-		type Item struct {
-			Result  string `json:"result"`
-			English string `json:"english"`
-			Level   int    `json:"level"`
-		}
-		var items []Item
+		var items []randomResult
 
 		if r := resource.Zh.Current.Raw(fmt.Sprintf(`
 		SELECT entry Result, vocab_level Level
 		FROM token
 		WHERE %s
 		`, sqlString), cond).Find(&items); r.Error != nil {
-			panic(r.Error)
+			return r.Error
 		}
 
 		if len(items) > 0 {
@@ -198,7 +160,7 @@ func routerVocab(apiRouter *gin.RouterGroup) {
 			`, simp).Rows()
 
 			if e != nil {
-				panic(e)
+				return e
 			}
 
 			simpMap := make(map[string]string)
@@ -206,12 +168,12 @@ func routerVocab(apiRouter *gin.RouterGroup) {
 				var simplified string
 				var english string
 				if e := rows.Scan(&simplified, &english); e != nil {
-					panic(e)
+					return e
 				}
 				simpMap[simplified] = english
 			}
 
-			newItems := make([]Item, 0)
+			newItems := make([]randomResult, 0)
 			for _, it := range items {
 				it.English = simpMap[it.Result]
 				if it.English != "" {
@@ -223,7 +185,7 @@ func routerVocab(apiRouter *gin.RouterGroup) {
 		}
 
 		if len(items) < 1 {
-			items = []Item{}
+			items = []randomResult{}
 
 			sqlString := "TRUE"
 
@@ -236,12 +198,12 @@ func routerVocab(apiRouter *gin.RouterGroup) {
 			FROM vocab
 			WHERE %s
 			`, sqlString), cond).Find(&items); r.Error != nil {
-				panic(r.Error)
+				return r.Error
 			}
 		}
 
 		if len(items) < 1 {
-			ctx.AbortWithError(404, fmt.Errorf("no matched entries found"))
+			return NotFound(fmt.Errorf("no matched entries found"))
 		}
 
 		rand.Seed(time.Now().UnixNano())
@@ -254,5 +216,23 @@ func routerVocab(apiRouter *gin.RouterGroup) {
 		}
 
 		ctx.JSON(200, item)
-	})
+		return nil
+	}))
+}
+
+// VocabResult is a CEDICT entry
+type VocabResult struct {
+	Simplified  string `json:"simplified"`
+	Traditional string `json:"traditional"`
+	Pinyin      string `json:"pinyin"`
+	English     string `json:"english"`
+	// Romanization is Pinyin, converted as requested by ?romanization=
+	Romanization string `json:"romanization,omitempty"`
+}
+
+type vocabLevelResult struct {
+	Entry    string `json:"entry"`
+	Level    int    `json:"level"`
+	Source   string `json:"source"`
+	SRSLevel *int8  `json:"srs_level"`
 }
@@ -0,0 +1,298 @@
+// Package cli runs subcommands on Resource directly, without the HTTP server or the webview,
+// e.g. over SSH.
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/zhquiz/go-zhquiz/server/api"
+	"github.com/zhquiz/go-zhquiz/server/db"
+	"gorm.io/gorm"
+)
+
+type command struct {
+	Usage string
+	Run   func(res *api.Resource, args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"review": {
+			Usage: "review [--type vocab,hanzi] [--stage new,learning,graduated,leech] [--direction se,ec,te] [--q query] [--limit n]",
+			Run:   runReview,
+		},
+		"add": {
+			Usage: "add <entries...> [--type hanzi|vocab|sentence|extra]",
+			Run:   runAdd,
+		},
+		"search": {
+			Usage: "search <q> [--limit n]",
+			Run:   runSearch,
+		},
+		"stats": {
+			Usage: "stats",
+			Run:   runStats,
+		},
+		"export": {
+			Usage: "export [--format json|apkg|tsv|csv] [--q query] [--out file]",
+			Run:   runExport,
+		},
+		"help": {
+			Usage: "help",
+			Run: func(*api.Resource, []string) error {
+				usage(os.Stdout)
+				return nil
+			},
+		},
+	}
+}
+
+// IsCommand checks if args[1] of the executable is a subcommand, rather than e.g. OS-specific arguments
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// Run runs a subcommand, where args[0] is the subcommand name
+func Run(res *api.Resource, args []string) error {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return errors.New("no command")
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		usage(os.Stderr)
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+
+	rest, profile := profileArg(args[1:])
+	if profile != "" {
+		var user db.User
+		if r := res.DB.Current().Where("id = ? OR name = ?", profile, profile).First(&user); r.Error != nil {
+			if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("no such profile: %s", profile)
+			}
+			return r.Error
+		}
+
+		as := res.As(user.ID)
+		res = &as
+	}
+
+	return cmd.Run(res, rest)
+}
+
+// profileArg takes --profile out of args, for all commands
+func profileArg(args []string) ([]string, string) {
+	rest := make([]string, 0)
+	profile := ""
+
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+
+		switch {
+		case a == "--profile" || a == "-profile":
+			if i+1 < len(args) {
+				profile = args[i+1]
+				i++
+			}
+		case strings.HasPrefix(a, "--profile="):
+			profile = strings.TrimPrefix(a, "--profile=")
+		case strings.HasPrefix(a, "-profile="):
+			profile = strings.TrimPrefix(a, "-profile=")
+		default:
+			rest = append(rest, a)
+		}
+	}
+
+	return rest, profile
+}
+
+func usage(w io.Writer) {
+	names := make([]string, 0)
+	for k := range commands {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "Usage:")
+	for _, k := range names {
+		fmt.Fprintf(w, "  zhquiz %s\n", commands[k].Usage)
+	}
+	fmt.Fprintln(w, "\nAll commands take --profile <id or name>, defaulting to the default profile.")
+}
+
+// parse parses flags, which may come after positional arguments, and returns the positional arguments
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := make([]string, 0)
+
+	for {
+		if e := fs.Parse(args); e != nil {
+			return nil, e
+		}
+
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// splitList splits comma-separated flag values
+func splitList(s string) []string {
+	out := make([]string, 0)
+	for _, it := range strings.Split(s, ",") {
+		if it = strings.TrimSpace(it); it != "" {
+			out = append(out, it)
+		}
+	}
+
+	return out
+}
+
+func runAdd(res *api.Resource, args []string) error {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	qType := fs.String("type", "vocab", "hanzi, vocab, sentence or extra")
+
+	entries, e := parse(fs, args)
+	if e != nil {
+		return e
+	}
+
+	if len(entries) == 0 {
+		return errors.New("no entries to add")
+	}
+
+	result, e := res.AddQuizzes(entries, *qType)
+	if e != nil {
+		return e
+	}
+
+	for _, r := range result {
+		fmt.Printf("%s\t%s\t%s\t%s\n", r.Entry, r.Type, r.Source, strings.Join(r.IDs, ","))
+	}
+
+	return nil
+}
+
+func runSearch(res *api.Resource, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	limit := fs.Int("limit", 10, "maximum number of results")
+
+	qs, e := parse(fs, args)
+	if e != nil {
+		return e
+	}
+
+	result, e := res.SearchVocab(strings.Join(qs, " "), *limit)
+	if e != nil {
+		return e
+	}
+
+	for _, r := range result {
+		entry := r.Simplified
+		if r.Traditional != "" && r.Traditional != r.Simplified {
+			entry += " " + r.Traditional
+		}
+
+		fmt.Printf("%s [%s]\n", entry, r.Pinyin)
+		fmt.Printf("    %s\n", strings.ReplaceAll(r.English, "/", "; "))
+	}
+
+	return nil
+}
+
+func runStats(res *api.Resource, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	if _, e := parse(fs, args); e != nil {
+		return e
+	}
+
+	s, e := res.Stats()
+	if e != nil {
+		return e
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Total\t%d\n", s.Total)
+	for _, t := range []string{"hanzi", "vocab", "sentence"} {
+		fmt.Fprintf(w, "  %s\t%d\n", t, s.Type[t])
+	}
+	fmt.Fprintf(w, "New\t%d\n", s.New)
+	fmt.Fprintf(w, "Learning\t%d\n", s.Learning)
+	fmt.Fprintf(w, "Graduated\t%d\n", s.Graduated)
+	fmt.Fprintf(w, "Leech\t%d\n", s.Leech)
+	fmt.Fprintf(w, "Due now\t%d\n", s.Due)
+	fmt.Fprintf(w, "Reviewed today\t%d\n", s.ReviewedToday)
+
+	return w.Flush()
+}
+
+func runExport(res *api.Resource, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "json", "json (all user data, for POST /api/import), or apkg, tsv or csv (quizzes, for Anki)")
+	q := fs.String("q", "", "filter quizzes, as in the quiz page (not for json)")
+	out := fs.String("out", "", "output file, defaults to stdout")
+
+	if _, e := parse(fs, args); e != nil {
+		return e
+	}
+
+	if *out == "" {
+		if *format == "apkg" {
+			return errors.New("--out is required for apkg")
+		}
+
+		return export(res, os.Stdout, *format, *q)
+	}
+
+	f, e := os.Create(*out)
+	if e != nil {
+		return e
+	}
+
+	// A partial file is not left behind on failure
+	if e := export(res, f, *format, *q); e != nil {
+		f.Close()
+		os.Remove(*out)
+		return e
+	}
+
+	if e := f.Close(); e != nil {
+		os.Remove(*out)
+		return e
+	}
+
+	return nil
+}
+
+// export writes all user data as JSON, or quizzes in format
+func export(res *api.Resource, w io.Writer, format string, q string) error {
+	if format == "json" {
+		d, e := res.ExportDump()
+		if e != nil {
+			return e
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	}
+
+	return res.ExportQuizzes(w, format, q)
+}
@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zhquiz/go-zhquiz/server/api"
+	"github.com/zhquiz/go-zhquiz/server/db"
+	"github.com/zhquiz/go-zhquiz/shared"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// prepareTest makes resource in a temporary directory, with zh.db of 你好 only
+func prepareTest(t *testing.T) (*api.Resource, string) {
+	dir, err := ioutil.TempDir("", "zhquiz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	if err := os.MkdirAll(filepath.Join(dir, "assets"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "assets", "dict.txt"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	zhDB, err := gorm.Open(sqlite.Open(filepath.Join(dir, "assets", "zh.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		"CREATE TABLE token (entry, pinyin, english, frequency, hanzi_level, vocab_level)",
+		"CREATE TABLE vocab (simplified, traditional, pinyin, english, frequency, source)",
+		"CREATE TABLE sentence (id, chinese, pinyin, english, frequency, level)",
+		"CREATE TABLE library (title, entries)",
+		"CREATE VIRTUAL TABLE token_q USING fts5(entry, pinyin, english, description, tag)",
+		"INSERT INTO token VALUES ('你好', 'ni3 hao3', 'hello', 1, NULL, 1)",
+		"INSERT INTO vocab VALUES ('你好', '你好', 'ni3 hao3', 'hello', 1, '')",
+	} {
+		if r := zhDB.Exec(stmt); r.Error != nil {
+			t.Fatal(r.Error)
+		}
+	}
+	if sqlDB, err := zhDB.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	shared.ExecDir = dir
+	os.Setenv("USER_DATA_DIR", dir)
+
+	res := api.Prepare()
+	t.Cleanup(res.Cleanup)
+
+	return &res, dir
+}
+
+func TestProfileArg(t *testing.T) {
+	for _, c := range []struct {
+		args    []string
+		rest    []string
+		profile string
+	}{
+		{[]string{}, []string{}, ""},
+		{[]string{"--limit", "1"}, []string{"--limit", "1"}, ""},
+		{[]string{"--profile", "p1", "--limit", "1"}, []string{"--limit", "1"}, "p1"},
+		{[]string{"--limit", "1", "-profile", "p1"}, []string{"--limit", "1"}, "p1"},
+		{[]string{"你好", "--profile=p1"}, []string{"你好"}, "p1"},
+		{[]string{"-profile=p1", "你好"}, []string{"你好"}, "p1"},
+		// The last one wins
+		{[]string{"--profile=p1", "--profile", "p2"}, []string{}, "p2"},
+		// Without a value
+		{[]string{"你好", "--profile"}, []string{"你好"}, ""},
+	} {
+		rest, profile := profileArg(c.args)
+		if !reflect.DeepEqual(rest, c.rest) || profile != c.profile {
+			t.Errorf("%v is %v, %q; not %v, %q", c.args, rest, profile, c.rest, c.profile)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, c := range []struct {
+		args       []string
+		positional []string
+		qType      string
+		limit      int
+	}{
+		{[]string{}, []string{}, "vocab", 10},
+		{[]string{"你好", "再见"}, []string{"你好", "再见"}, "vocab", 10},
+		{[]string{"--type", "hanzi", "你", "好"}, []string{"你", "好"}, "hanzi", 10},
+		// Flags after positional arguments
+		{[]string{"你", "--type", "hanzi", "好", "--limit=3"}, []string{"你", "好"}, "hanzi", 3},
+		{[]string{"你好", "-limit", "1"}, []string{"你好"}, "vocab", 1},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		qType := fs.String("type", "vocab", "")
+		limit := fs.Int("limit", 10, "")
+
+		positional, err := parse(fs, c.args)
+		if err != nil {
+			t.Errorf("%v: %v", c.args, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(positional, c.positional) || *qType != c.qType || *limit != c.limit {
+			t.Errorf("%v is %v, type %q, limit %d", c.args, positional, *qType, *limit)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"你好", "--unknown"},
+		{"--limit", "abc"},
+		{"你好", "--limit"},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		fs.Int("limit", 10, "")
+
+		if _, err := parse(fs, args); err == nil {
+			t.Errorf("%v is parsed", args)
+		}
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want []string
+	}{
+		{"", []string{}},
+		{"vocab", []string{"vocab"}},
+		{"vocab,hanzi", []string{"vocab", "hanzi"}},
+		{" vocab , ,hanzi,", []string{"vocab", "hanzi"}},
+	} {
+		if out := splitList(c.in); !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%q is %v, not %v", c.in, out, c.want)
+		}
+	}
+}
+
+func TestJoinUnique(t *testing.T) {
+	for _, c := range []struct {
+		in   []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"你好"}, "你好"},
+		{[]string{"你好", " 你好 ", "妳好"}, "你好 妳好"},
+		{[]string{"", " ", "hello"}, "hello"},
+	} {
+		if out := joinUnique(c.in, " "); out != c.want {
+			t.Errorf("%v is %q, not %q", c.in, out, c.want)
+		}
+	}
+}
+
+func TestReviewCard(t *testing.T) {
+	c := db.QuizContent{
+		Entries:     []string{"你好", "你好"},
+		Traditional: []string{"妳好"},
+		Pinyin:      []string{"ni3 hao3"},
+		English:     []string{"hello", "hi"},
+		Description: []string{"greeting"},
+	}
+
+	for _, tc := range []struct {
+		direction   string
+		content     db.QuizContent
+		front, back []string
+	}{
+		{"se", c, []string{"你好"}, []string{"ni3 hao3", "hello; hi", "greeting"}},
+		{"ec", c, []string{"hello; hi"}, []string{"你好", "ni3 hao3", "greeting"}},
+		{"te", c, []string{"妳好"}, []string{"你好", "ni3 hao3", "hello; hi", "greeting"}},
+		// Without traditional, nor description
+		{"te", db.QuizContent{Entries: []string{"你"}, Pinyin: []string{"ni3"}, English: []string{"you"}}, []string{"你"}, []string{"你", "ni3", "you"}},
+	} {
+		front, back := reviewCard(db.Quiz{Direction: tc.direction}, &tc.content)
+		if !reflect.DeepEqual(front, tc.front) || !reflect.DeepEqual(back, tc.back) {
+			t.Errorf("%s is %v, %v; not %v, %v", tc.direction, front, back, tc.front, tc.back)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	res, dir := prepareTest(t)
+
+	if err := (&db.Quiz{ID: "q1", Entry: "你好", Type: "vocab", Direction: "se", Source: "vocab"}).Create(res.DB.Current()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"--format", "json"}, true},
+		{[]string{"--format", "tsv"}, true},
+		{[]string{"--format", "apkg"}, true},
+		// Fails after the file is created
+		{[]string{"--format", "xml"}, false},
+	} {
+		out := filepath.Join(dir, "export.out")
+		os.Remove(out)
+
+		err := runExport(res, append(c.args, "--out", out))
+		if (err == nil) != c.ok {
+			t.Errorf("%v: %v", c.args, err)
+		}
+
+		fi, statErr := os.Stat(out)
+		switch {
+		case c.ok && (statErr != nil || fi.Size() == 0):
+			t.Errorf("%v: not exported: %v", c.args, statErr)
+		case !c.ok && !os.IsNotExist(statErr):
+			t.Errorf("%v: partial file is left: %v", c.args, statErr)
+		}
+	}
+
+	if err := runExport(res, []string{"--format", "apkg"}); err == nil {
+		t.Error("apkg is exported to stdout")
+	}
+}
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zhquiz/go-zhquiz/server/api"
+	"github.com/zhquiz/go-zhquiz/server/db"
+)
+
+// reviewGrades are accepted answers, besides full grade names, e.g. "good"
+var reviewGrades = map[string]db.Grade{
+	"r": db.GradeRight,
+	"w": db.GradeWrong,
+	"p": db.GradeRepeat,
+}
+
+func runReview(res *api.Resource, args []string) error {
+	fs := flag.NewFlagSet("review", flag.ContinueOnError)
+	qType := fs.String("type", "", "comma-separated hanzi, vocab, sentence; defaults to quiz settings")
+	stage := fs.String("stage", "", "comma-separated new, learning, graduated, leech; defaults to quiz settings")
+	direction := fs.String("direction", "", "comma-separated se, ec, te; defaults to quiz settings")
+	q := fs.String("q", "", "filter quizzes, as in the quiz page")
+	limit := fs.Int("limit", 0, "maximum number of quizzes, 0 for all due")
+
+	if _, e := parse(fs, args); e != nil {
+		return e
+	}
+
+	if fi, e := os.Stdin.Stat(); e != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return errors.New("review needs an interactive terminal")
+	}
+
+	quizzes, e := res.DueQuizzes(splitList(*qType), splitList(*stage), splitList(*direction), *q)
+	if e != nil {
+		return e
+	}
+
+	if *limit > 0 && len(quizzes) > *limit {
+		quizzes = quizzes[:*limit]
+	}
+
+	if len(quizzes) == 0 {
+		fmt.Println("No quizzes due.")
+		return nil
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	readLine := func(prompt string) (string, error) {
+		fmt.Print(prompt)
+		s, e := in.ReadString('\n')
+		return strings.ToLower(strings.TrimSpace(s)), e
+	}
+
+	done := 0
+
+QUIZ_LOOP:
+	for i, quiz := range quizzes {
+		c, e := quiz.Resolve(res.DB.Current())
+		if e != nil {
+			return e
+		}
+
+		front, back := reviewCard(quiz, c)
+
+		fmt.Printf("\n[%d/%d] %s %s\n", i+1, len(quizzes), quiz.Type, quiz.Direction)
+		for _, s := range front {
+			fmt.Println("  " + s)
+		}
+
+		start := time.Now()
+
+		s, e := readLine("(Enter to reveal, q to quit) ")
+		if e != nil || s == "q" {
+			break
+		}
+
+		latency := uint(time.Since(start).Milliseconds())
+
+		for _, s := range back {
+			fmt.Println("  " + s)
+		}
+
+		for {
+			s, e := readLine("[r]ight, [w]rong, re[p]eat, [s]kip, [q]uit? ")
+			if e != nil || s == "q" {
+				break QUIZ_LOOP
+			}
+
+			if s == "s" {
+				break
+			}
+
+			g, ok := reviewGrades[s]
+			if !ok {
+				g = db.Grade(s)
+			}
+
+			if !g.IsValid() {
+				continue
+			}
+
+			if e := res.MarkQuiz(quiz.ID, g, &latency); e != nil {
+				return e
+			}
+
+			done++
+			break
+		}
+	}
+
+	fmt.Printf("\nReviewed %d of %d.\n", done, len(quizzes))
+	return nil
+}
+
+// reviewCard shows the question, then the answer, per direction
+func reviewCard(q db.Quiz, c *db.QuizContent) (front []string, back []string) {
+	entries := joinUnique(c.Entries, " ")
+	pinyin := joinUnique(c.Pinyin, "; ")
+	english := joinUnique(c.English, "; ")
+
+	switch q.Direction {
+	case "te":
+		traditional := joinUnique(c.Traditional, " ")
+		if traditional == "" {
+			traditional = entries
+		}
+
+		front = []string{traditional}
+		back = []string{entries, pinyin, english}
+	case "ec":
+		front = []string{english}
+		back = []string{entries, pinyin}
+	default:
+		front = []string{entries}
+		back = []string{pinyin, english}
+	}
+
+	if description := joinUnique(c.Description, "; "); description != "" {
+		back = append(back, description)
+	}
+
+	return front, back
+}
+
+func joinUnique(ss []string, sep string) string {
+	set := map[string]bool{}
+	out := make([]string, 0)
+
+	for _, s := range ss {
+		s = strings.TrimSpace(s)
+		if s != "" && !set[s] {
+			set[s] = true
+			out = append(out, s)
+		}
+	}
+
+	return strings.Join(out, sep)
+}
@@ -0,0 +1,294 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zhquiz/go-zhquiz/shared"
+	"gorm.io/gorm"
+)
+
+// BackupInfo is a snapshot of data.db, in BackupDir
+type BackupInfo struct {
+	Name      string    `json:"name"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+	Size      int64     `json:"size"`
+}
+
+const backupTimeFormat = "20060102-150405"
+
+// reBackupName matches data-<time>-<reason>.db
+var reBackupName = regexp.MustCompile(`^data-(\d{8}-\d{6})-([a-z0-9-]+)\.db$`)
+
+// BackupDir is where backups of data.db are kept
+func BackupDir() string {
+	return filepath.Join(shared.UserDataDir(), "backup")
+}
+
+// Backup snapshots data.db into BackupDir, then deletes the oldest backups beyond shared.BackupKeep.
+// Reason is e.g. startup, interval, migration-v1, import or restore.
+func (d DB) Backup(reason string) (*BackupInfo, error) {
+	return backup(d.Current(), reason)
+}
+
+// backup uses VACUUM INTO, which must be outside of transactions,
+// but is consistent with concurrent writes
+func backup(db *gorm.DB, reason string) (*BackupInfo, error) {
+	if e := os.MkdirAll(BackupDir(), 0755); e != nil {
+		return nil, e
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("data-%s-%s.db", now.Format(backupTimeFormat), reason)
+	if !reBackupName.MatchString(name) {
+		return nil, fmt.Errorf("invalid backup reason: %s", reason)
+	}
+
+	path := filepath.Join(BackupDir(), name)
+
+	// VACUUM INTO refuses to overwrite, e.g. within the same second
+	if e := os.Remove(path); e != nil && !os.IsNotExist(e) {
+		return nil, e
+	}
+
+	if r := db.Exec("VACUUM INTO ?", path); r.Error != nil {
+		return nil, r.Error
+	}
+
+	if e := pruneBackups(shared.BackupKeep()); e != nil {
+		log.Println(e)
+	}
+
+	stat, e := os.Stat(path)
+	if e != nil {
+		return nil, e
+	}
+
+	return &BackupInfo{
+		Name:      name,
+		Reason:    reason,
+		CreatedAt: now,
+		Size:      stat.Size(),
+	}, nil
+}
+
+// Backups lists backups in BackupDir, latest first
+func Backups() ([]BackupInfo, error) {
+	out := make([]BackupInfo, 0)
+
+	files, e := ioutil.ReadDir(BackupDir())
+	if e != nil {
+		if os.IsNotExist(e) {
+			return out, nil
+		}
+		return nil, e
+	}
+
+	// Names have seconds only, so modification time orders backups of the same second
+	modTime := map[string]time.Time{}
+
+	for _, f := range files {
+		m := reBackupName.FindStringSubmatch(f.Name())
+		if m == nil || f.IsDir() {
+			continue
+		}
+
+		t, e := time.ParseInLocation(backupTimeFormat, m[1], time.Local)
+		if e != nil {
+			continue
+		}
+
+		modTime[f.Name()] = f.ModTime()
+		out = append(out, BackupInfo{
+			Name:      f.Name(),
+			Reason:    m[2],
+			CreatedAt: t,
+			Size:      f.Size(),
+		})
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return modTime[out[i].Name].After(modTime[out[j].Name])
+	})
+
+	return out, nil
+}
+
+func pruneBackups(keep int) error {
+	bs, e := Backups()
+	if e != nil {
+		return e
+	}
+
+	for i := keep; i < len(bs); i++ {
+		if e := os.Remove(filepath.Join(BackupDir(), bs[i].Name)); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// StartBackups backs up on startup, and then every interval, if not 0, until Close
+func (d DB) StartBackups(interval time.Duration) {
+	if _, e := d.Backup("startup"); e != nil {
+		log.Printf("cannot back up data.db: %v\n", e)
+	}
+
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+				if _, e := d.Backup("interval"); e != nil {
+					log.Printf("cannot back up data.db: %v\n", e)
+				}
+			}
+		}
+	}()
+}
+
+// Restore replaces data.db with a backup, after backing up the current data.db.
+// The file is swapped by rename, and Current is reopened, so that copies of DB see it.
+// Current waits for the swap, but requests in flight with the old handle may fail.
+func (d DB) Restore(name string) (*BackupInfo, error) {
+	if !reBackupName.MatchString(name) {
+		return nil, fmt.Errorf("no such backup: %s: %w", name, os.ErrNotExist)
+	}
+
+	src := filepath.Join(BackupDir(), name)
+	if _, e := os.Stat(src); e != nil {
+		return nil, fmt.Errorf("no such backup: %s: %w", name, e)
+	}
+
+	if e := checkBackup(src); e != nil {
+		return nil, fmt.Errorf("cannot restore %s: %w", name, e)
+	}
+
+	dataPath := filepath.Join(shared.UserDataDir(), "data.db")
+	tmp := dataPath + ".restore"
+
+	// Copy first, as backing up may prune src, if it is the oldest
+	if e := copyFile(src, tmp); e != nil {
+		os.Remove(tmp)
+		return nil, e
+	}
+
+	before, e := d.Backup("restore")
+	if e != nil {
+		os.Remove(tmp)
+		return nil, e
+	}
+
+	d.current.Lock()
+	defer d.current.Unlock()
+
+	if e := closeDB(d.current.db); e != nil {
+		os.Remove(tmp)
+		return nil, e
+	}
+
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if e := os.Remove(dataPath + suffix); e != nil && !os.IsNotExist(e) {
+			log.Println(e)
+		}
+	}
+
+	renameErr := os.Rename(tmp, dataPath)
+
+	// Reopen, even if rename failed, so that the app still has the old data.db
+	fresh, e := open(dataPath)
+	if e != nil {
+		return nil, e
+	}
+	d.current.db = fresh
+
+	if renameErr != nil {
+		return nil, renameErr
+	}
+
+	if e := Migrate(fresh); e != nil {
+		return nil, e
+	}
+
+	return before, nil
+}
+
+// checkBackup makes sure a backup is readable, and not from a newer app
+func checkBackup(path string) error {
+	db, e := open(path)
+	if e != nil {
+		return e
+	}
+
+	sqlDB, e := db.DB()
+	if e != nil {
+		return e
+	}
+	defer sqlDB.Close()
+
+	var result string
+	if r := db.Raw("PRAGMA integrity_check").Scan(&result); r.Error != nil {
+		return r.Error
+	}
+
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", strings.TrimSpace(result))
+	}
+
+	v, e := CurrentSchemaVersion(db)
+	if e != nil {
+		return e
+	}
+
+	if v > LatestSchemaVersion() {
+		return fmt.Errorf("backup is at schema version %d, newer than this app (%d)", v, LatestSchemaVersion())
+	}
+
+	return nil
+}
+
+func copyFile(src string, dst string) error {
+	in, e := os.Open(src)
+	if e != nil {
+		return e
+	}
+	defer in.Close()
+
+	out, e := os.Create(dst)
+	if e != nil {
+		return e
+	}
+
+	if _, e := io.Copy(out, in); e != nil {
+		out.Close()
+		return e
+	}
+
+	if e := out.Sync(); e != nil {
+		out.Close()
+		return e
+	}
+
+	return out.Close()
+}
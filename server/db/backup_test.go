@@ -0,0 +1,89 @@
+package db
+
+import (
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestRestoreOldest(t *testing.T) {
+	dir := setupTest(t)
+	d := DB{current: &current{db: openTest(t, dir, "")}}
+	t.Cleanup(func() { closeDB(d.Current()) })
+
+	os.Setenv("ZHQUIZ_BACKUP_KEEP", "2")
+	t.Cleanup(func() { os.Unsetenv("ZHQUIZ_BACKUP_KEEP") })
+
+	if err := Migrate(d.Current()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&Quiz{ID: "q1", Entry: "你好", Type: "vocab", Direction: "se", Source: "vocab"}).Create(d.Current()); err != nil {
+		t.Fatal(err)
+	}
+	old, err := d.Backup("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&Quiz{ID: "q2", Entry: "你好", Type: "vocab", Direction: "ec", Source: "vocab"}).Create(d.Current()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Backup("new"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Readers during the swap may fail, but only with the old handle
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					d.Current().Exec("SELECT 1")
+				}
+			}
+		}()
+	}
+
+	// Backing up before restoring prunes the oldest backup, which is being restored
+	before, err := d.Restore(old.Name)
+	close(stop)
+	wg.Wait()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.Reason != "restore" {
+		t.Errorf("backed up as %q", before.Reason)
+	}
+
+	var ids []string
+	if r := d.Current().Model(&Quiz{}).Order("id").Pluck("id", &ids); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	if len(ids) != 1 || ids[0] != "q1" {
+		t.Errorf("restored quizzes %v, not [q1]", ids)
+	}
+
+	res, err := Verify(d.Current())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.OK() {
+		t.Errorf("FTS issues after restore: %+v", res.Issues)
+	}
+
+	backups, err := Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 || backups[0].Reason != "restore" || backups[1].Reason != "new" {
+		t.Errorf("backups are %+v", backups)
+	}
+}
@@ -0,0 +1,711 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jkomyno/nanoid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DumpVersion is the current version of Dump
+const DumpVersion = 1
+
+// Dump is the JSON document of all user data, for export and import
+type Dump struct {
+	Version   int            `json:"version"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Quiz      []DumpQuiz     `json:"quiz"`
+	Extra     []DumpExtra    `json:"extra"`
+	Library   []DumpLibrary  `json:"library"`
+	Sentence  []DumpSentence `json:"sentence"`
+	User      *DumpUser      `json:"user"`
+}
+
+// DumpQuiz is Quiz in Dump
+type DumpQuiz struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Entry       string `json:"entry"`
+	Type        string `json:"type"`
+	Direction   string `json:"direction"`
+	Source      string `json:"source"`
+	Description string `json:"description"`
+	Tag         string `json:"tag"`
+
+	SRSLevel    *int8      `json:"srsLevel"`
+	NextReview  *time.Time `json:"nextReview"`
+	LastRight   *time.Time `json:"lastRight"`
+	LastWrong   *time.Time `json:"lastWrong"`
+	RightStreak *uint      `json:"rightStreak"`
+	WrongStreak *uint      `json:"wrongStreak"`
+	MaxRight    *uint      `json:"maxRight"`
+	MaxWrong    *uint      `json:"maxWrong"`
+	Stability   *float64   `json:"stability"`
+	Difficulty  *float64   `json:"difficulty"`
+}
+
+// DumpExtra is Extra in Dump
+type DumpExtra struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Chinese     string `json:"chinese"`
+	Pinyin      string `json:"pinyin"`
+	English     string `json:"english"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Tag         string `json:"tag"`
+}
+
+// DumpLibrary is Library in Dump
+type DumpLibrary struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Title       string   `json:"title"`
+	Entries     []string `json:"entries"`
+	Description string   `json:"description"`
+	Tag         string   `json:"tag"`
+}
+
+// DumpSentence is Sentence in Dump
+type DumpSentence struct {
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Chinese string `json:"chinese"`
+	English string `json:"english"`
+}
+
+// DumpUser is User in Dump
+type DumpUser struct {
+	UpdatedAt time.Time `json:"updatedAt"`
+	Meta      UserMeta  `json:"meta"`
+}
+
+// ImportPolicy decides what to do, when an imported row already exists
+type ImportPolicy string
+
+// ImportPolicy's
+const (
+	ImportSkip      ImportPolicy = "skip"
+	ImportOverwrite ImportPolicy = "overwrite"
+	ImportNewer     ImportPolicy = "newer"
+)
+
+// ImportCount counts imported rows per table
+type ImportCount struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+}
+
+// ImportResult is the result of Import
+type ImportResult struct {
+	Quiz     ImportCount `json:"quiz"`
+	Extra    ImportCount `json:"extra"`
+	Library  ImportCount `json:"library"`
+	Sentence ImportCount `json:"sentence"`
+	User     ImportCount `json:"user"`
+}
+
+// Export dumps all user data of a profile. Sentence's are shared by all profiles.
+func Export(tx *gorm.DB, userID string) (*Dump, error) {
+	out := Dump{
+		Version:   DumpVersion,
+		CreatedAt: time.Now(),
+		Quiz:      make([]DumpQuiz, 0),
+		Extra:     make([]DumpExtra, 0),
+		Library:   make([]DumpLibrary, 0),
+		Sentence:  make([]DumpSentence, 0),
+	}
+
+	var quizzes []Quiz
+	if r := tx.Scopes(OwnedBy(userID)).Find(&quizzes); r.Error != nil {
+		return nil, r.Error
+	}
+
+	qTags := map[string][2]string{}
+	if e := scanFTS(tx, "SELECT id, description, tag FROM quiz_q", qTags); e != nil {
+		return nil, e
+	}
+
+	for _, q := range quizzes {
+		out.Quiz = append(out.Quiz, DumpQuiz{
+			ID:          q.ID,
+			CreatedAt:   q.CreatedAt,
+			UpdatedAt:   q.UpdatedAt,
+			Entry:       q.Entry,
+			Type:        q.Type,
+			Direction:   q.Direction,
+			Source:      q.Source,
+			Description: qTags[q.ID][0],
+			Tag:         qTags[q.ID][1],
+			SRSLevel:    q.SRSLevel,
+			NextReview:  q.NextReview,
+			LastRight:   q.LastRight,
+			LastWrong:   q.LastWrong,
+			RightStreak: q.RightStreak,
+			WrongStreak: q.WrongStreak,
+			MaxRight:    q.MaxRight,
+			MaxWrong:    q.MaxWrong,
+			Stability:   q.Stability,
+			Difficulty:  q.Difficulty,
+		})
+	}
+
+	extras, e := findExtras(tx, OwnedBy(userID))
+	if e != nil {
+		return nil, e
+	}
+
+	for _, ex := range extras {
+		out.Extra = append(out.Extra, DumpExtra{
+			ID:          ex.ID,
+			CreatedAt:   ex.CreatedAt,
+			UpdatedAt:   ex.UpdatedAt,
+			Chinese:     ex.Chinese,
+			Pinyin:      ex.Pinyin,
+			English:     ex.English,
+			Type:        ex.Type,
+			Description: ex.Description,
+			Tag:         ex.Tag,
+		})
+	}
+
+	libs, e := findLibraries(tx, OwnedBy(userID))
+	if e != nil {
+		return nil, e
+	}
+
+	for _, lib := range libs {
+		// Built-in libraries, from zh.db
+		if strings.HasPrefix(lib.ID, " ") {
+			continue
+		}
+
+		out.Library = append(out.Library, DumpLibrary{
+			ID:          lib.ID,
+			CreatedAt:   lib.CreatedAt,
+			UpdatedAt:   lib.UpdatedAt,
+			Title:       lib.Title,
+			Entries:     lib.Entries,
+			Description: lib.Description,
+			Tag:         lib.Tag,
+		})
+	}
+
+	var sentences []Sentence
+	if r := tx.Find(&sentences); r.Error != nil {
+		return nil, r.Error
+	}
+
+	for _, s := range sentences {
+		out.Sentence = append(out.Sentence, DumpSentence{
+			CreatedAt: s.CreatedAt,
+			UpdatedAt: s.UpdatedAt,
+			Chinese:   s.Chinese,
+			English:   s.English,
+		})
+	}
+
+	var user User
+	if r := tx.Where("id = ?", userID).First(&user); r.Error != nil {
+		return nil, r.Error
+	}
+
+	out.User = &DumpUser{
+		UpdatedAt: user.UpdatedAt,
+		Meta:      user.Meta,
+	}
+
+	return &out, nil
+}
+
+// Import merges Dump into user data of a profile, then reindexes the profile
+func Import(tx *gorm.DB, userID string, d Dump, policy ImportPolicy) (*ImportResult, error) {
+	if d.Version > DumpVersion {
+		return nil, fmt.Errorf("unsupported dump version: %d", d.Version)
+	}
+
+	out := ImportResult{}
+
+	shouldUpdate := func(local time.Time, imported time.Time) bool {
+		switch policy {
+		case ImportOverwrite:
+			return true
+		case ImportNewer:
+			return imported.After(local)
+		}
+		return false
+	}
+
+	for _, it := range d.Extra {
+		var local Extra
+		if r := tx.Scopes(OwnedBy(userID)).Where("chinese = ?", it.Chinese).First(&local); r.Error != nil {
+			if !errors.Is(r.Error, gorm.ErrRecordNotFound) {
+				return nil, r.Error
+			}
+
+			id, e := newID(tx, &Extra{}, it.ID)
+			if e != nil {
+				return nil, e
+			}
+
+			ex := Extra{
+				ID:          id,
+				CreatedAt:   it.CreatedAt,
+				UpdatedAt:   it.UpdatedAt,
+				UserID:      userID,
+				Chinese:     it.Chinese,
+				Pinyin:      it.Pinyin,
+				English:     it.English,
+				Type:        it.Type,
+				Description: it.Description,
+				Tag:         it.Tag,
+			}
+			if r := tx.Create(&ex); r.Error != nil {
+				return nil, r.Error
+			}
+
+			out.Extra.Created++
+			continue
+		}
+
+		if !shouldUpdate(local.UpdatedAt, it.UpdatedAt) {
+			out.Extra.Skipped++
+			continue
+		}
+
+		if r := tx.Model(&Extra{}).Where("id = ?", local.ID).UpdateColumns(map[string]interface{}{
+			"updated_at":  it.UpdatedAt,
+			"pinyin":      it.Pinyin,
+			"description": it.Description,
+		}); r.Error != nil {
+			return nil, r.Error
+		}
+
+		if e := setFTS(tx, "extra_q", local.ID, map[string]interface{}{
+			"english": it.English,
+			"type":    it.Type,
+			"tag":     it.Tag,
+		}); e != nil {
+			return nil, e
+		}
+
+		out.Extra.Updated++
+	}
+
+	for _, it := range d.Library {
+		var local Library
+		if r := tx.Scopes(OwnedBy(userID)).Where("title = ?", it.Title).First(&local); r.Error != nil {
+			if !errors.Is(r.Error, gorm.ErrRecordNotFound) {
+				return nil, r.Error
+			}
+
+			id, e := newID(tx, &Library{}, it.ID)
+			if e != nil {
+				return nil, e
+			}
+
+			lib := Library{
+				ID:          id,
+				CreatedAt:   it.CreatedAt,
+				UpdatedAt:   it.UpdatedAt,
+				UserID:      userID,
+				Title:       it.Title,
+				Entries:     it.Entries,
+				Description: it.Description,
+				Tag:         it.Tag,
+			}
+			if r := tx.Create(&lib); r.Error != nil {
+				return nil, r.Error
+			}
+
+			out.Library.Created++
+			continue
+		}
+
+		if !shouldUpdate(local.UpdatedAt, it.UpdatedAt) {
+			out.Library.Skipped++
+			continue
+		}
+
+		if r := tx.Model(&Library{}).Where("id = ?", local.ID).UpdateColumns(map[string]interface{}{
+			"updated_at":  it.UpdatedAt,
+			"entries":     StringArray(it.Entries),
+			"description": it.Description,
+		}); r.Error != nil {
+			return nil, r.Error
+		}
+
+		if e := setFTS(tx, "library_q", local.ID, map[string]interface{}{
+			"tag": it.Tag,
+		}); e != nil {
+			return nil, e
+		}
+
+		out.Library.Updated++
+	}
+
+	for _, it := range d.Quiz {
+		stats := map[string]interface{}{
+			"updated_at":   it.UpdatedAt,
+			"srs_level":    it.SRSLevel,
+			"next_review":  it.NextReview,
+			"last_right":   it.LastRight,
+			"last_wrong":   it.LastWrong,
+			"right_streak": it.RightStreak,
+			"wrong_streak": it.WrongStreak,
+			"max_right":    it.MaxRight,
+			"max_wrong":    it.MaxWrong,
+			"stability":    it.Stability,
+			"difficulty":   it.Difficulty,
+		}
+		tags := map[string]interface{}{
+			"description": it.Description,
+			"tag":         it.Tag,
+		}
+
+		var local Quiz
+		if r := tx.Scopes(OwnedBy(userID)).
+			Where("entry = ? AND [type] = ? AND direction = ?", it.Entry, it.Type, it.Direction).
+			First(&local); r.Error != nil {
+			if !errors.Is(r.Error, gorm.ErrRecordNotFound) {
+				return nil, r.Error
+			}
+
+			id, e := newID(tx, &Quiz{}, it.ID)
+			if e != nil {
+				return nil, e
+			}
+
+			q := Quiz{
+				ID:          id,
+				CreatedAt:   it.CreatedAt,
+				UserID:      userID,
+				Entry:       it.Entry,
+				Type:        it.Type,
+				Direction:   it.Direction,
+				Source:      it.Source,
+				Description: it.Description,
+				Tag:         it.Tag,
+			}
+			if r := tx.Create(&q); r.Error != nil {
+				return nil, r.Error
+			}
+
+			if r := tx.Model(&Quiz{}).Where("id = ?", id).UpdateColumns(stats); r.Error != nil {
+				return nil, r.Error
+			}
+
+			out.Quiz.Created++
+			continue
+		}
+
+		if !shouldUpdate(local.UpdatedAt, it.UpdatedAt) {
+			out.Quiz.Skipped++
+			continue
+		}
+
+		if r := tx.Model(&Quiz{}).Where("id = ?", local.ID).UpdateColumns(stats); r.Error != nil {
+			return nil, r.Error
+		}
+
+		if e := setFTS(tx, "quiz_q", local.ID, tags); e != nil {
+			return nil, e
+		}
+
+		out.Quiz.Updated++
+	}
+
+	for _, it := range d.Sentence {
+		var local Sentence
+		if r := tx.Where("chinese = ?", it.Chinese).First(&local); r.Error != nil {
+			if !errors.Is(r.Error, gorm.ErrRecordNotFound) {
+				return nil, r.Error
+			}
+
+			s := Sentence{
+				Model: gorm.Model{
+					CreatedAt: it.CreatedAt,
+					UpdatedAt: it.UpdatedAt,
+				},
+				Chinese: it.Chinese,
+				English: it.English,
+			}
+			if r := tx.Clauses(clause.OnConflict{
+				DoNothing: true,
+			}).Create(&s); r.Error != nil {
+				return nil, r.Error
+			}
+
+			if e := s.Index(tx); e != nil {
+				return nil, e
+			}
+
+			out.Sentence.Created++
+			continue
+		}
+
+		if !shouldUpdate(local.UpdatedAt, it.UpdatedAt) {
+			out.Sentence.Skipped++
+			continue
+		}
+
+		if r := tx.Model(&Sentence{}).Where("id = ?", local.ID).UpdateColumns(map[string]interface{}{
+			"updated_at": it.UpdatedAt,
+			"english":    it.English,
+		}); r.Error != nil {
+			return nil, r.Error
+		}
+
+		local.English = it.English
+		if e := local.Index(tx); e != nil {
+			return nil, e
+		}
+
+		out.Sentence.Updated++
+	}
+
+	if d.User != nil {
+		var user User
+		if r := tx.Where("id = ?", userID).First(&user); r.Error != nil {
+			return nil, r.Error
+		}
+
+		if shouldUpdate(user.UpdatedAt, d.User.UpdatedAt) {
+			if r := tx.Model(&User{}).Where("id = ?", user.ID).UpdateColumns(map[string]interface{}{
+				"updated_at": d.User.UpdatedAt,
+				"meta":       d.User.Meta,
+			}); r.Error != nil {
+				return nil, r.Error
+			}
+
+			out.User.Updated++
+		} else {
+			out.User.Skipped++
+		}
+	}
+
+	// Sentences are indexed above, as they are shared by all profiles
+	if e := rebuildFTS(tx, userID); e != nil {
+		return nil, e
+	}
+
+	return &out, nil
+}
+
+// RebuildFTS recreates quiz_q, extra_q, library_q and sentence_q from their main tables,
+// keeping the fields that are only stored in FTS tables
+func RebuildFTS(tx *gorm.DB) error {
+	return rebuildFTS(tx, "")
+}
+
+// rebuildFTS is RebuildFTS, or if userID is set, only reindexes quizzes, extras and libraries of the profile
+func rebuildFTS(tx *gorm.DB, userID string) error {
+	scopes := make([]func(*gorm.DB) *gorm.DB, 0)
+	if userID != "" {
+		scopes = append(scopes, OwnedBy(userID))
+	}
+
+	extras, e := findExtras(tx, scopes...)
+	if e != nil {
+		return e
+	}
+
+	libs, e := findLibraries(tx, scopes...)
+	if e != nil {
+		return e
+	}
+
+	qTags := map[string][2]string{}
+	if e := scanFTS(tx, "SELECT id, description, tag FROM quiz_q", qTags); e != nil {
+		return e
+	}
+
+	var quizzes []Quiz
+	if r := tx.Scopes(scopes...).Find(&quizzes); r.Error != nil {
+		return r.Error
+	}
+
+	sentences := make([]Sentence, 0)
+
+	// Other rows are replaced one by one, by Index
+	if userID == "" {
+		if r := tx.Find(&sentences); r.Error != nil {
+			return r.Error
+		}
+
+		for _, table := range []string{"quiz_q", "extra_q", "library_q", "sentence_q"} {
+			if r := tx.Exec("DELETE FROM " + table); r.Error != nil {
+				return r.Error
+			}
+		}
+	}
+
+	for _, ex := range extras {
+		if e := ex.Index(tx); e != nil {
+			return e
+		}
+	}
+
+	for _, lib := range libs {
+		if e := lib.Index(tx); e != nil {
+			return e
+		}
+	}
+
+	for _, s := range sentences {
+		if e := s.Index(tx); e != nil {
+			return e
+		}
+	}
+
+	for _, q := range quizzes {
+		q.Description = qTags[q.ID][0]
+		q.Tag = qTags[q.ID][1]
+
+		if e := q.Index(tx); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// findExtras finds all Extra's, including fields only stored in extra_q
+func findExtras(tx *gorm.DB, scopes ...func(*gorm.DB) *gorm.DB) ([]Extra, error) {
+	var extras []Extra
+	if r := tx.Scopes(scopes...).Find(&extras); r.Error != nil {
+		return nil, r.Error
+	}
+
+	var fts []struct {
+		ID      string
+		English string
+		Type    string
+		Tag     string
+	}
+	if r := tx.Raw("SELECT id ID, english English, [type] Type, tag Tag FROM extra_q").Scan(&fts); r.Error != nil {
+		return nil, r.Error
+	}
+
+	ftsMap := map[string]int{}
+	for i, f := range fts {
+		ftsMap[f.ID] = i
+	}
+
+	for i, ex := range extras {
+		if j, ok := ftsMap[ex.ID]; ok {
+			extras[i].English = fts[j].English
+			extras[i].Type = fts[j].Type
+			extras[i].Tag = fts[j].Tag
+		}
+	}
+
+	return extras, nil
+}
+
+// findLibraries finds all Library's, including fields only stored in library_q
+func findLibraries(tx *gorm.DB, scopes ...func(*gorm.DB) *gorm.DB) ([]Library, error) {
+	var libs []Library
+	if r := tx.Scopes(scopes...).Find(&libs); r.Error != nil {
+		return nil, r.Error
+	}
+
+	tags := map[string][2]string{}
+	if e := scanFTS(tx, "SELECT id, '', tag FROM library_q", tags); e != nil {
+		return nil, e
+	}
+
+	for i, lib := range libs {
+		libs[i].Tag = tags[lib.ID][1]
+	}
+
+	return libs, nil
+}
+
+// scanFTS scans rows of (id, a, b) into map of id to [a, b]
+func scanFTS(tx *gorm.DB, sql string, out map[string][2]string) error {
+	rows, e := tx.Raw(sql).Rows()
+	if e != nil {
+		return e
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var a, b *string
+		if e := rows.Scan(&id, &a, &b); e != nil {
+			return e
+		}
+
+		v := [2]string{}
+		if a != nil {
+			v[0] = *a
+		}
+		if b != nil {
+			v[1] = *b
+		}
+		out[id] = v
+	}
+
+	return rows.Err()
+}
+
+// setFTS sets columns only stored in FTS table, to be kept by RebuildFTS
+func setFTS(tx *gorm.DB, table string, id string, values map[string]interface{}) error {
+	if r := tx.Exec("DELETE FROM "+table+" WHERE id = ?", id); r.Error != nil {
+		return r.Error
+	}
+
+	cols := []string{"id"}
+	params := []string{"@id"}
+	for k := range values {
+		cols = append(cols, "["+k+"]")
+		params = append(params, "@"+k)
+	}
+	values["id"] = id
+
+	if r := tx.Exec(fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		table, strings.Join(cols, ", "), strings.Join(params, ", "),
+	), values); r.Error != nil {
+		return r.Error
+	}
+
+	return nil
+}
+
+// newID keeps preferred ID if not yet taken by model, or else generates a new one
+func newID(tx *gorm.DB, model interface{}, preferred string) (string, error) {
+	id := preferred
+
+	for {
+		if id != "" {
+			var count int64
+			if r := tx.Model(model).Where("id = ?", id).Count(&count); r.Error != nil {
+				return "", r.Error
+			}
+
+			if count == 0 {
+				return id, nil
+			}
+		}
+
+		newID, err := nanoid.Nanoid(6)
+		if err != nil {
+			return "", err
+		}
+		id = newID
+	}
+}
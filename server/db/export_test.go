@@ -0,0 +1,272 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// exportTest migrates data.db, with a default profile of a quiz each of vocab and extra, a library and a sentence
+func exportTest(t *testing.T) *gorm.DB {
+	dir := setupTest(t)
+	db := openTest(t, dir, "")
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	level := uint(3)
+	user := User{Meta: UserMeta{Level: &level}}
+
+	for _, err := range []error{
+		db.Create(&user).Error,
+		db.Create(&User{ID: "p2", Name: "p2"}).Error,
+		(&Extra{ID: "e1", Chinese: "好久", Pinyin: "hao3 jiu3", English: "long time", Type: "vocab", Description: "好", Tag: "x"}).Create(db),
+		(&Quiz{ID: "q1", Entry: "你好", Type: "vocab", Direction: "se", Source: "vocab", Description: "hi", Tag: "t1"}).Create(db),
+		(&Quiz{ID: "q2", Entry: "好久", Type: "vocab", Direction: "ec", Source: "extra"}).Create(db),
+		(&Library{ID: "l1", Title: "L", Entries: StringArray{"你好", "好久"}, Description: "d", Tag: "a"}).Create(db),
+		func() error {
+			_, e := CreateSentences(db, []Sentence{{Chinese: "你好", English: "hello"}})
+			return e
+		}(),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	level1 := int8(1)
+	if r := db.Model(&Quiz{}).Where("id = ?", "q1").Update("srs_level", level1); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+
+	return db
+}
+
+func exportOf(t *testing.T, db *gorm.DB, userID string) *Dump {
+	d, err := Export(db, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+// comparable clears what is not kept on import to another profile, i.e. IDs and time of export,
+// and sorts tags of quizzes, which are stored unordered
+func comparable(d Dump) Dump {
+	d.CreatedAt = time.Time{}
+
+	quizzes := make([]DumpQuiz, 0)
+	for _, q := range d.Quiz {
+		q.ID = ""
+		q.CreatedAt = q.CreatedAt.UTC()
+		q.UpdatedAt = q.UpdatedAt.UTC()
+		q.Description = ftsTokens(q.Description)
+		q.Tag = ftsTokens(q.Tag)
+		quizzes = append(quizzes, q)
+	}
+	d.Quiz = quizzes
+
+	extras := make([]DumpExtra, 0)
+	for _, ex := range d.Extra {
+		ex.ID = ""
+		ex.CreatedAt = ex.CreatedAt.UTC()
+		ex.UpdatedAt = ex.UpdatedAt.UTC()
+		extras = append(extras, ex)
+	}
+	d.Extra = extras
+
+	libs := make([]DumpLibrary, 0)
+	for _, lib := range d.Library {
+		lib.ID = ""
+		lib.CreatedAt = lib.CreatedAt.UTC()
+		lib.UpdatedAt = lib.UpdatedAt.UTC()
+		libs = append(libs, lib)
+	}
+	d.Library = libs
+
+	sentences := make([]DumpSentence, 0)
+	for _, s := range d.Sentence {
+		s.CreatedAt = s.CreatedAt.UTC()
+		s.UpdatedAt = s.UpdatedAt.UTC()
+		sentences = append(sentences, s)
+	}
+	d.Sentence = sentences
+
+	u := *d.User
+	u.UpdatedAt = u.UpdatedAt.UTC()
+	d.User = &u
+
+	return d
+}
+
+func TestImportRoundTrip(t *testing.T) {
+	db := exportTest(t)
+	d := exportOf(t, db, DefaultUserID)
+
+	if len(d.Quiz) != 2 || len(d.Extra) != 1 || len(d.Library) != 1 || len(d.Sentence) != 1 {
+		t.Fatalf("exported %+v", d)
+	}
+
+	res, err := Import(db, "p2", *d, ImportOverwrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := ImportResult{
+		Quiz:    ImportCount{Created: 2},
+		Extra:   ImportCount{Created: 1},
+		Library: ImportCount{Created: 1},
+		// Shared by all profiles
+		Sentence: ImportCount{Updated: 1},
+		User:     ImportCount{Updated: 1},
+	}
+	if *res != want {
+		t.Errorf("imported %+v, not %+v", *res, want)
+	}
+
+	if out := comparable(*exportOf(t, db, "p2")); !reflect.DeepEqual(out, comparable(*d)) {
+		t.Errorf("exported %+v after import, not %+v", out, comparable(*d))
+	}
+
+	// The default profile is as it was
+	if out := comparable(*exportOf(t, db, DefaultUserID)); !reflect.DeepEqual(out, comparable(*d)) {
+		t.Errorf("default profile is %+v, not %+v", out, comparable(*d))
+	}
+
+	v, err := Verify(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.OK() {
+		t.Errorf("FTS issues after import: %+v", v.Issues)
+	}
+
+	// Imported extra quizzes resolve to the imported extra
+	var english string
+	if r := db.Raw("SELECT english FROM quiz_q WHERE id = (SELECT id FROM quiz WHERE user_id = 'p2' AND source = 'extra')").Scan(&english); r.Error != nil || english != "long time" {
+		t.Errorf("extra quiz of p2 is indexed as %q: %v", english, r.Error)
+	}
+}
+
+func TestImportPolicy(t *testing.T) {
+	// modified is d, edited at time updatedAt
+	modified := func(d Dump, updatedAt time.Time) Dump {
+		d.Quiz = append([]DumpQuiz{}, d.Quiz...)
+		for i := range d.Quiz {
+			d.Quiz[i].UpdatedAt = updatedAt
+			d.Quiz[i].Tag = "t2"
+		}
+
+		d.Extra = append([]DumpExtra{}, d.Extra...)
+		for i := range d.Extra {
+			d.Extra[i].UpdatedAt = updatedAt
+			d.Extra[i].English = "long time no see"
+		}
+
+		d.Library = append([]DumpLibrary{}, d.Library...)
+		for i := range d.Library {
+			d.Library[i].UpdatedAt = updatedAt
+			d.Library[i].Tag = "b"
+		}
+
+		d.Sentence = append([]DumpSentence{}, d.Sentence...)
+		for i := range d.Sentence {
+			d.Sentence[i].UpdatedAt = updatedAt
+			d.Sentence[i].English = "hi"
+		}
+
+		u := *d.User
+		u.UpdatedAt = updatedAt
+		level := uint(5)
+		u.Meta.Level = &level
+		d.User = &u
+
+		return d
+	}
+
+	older := time.Now().Add(-24 * time.Hour)
+	newer := time.Now().Add(24 * time.Hour)
+
+	for _, c := range []struct {
+		policy  ImportPolicy
+		at      time.Time
+		updated bool
+	}{
+		{ImportSkip, newer, false},
+		{ImportOverwrite, older, true},
+		{ImportNewer, older, false},
+		{ImportNewer, newer, true},
+	} {
+		db := exportTest(t)
+		d := exportOf(t, db, DefaultUserID)
+
+		res, err := Import(db, DefaultUserID, modified(*d, c.at), c.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n := ImportCount{Skipped: 1}
+		n2 := ImportCount{Skipped: 2}
+		if c.updated {
+			n = ImportCount{Updated: 1}
+			n2 = ImportCount{Updated: 2}
+		}
+
+		want := ImportResult{Quiz: n2, Extra: n, Library: n, Sentence: n, User: n}
+		if *res != want {
+			t.Errorf("%s at %v: imported %+v, not %+v", c.policy, c.at, *res, want)
+		}
+
+		wantDump := *d
+		if c.updated {
+			wantDump = modified(*d, c.at)
+			// Reindexing adds level tags, and tags of the extra
+			for i := range wantDump.Quiz {
+				wantDump.Quiz[i].Tag = map[string]string{"vocab": "t2 level1", "extra": "t2 x level"}[wantDump.Quiz[i].Source]
+			}
+		}
+
+		if out := comparable(*exportOf(t, db, DefaultUserID)); !reflect.DeepEqual(out, comparable(wantDump)) {
+			t.Errorf("%s at %v: exported %+v, not %+v", c.policy, c.at, out, comparable(wantDump))
+		}
+
+		v, err := Verify(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !v.OK() {
+			t.Errorf("%s at %v: FTS issues %+v", c.policy, c.at, v.Issues)
+		}
+	}
+}
+
+// Import leaves FTS rows of other profiles as they are
+func TestImportReindexProfile(t *testing.T) {
+	db := exportTest(t)
+	d := exportOf(t, db, DefaultUserID)
+
+	if r := db.Exec("INSERT INTO quiz_q (id, entry) VALUES ('orphan', '猫')"); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+
+	if _, err := Import(db, "p2", *d, ImportSkip); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int64
+	if r := db.Raw("SELECT COUNT(*) FROM quiz_q WHERE id = 'orphan'").Scan(&n); r.Error != nil || n != 1 {
+		t.Errorf("FTS rows of other profiles are rebuilt: %v", r.Error)
+	}
+
+	// unlike RebuildFTS
+	if err := RebuildFTS(db); err != nil {
+		t.Fatal(err)
+	}
+	if r := db.Raw("SELECT COUNT(*) FROM quiz_q WHERE id = 'orphan'").Scan(&n); r.Error != nil || n != 0 {
+		t.Errorf("orphaned FTS row is not deleted: %v", r.Error)
+	}
+}
@@ -1,22 +1,22 @@
 package db
 
 import (
-	"errors"
-	"strings"
 	"time"
 
 	"github.com/jkomyno/nanoid"
-	"gopkg.in/yaml.v2"
 	"gorm.io/gorm"
 )
 
 // Extra is user database model for Extra
 type Extra struct {
 	ID        string    `gorm:"primarykey" json:"id"`
-	CreatedAt time.Time `json:"-"`
-	UpdatedAt time.Time `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
 
-	Chinese     string `gorm:"index:,unique;not null" json:"chinese"`
+	// UserID is the profile owning the entry, see User
+	UserID string `gorm:"index:idx_extra_user_chinese,unique;not null;default:'_'" json:"-"`
+
+	Chinese     string `gorm:"index:idx_extra_user_chinese,unique;not null" json:"chinese"`
 	Pinyin      string `json:"pinyin"`
 	English     string `gorm:"-" json:"english"`
 	Type        string `gorm:"-" json:"type"`
@@ -24,7 +24,7 @@ type Extra struct {
 	Tag         string `gorm:"-" json:"tag"`
 }
 
-// Create ensures q update
+// Create generates ID, if not set, and creates u, to be indexed by AfterCreate
 func (u *Extra) Create(tx *gorm.DB) error {
 	for u.ID == "" {
 		id, err := nanoid.Nanoid(6)
@@ -34,7 +34,7 @@ func (u *Extra) Create(tx *gorm.DB) error {
 
 		var count int64
 		if r := tx.Model(Extra{}).Where("id = ?", id).Count(&count); r.Error != nil {
-			return err
+			return r.Error
 		}
 
 		if count == 0 {
@@ -42,191 +42,32 @@ func (u *Extra) Create(tx *gorm.DB) error {
 		}
 	}
 
-	if r := tx.Create(u); r.Error != nil {
-		return r.Error
-	}
-
-	var old struct {
-		ID          string
-		Description string
-		Tag         string
-	}
-
-	if r := tx.Raw(`
-	SELECT extra_q.id ID, extra.description Description, extra_q.tag Tag
-	FROM extra_q
-	LEFT JOIN extra ON extra.id = extra_q.id
-	WHERE extra_q.id = ?
-	`, u.ID).Scan(&old); r.Error != nil && !errors.Is(r.Error, gorm.ErrRecordNotFound) {
-		return r.Error
-	}
-
-	descSet := map[string]bool{}
-	tagSet := map[string]bool{}
-
-	if old.ID != "" {
-		if strings.TrimSpace(old.Description) != "" {
-			var desc []string
-			e := yaml.Unmarshal([]byte(old.Description), &desc)
-			if e != nil {
-				descSet[old.Description] = true
-			} else {
-				for _, d := range desc {
-					descSet[d] = true
-				}
-			}
-		}
-
-		if strings.TrimSpace(old.Tag) != "" {
-			for _, t := range strings.Split(old.Tag, " ") {
-				tagSet[t] = true
-			}
-		}
-	}
-
-	if strings.TrimSpace(u.Description) != "" {
-		descSet[u.Description] = true
-	}
-
-	if strings.TrimSpace(u.Tag) != "" {
-		for _, t := range strings.Split(u.Tag, " ") {
-			tagSet[t] = true
-		}
-	}
-
-	description := func() string {
-		desc := make([]string, 0)
-		for k := range descSet {
-			desc = append(desc, k)
-		}
-
-		descByte, e := yaml.Marshal(desc)
-		if e != nil {
-			panic(e)
-		}
-
-		return string(descByte)
-	}()
-
-	descriptionParsed := parseChinese(description)
-
-	tags := make([]string, 0)
-	for k := range tagSet {
-		tags = append(tags, k)
-	}
-
-	old.Tag = strings.Join(tags, " ")
-
-	if old.ID != "" {
-		if r := tx.Exec(`
-		UPDATE extra SET description = @description WHERE id = @id
-		`, map[string]interface{}{
-			"description": description,
-			"id":          old.ID,
-		}); r.Error != nil {
-			return r.Error
-		}
-
-		if r := tx.Exec(`
-		UPDATE extra_q SET description = @description, tag = @tag WHERE id = @id
-		`, map[string]interface{}{
-			"description": descriptionParsed,
-			"tag":         old.Tag,
-			"id":          old.ID,
-		}); r.Error != nil {
-			return r.Error
-		}
-
-		if r := tx.Exec(`
-		UPDATE quiz_q SET pinyin = @pinyin, english = @english, description = @description, tag = @tag
-		WHERE entry = @chinese AND source = 'extra'
-		`, map[string]interface{}{
-			"chinese":     u.Chinese,
-			"pinyin":      parsePinyin(u.Pinyin),
-			"english":     u.English,
-			"description": descriptionParsed,
-			"tag":         old.Tag,
-			"id":          old.ID,
-		}); r.Error != nil {
-			return r.Error
-		}
-	} else {
-		if r := tx.Exec(`
-		INSERT INTO extra_q (id, chinese, pinyin, english, [type], description, tag)
-		SELECT @id, @chinese, @pinyin, @english, @type, @description, @tag
-		`, map[string]interface{}{
-			"id":          u.ID,
-			"chinese":     parseChinese(u.Chinese),
-			"pinyin":      parsePinyin(u.Pinyin),
-			"english":     u.English,
-			"type":        u.Type,
-			"description": descriptionParsed,
-			"tag":         old.Tag,
-		}); r.Error != nil {
-			return r.Error
-		}
-	}
-
-	return nil
+	return tx.Create(u).Error
 }
 
-// Update makes sure description and tag are always updated
+// Update makes sure description and tag are always updated, and AfterUpdate indexes u
 func (u *Extra) Update(tx *gorm.DB) error {
 	if u.Description == "" {
 		u.Description = " "
 	}
 
-	if r := tx.Updates(u); r.Error != nil {
-		return r.Error
-	}
-
-	if r := tx.Where("id = ?", u.ID).Updates(&u); r.Error != nil {
-		return r.Error
-	}
-
-	if r := tx.Exec(`
-	UPDATE extra_q
-	SET chinese = @chinese, pinyin = @pinyin, english = @english, [type] = @type, [description] = @description, tag = @tag
-	WHERE id = @id
-	`, map[string]interface{}{
-		"id":          u.ID,
-		"chinese":     parseChinese(u.Chinese),
-		"pinyin":      parsePinyin(u.Pinyin),
-		"english":     u.English,
-		"type":        u.Type,
-		"description": parseChinese(u.Description),
-		"tag":         u.Tag,
-	}); r.Error != nil {
-		return r.Error
+	if u.Tag == "" {
+		u.Tag = " "
 	}
 
-	if r := tx.Exec(`
-	UPDATE quiz_q SET pinyin = @pinyin, english = @english, description = @description, tag = @tag, type = @type
-	WHERE entry = @chinese AND source = 'extra'
-	`, map[string]interface{}{
-		"chinese":     u.Chinese,
-		"type":        u.Type,
-		"pinyin":      parsePinyin(u.Pinyin),
-		"english":     u.English,
-		"description": parseChinese(u.Description),
-		"tag":         u.Tag,
-		"id":          u.ID,
-	}); r.Error != nil {
-		return r.Error
-	}
-
-	return nil
+	return tx.Updates(u).Error
 }
 
-// Delete ensures q delete and quiz delete
+// Delete deletes u, and its quizzes. AfterDelete deletes extra_q row.
 func (u *Extra) Delete(tx *gorm.DB) error {
 	var content struct {
+		UserID  string
 		Chinese string
 		Type    string
 	}
 
 	if r := tx.Raw(`
-	SELECT extra.chinese Chinese, extra_q.type [Type]
+	SELECT extra.user_id UserID, extra.chinese Chinese, extra_q.type [Type]
 	FROM extra
 	LEFT JOIN extra_q ON extra_q.id = extra.id
 	WHERE extra.id = ?
@@ -234,6 +75,7 @@ func (u *Extra) Delete(tx *gorm.DB) error {
 		return r.Error
 	}
 
+	u.UserID = content.UserID
 	u.Chinese = content.Chinese
 	u.Type = content.Type
 
@@ -241,14 +83,8 @@ func (u *Extra) Delete(tx *gorm.DB) error {
 		return r.Error
 	}
 
-	if r := tx.Exec(`
-	DELETE FROM extra_q
-	WHERE id = ?
-	`, u.ID); r.Error != nil {
-		return r.Error
-	}
-
-	if r := tx.Where("entry = @entry AND [type] = @type AND source = @source", map[string]interface{}{
+	if r := tx.Where("user_id = @userID AND entry = @entry AND [type] = @type AND source = @source", map[string]interface{}{
+		"userID": u.UserID,
 		"entry":  u.Chinese,
 		"type":   u.Type,
 		"source": "extra",
@@ -0,0 +1,399 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Quiz, Extra, Library and Sentence each have an FTS table, named <table>_q, which is written only here,
+// except by Import, which reindexes the profile after.
+// Main rows are indexed by gorm hooks, in the same transaction, so that callers need not;
+// except that Quiz is not reindexed on update, as its indexed columns do not change after create,
+// and Sentence is indexed on create by CreateSentences.
+// Columns only stored in FTS tables (e.g. Quiz.Tag) must be set on the model when it is created or updated.
+// See Verify for checking, and RebuildFTS for repairing.
+
+// indexed is a model with an FTS table
+type indexed interface {
+	ftsTable() string
+	// ftsValues are columns of the FTS row, keyed by column name, including id
+	ftsValues(tx *gorm.DB) (map[string]interface{}, error)
+}
+
+// index replaces the FTS row of m, unless its main row is gone
+func index(tx *gorm.DB, m indexed) error {
+	values, err := m.ftsValues(tx)
+	if err != nil {
+		return err
+	}
+
+	table := m.ftsTable()
+
+	if r := tx.Exec("DELETE FROM "+table+" WHERE id = ?", values["id"]); r.Error != nil {
+		return r.Error
+	}
+
+	cols := make([]string, 0, len(values))
+	for k := range values {
+		cols = append(cols, k)
+	}
+	sort.Strings(cols)
+
+	params := make([]string, 0, len(cols))
+	for i, k := range cols {
+		params = append(params, "@"+k)
+		cols[i] = "[" + k + "]"
+	}
+
+	if r := tx.Exec(fmt.Sprintf(
+		"INSERT INTO %s (%s) SELECT %s WHERE EXISTS (SELECT 1 FROM %s WHERE id = @id)",
+		table, strings.Join(cols, ", "), strings.Join(params, ", "), strings.TrimSuffix(table, "_q"),
+	), values); r.Error != nil {
+		return r.Error
+	}
+
+	return nil
+}
+
+// unindex deletes the FTS row of a deleted main row.
+// If id is unknown, e.g. on bulk delete, it deletes all FTS rows without main rows.
+func unindex(tx *gorm.DB, table string, id string) error {
+	if id == "" {
+		return tx.Exec(fmt.Sprintf(
+			"DELETE FROM %s WHERE id NOT IN (SELECT id FROM %s)",
+			table, strings.TrimSuffix(table, "_q"),
+		)).Error
+	}
+
+	return tx.Exec("DELETE FROM "+table+" WHERE id = ?", id).Error
+}
+
+// Index writes quiz_q, merging Description and Tag with the existing row
+func (q *Quiz) Index(tx *gorm.DB) error {
+	return index(tx, q)
+}
+
+// AfterCreate indexes q
+func (q *Quiz) AfterCreate(tx *gorm.DB) error {
+	return index(tx, q)
+}
+
+// AfterDelete deletes quiz_q row and review logs of q, or of all deleted quizzes on bulk delete
+func (q *Quiz) AfterDelete(tx *gorm.DB) error {
+	if e := unindex(tx, q.ftsTable(), q.ID); e != nil {
+		return e
+	}
+
+	if q.ID == "" {
+		return tx.Exec("DELETE FROM review_log WHERE quiz_id NOT IN (SELECT id FROM quiz)").Error
+	}
+
+	return tx.Where("quiz_id = ?", q.ID).Delete(&ReviewLog{}).Error
+}
+
+func (q *Quiz) ftsTable() string {
+	return "quiz_q"
+}
+
+// reLevelTag matches level tags of quiz_q, which are set by the indexer, rather than by the user
+var reLevelTag = regexp.MustCompile(`^level\d*$`)
+
+// ftsValues are quiz_q columns of q, without writing
+func (q *Quiz) ftsValues(tx *gorm.DB) (map[string]interface{}, error) {
+	var old struct {
+		ID          string
+		Description string
+		Tag         string
+	}
+
+	if r := tx.Raw(`
+	SELECT ID, Description, Tag
+	FROM quiz_q
+	WHERE id = ?
+	`, q.ID).Scan(&old); r.Error != nil && !errors.Is(r.Error, gorm.ErrRecordNotFound) {
+		return nil, r.Error
+	}
+
+	return q.ftsValuesWith(tx, old.Description, old.Tag)
+}
+
+// ftsValuesWith are quiz_q columns of q, merging Description and Tag with oldDescription and oldTag
+func (q *Quiz) ftsValuesWith(tx *gorm.DB, oldDescription string, oldTag string) (map[string]interface{}, error) {
+	descSet := map[string]bool{}
+	tagSet := map[string]bool{}
+
+	if strings.TrimSpace(oldDescription) != "" {
+		for _, d := range strings.Split(oldDescription, " ") {
+			descSet[d] = true
+		}
+	}
+
+	if strings.TrimSpace(oldTag) != "" {
+		for _, t := range strings.Split(oldTag, " ") {
+			tagSet[t] = true
+		}
+	}
+
+	if strings.TrimSpace(q.Description) != "" {
+		for _, d := range strings.Split(parseChinese(q.Description), " ") {
+			descSet[d] = true
+		}
+	}
+
+	if strings.TrimSpace(q.Tag) != "" {
+		for _, d := range strings.Split(parseChinese(q.Tag), " ") {
+			tagSet[d] = true
+		}
+	}
+
+	c, err := q.Resolve(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range c.Description {
+		if strings.TrimSpace(d) != "" {
+			for _, k := range strings.Split(parseChinese(d), " ") {
+				descSet[k] = true
+			}
+		}
+	}
+
+	for _, t := range c.Tag {
+		if strings.TrimSpace(t) != "" {
+			for _, k := range strings.Split(parseChinese(t), " ") {
+				tagSet[k] = true
+			}
+		}
+	}
+
+	entry := strings.Join(c.Entries, " ")
+	pinyin := strings.Join(c.Pinyin, " ")
+	english := strings.Join(c.English, " ")
+	level := c.Level
+
+	desc := make([]string, 0)
+	for k := range descSet {
+		desc = append(desc, k)
+	}
+
+	tags := make([]string, 0)
+	for k := range tagSet {
+		if !reLevelTag.MatchString(k) {
+			tags = append(tags, k)
+		}
+	}
+
+	tags = append(tags, "level"+level)
+
+	return map[string]interface{}{
+		"id":          q.ID,
+		"entry":       parseChinese(entry),
+		"type":        q.Type,
+		"direction":   q.Direction,
+		"source":      q.Source,
+		"pinyin":      parsePinyin(pinyin),
+		"english":     english,
+		"description": strings.Join(desc, " "),
+		"tag":         strings.Join(tags, " "),
+	}, nil
+}
+
+// Index replaces extra_q row with u
+func (u *Extra) Index(tx *gorm.DB) error {
+	return index(tx, u)
+}
+
+// AfterCreate indexes u, and quizzes resolving to it
+func (u *Extra) AfterCreate(tx *gorm.DB) error {
+	return u.reindex(tx)
+}
+
+// AfterUpdate indexes u, and quizzes resolving to it, unless updated in bulk
+func (u *Extra) AfterUpdate(tx *gorm.DB) error {
+	if u.ID == "" {
+		return nil
+	}
+
+	return u.reindex(tx)
+}
+
+// AfterDelete deletes extra_q row of u, or of all deleted extras on bulk delete
+func (u *Extra) AfterDelete(tx *gorm.DB) error {
+	return unindex(tx, u.ftsTable(), u.ID)
+}
+
+// reindex indexes u, with main columns as saved, which may be partly updated, and quizzes of source extra.
+// English, Type and Tag are kept from the existing extra_q row, where empty in u.
+func (u *Extra) reindex(tx *gorm.DB) error {
+	saved := Extra{}
+	if r := tx.Where("id = ?", u.ID).First(&saved); r.Error != nil {
+		if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return r.Error
+	}
+
+	var old struct {
+		English string
+		Type    string
+		Tag     string
+	}
+
+	if r := tx.Raw(`
+	SELECT english [English], [type] [Type], tag [Tag]
+	FROM extra_q
+	WHERE id = ?
+	`, u.ID).Scan(&old); r.Error != nil {
+		return r.Error
+	}
+
+	saved.English = ifEmpty(u.English, old.English)
+	saved.Type = ifEmpty(u.Type, old.Type)
+	saved.Tag = ifEmpty(u.Tag, old.Tag)
+
+	if e := index(tx, &saved); e != nil {
+		return e
+	}
+
+	var quizzes []Quiz
+	if r := tx.Where("user_id = ? AND entry = ? AND source = 'extra'", saved.UserID, saved.Chinese).Find(&quizzes); r.Error != nil {
+		return r.Error
+	}
+
+	for i := range quizzes {
+		if e := index(tx, &quizzes[i]); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+func (u *Extra) ftsTable() string {
+	return "extra_q"
+}
+
+// ftsValues are extra_q columns of u
+func (u *Extra) ftsValues(tx *gorm.DB) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"id":          u.ID,
+		"chinese":     parseChinese(u.Chinese),
+		"pinyin":      parsePinyin(u.Pinyin),
+		"english":     u.English,
+		"type":        u.Type,
+		"description": parseChinese(u.Description),
+		"tag":         u.Tag,
+	}, nil
+}
+
+// Index replaces library_q row with u
+func (u *Library) Index(tx *gorm.DB) error {
+	return index(tx, u)
+}
+
+// AfterCreate indexes u
+func (u *Library) AfterCreate(tx *gorm.DB) error {
+	return index(tx, u)
+}
+
+// AfterUpdate indexes u, with main columns as saved, unless updated in bulk.
+// Tag is kept from the existing library_q row, where empty in u.
+func (u *Library) AfterUpdate(tx *gorm.DB) error {
+	if u.ID == "" {
+		return nil
+	}
+
+	saved := Library{}
+	if r := tx.Where("id = ?", u.ID).First(&saved); r.Error != nil {
+		if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return r.Error
+	}
+
+	var old struct {
+		Tag string
+	}
+
+	if r := tx.Raw("SELECT tag [Tag] FROM library_q WHERE id = ?", u.ID).Scan(&old); r.Error != nil {
+		return r.Error
+	}
+
+	saved.Tag = ifEmpty(u.Tag, old.Tag)
+
+	return index(tx, &saved)
+}
+
+// AfterDelete deletes library_q row of u, or of all deleted libraries on bulk delete
+func (u *Library) AfterDelete(tx *gorm.DB) error {
+	return unindex(tx, u.ftsTable(), u.ID)
+}
+
+func (u *Library) ftsTable() string {
+	return "library_q"
+}
+
+// ftsValues are library_q columns of u
+func (u *Library) ftsValues(tx *gorm.DB) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"id":          u.ID,
+		"title":       u.Title,
+		"entry":       strings.Join(u.Entries, " "),
+		"description": parseChinese(u.Description),
+		"tag":         u.Tag,
+	}, nil
+}
+
+// AfterUpdate indexes s, with columns as saved, unless updated in bulk
+func (s *Sentence) AfterUpdate(tx *gorm.DB) error {
+	if s.ID == 0 {
+		return nil
+	}
+
+	saved := Sentence{}
+	if r := tx.Where("id = ?", s.ID).First(&saved); r.Error != nil {
+		if errors.Is(r.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return r.Error
+	}
+
+	return saved.Index(tx)
+}
+
+// AfterDelete deletes sentence_q row of s, or of all deleted sentences on bulk delete.
+// Sentences are soft deleted, so that their main rows are kept.
+func (s *Sentence) AfterDelete(tx *gorm.DB) error {
+	if s.ID == 0 {
+		return tx.Exec("DELETE FROM sentence_q WHERE id NOT IN (SELECT id FROM sentence WHERE deleted_at IS NULL)").Error
+	}
+
+	return tx.Exec("DELETE FROM sentence_q WHERE id = ?", s.ID).Error
+}
+
+func (s *Sentence) ftsTable() string {
+	return "sentence_q"
+}
+
+// ftsValues computes Level, and sentence_q columns of s
+func (s *Sentence) ftsValues(tx *gorm.DB) (map[string]interface{}, error) {
+	level, pinyin, err := sentenceLevel(s.Chinese)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Level = level
+
+	return map[string]interface{}{
+		"id":      s.ID,
+		"chinese": parseChinese(s.Chinese),
+		"pinyin":  parsePinyin(pinyin),
+		"english": s.English,
+	}, nil
+}
@@ -0,0 +1,237 @@
+package db
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// ftsWant is an FTS row expected after a step, or no row if cols is nil.
+// Only columns in cols are compared, as by Verify.
+type ftsWant struct {
+	table string
+	id    interface{}
+	cols  map[string]string
+}
+
+func TestIndexLockstep(t *testing.T) {
+	dir := setupTest(t)
+	db := openTest(t, dir, "")
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, step := range []struct {
+		name string
+		do   func(tx *gorm.DB) error
+		want []ftsWant
+	}{
+		{
+			name: "create quiz",
+			do: func(tx *gorm.DB) error {
+				return (&Quiz{ID: "q1", Entry: "你好", Type: "vocab", Direction: "se", Source: "vocab", Tag: "t1"}).Create(tx)
+			},
+			want: []ftsWant{
+				{"quiz_q", "q1", map[string]string{"entry": "你好", "english": "hello", "type": "vocab", "tag": "t1 level1"}},
+			},
+		},
+		{
+			name: "update quiz",
+			do: func(tx *gorm.DB) error {
+				return tx.Model(&Quiz{ID: "q1"}).Update("srs_level", 1).Error
+			},
+			want: []ftsWant{
+				{"quiz_q", "q1", map[string]string{"english": "hello", "tag": "t1 level1"}},
+			},
+		},
+		{
+			name: "partly update quiz",
+			do: func(tx *gorm.DB) error {
+				q := Quiz{}
+				if r := tx.Where("id = ?", "q1").First(&q); r.Error != nil {
+					return r.Error
+				}
+
+				q.Tag = "t2"
+				return q.Index(tx)
+			},
+			want: []ftsWant{
+				{"quiz_q", "q1", map[string]string{"english": "hello", "tag": "t1 t2 level1"}},
+			},
+		},
+		{
+			name: "delete quiz",
+			do: func(tx *gorm.DB) error {
+				return (&Quiz{ID: "q1"}).Delete(tx)
+			},
+			want: []ftsWant{
+				{"quiz_q", "q1", nil},
+			},
+		},
+		{
+			name: "create extra",
+			do: func(tx *gorm.DB) error {
+				if e := (&Extra{ID: "e1", Chinese: "好久", Pinyin: "hao3 jiu3", English: "long time", Type: "vocab", Tag: "x"}).Create(tx); e != nil {
+					return e
+				}
+
+				return (&Quiz{ID: "q2", Entry: "好久", Type: "vocab", Direction: "se", Source: "extra"}).Create(tx)
+			},
+			want: []ftsWant{
+				{"extra_q", "e1", map[string]string{"chinese": "好久", "english": "long time", "type": "vocab", "tag": "x"}},
+				{"quiz_q", "q2", map[string]string{"english": "long time", "tag": "x level"}},
+			},
+		},
+		{
+			name: "update extra",
+			do: func(tx *gorm.DB) error {
+				return (&Extra{ID: "e1", Chinese: "好久", Pinyin: "hao3 jiu3", English: "long time no see", Type: "vocab", Tag: "y"}).Update(tx)
+			},
+			want: []ftsWant{
+				{"extra_q", "e1", map[string]string{"english": "long time no see", "type": "vocab", "tag": "y"}},
+				{"quiz_q", "q2", map[string]string{"english": "long time no see", "tag": "x y level"}},
+			},
+		},
+		{
+			name: "partly update extra",
+			do: func(tx *gorm.DB) error {
+				return tx.Model(&Extra{ID: "e1"}).Update("description", "好").Error
+			},
+			want: []ftsWant{
+				{"extra_q", "e1", map[string]string{"english": "long time no see", "type": "vocab", "description": "好", "tag": "y"}},
+				{"quiz_q", "q2", map[string]string{"english": "long time no see", "description": "好"}},
+			},
+		},
+		{
+			name: "update extra without type and tag",
+			do: func(tx *gorm.DB) error {
+				return (&Extra{ID: "e1", Chinese: "好久", English: "a long time"}).Update(tx)
+			},
+			want: []ftsWant{
+				{"extra_q", "e1", map[string]string{"english": "a long time", "type": "vocab", "tag": ""}},
+				{"quiz_q", "q2", map[string]string{"english": "a long time"}},
+			},
+		},
+		{
+			name: "delete extra",
+			do: func(tx *gorm.DB) error {
+				return (&Extra{ID: "e1"}).Delete(tx)
+			},
+			want: []ftsWant{
+				{"extra_q", "e1", nil},
+				{"quiz_q", "q2", nil},
+			},
+		},
+		{
+			name: "create library",
+			do: func(tx *gorm.DB) error {
+				return (&Library{ID: "l1", Title: "L", Entries: StringArray{"你好"}, Tag: "a"}).Create(tx)
+			},
+			want: []ftsWant{
+				{"library_q", "l1", map[string]string{"title": "L", "entry": "你好", "tag": "a"}},
+			},
+		},
+		{
+			name: "update library",
+			do: func(tx *gorm.DB) error {
+				return (&Library{ID: "l1", Title: "L2", Entries: StringArray{"你好", "好久"}, Tag: "b"}).Update(tx)
+			},
+			want: []ftsWant{
+				{"library_q", "l1", map[string]string{"title": "L2", "entry": "你好 好久", "tag": "b"}},
+			},
+		},
+		{
+			name: "partly update library",
+			do: func(tx *gorm.DB) error {
+				return tx.Model(&Library{ID: "l1"}).Update("description", "好").Error
+			},
+			want: []ftsWant{
+				{"library_q", "l1", map[string]string{"title": "L2", "description": "好", "tag": "b"}},
+			},
+		},
+		{
+			name: "delete library",
+			do: func(tx *gorm.DB) error {
+				return (&Library{ID: "l1"}).Delete(tx)
+			},
+			want: []ftsWant{
+				{"library_q", "l1", nil},
+			},
+		},
+		{
+			name: "create sentence",
+			do: func(tx *gorm.DB) error {
+				_, e := CreateSentences(tx, []Sentence{{Model: gorm.Model{ID: 1}, Chinese: "你好", English: "hello"}})
+				return e
+			},
+			want: []ftsWant{
+				{"sentence_q", 1, map[string]string{"chinese": "你好", "english": "hello"}},
+			},
+		},
+		{
+			name: "update sentence",
+			do: func(tx *gorm.DB) error {
+				return tx.Model(&Sentence{Model: gorm.Model{ID: 1}}).Updates(Sentence{Chinese: "你好吗", English: "how are you"}).Error
+			},
+			want: []ftsWant{
+				{"sentence_q", 1, map[string]string{"chinese": "你好 吗", "english": "how are you"}},
+			},
+		},
+		{
+			name: "partly update sentence",
+			do: func(tx *gorm.DB) error {
+				return tx.Model(&Sentence{Model: gorm.Model{ID: 1}}).Update("english", "how do you do").Error
+			},
+			want: []ftsWant{
+				{"sentence_q", 1, map[string]string{"chinese": "你好 吗", "english": "how do you do"}},
+			},
+		},
+		{
+			name: "delete sentence",
+			do: func(tx *gorm.DB) error {
+				return tx.Delete(&Sentence{Model: gorm.Model{ID: 1}}).Error
+			},
+			want: []ftsWant{
+				{"sentence_q", 1, nil},
+			},
+		},
+	} {
+		if err := db.Transaction(step.do); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		res, err := Verify(db)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if !res.OK() {
+			t.Errorf("%s: FTS issues %+v", step.name, res.Issues)
+		}
+
+		for _, w := range step.want {
+			var rows []map[string]interface{}
+			if r := db.Raw("SELECT * FROM "+w.table+" WHERE id = ?", w.id).Find(&rows); r.Error != nil {
+				t.Fatalf("%s: %v", step.name, r.Error)
+			}
+
+			if w.cols == nil {
+				if len(rows) != 0 {
+					t.Errorf("%s: %s %v is not deleted", step.name, w.table, w.id)
+				}
+				continue
+			}
+
+			if len(rows) != 1 {
+				t.Errorf("%s: %s %v has %d rows", step.name, w.table, w.id, len(rows))
+				continue
+			}
+
+			for k, want := range w.cols {
+				if got := ftsTokens(rows[0][k]); got != ftsTokens(want) {
+					t.Errorf("%s: %s %v %s is %q, not %q", step.name, w.table, w.id, k, got, want)
+				}
+			}
+		}
+	}
+}
@@ -1,13 +1,13 @@
 package db
 
 import (
-	"errors"
 	"log"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/wangbin/jiebago"
+	"github.com/zhquiz/go-zhquiz/server/pinyin"
 	"github.com/zhquiz/go-zhquiz/server/zh"
 	"github.com/zhquiz/go-zhquiz/shared"
 	"gorm.io/driver/sqlite"
@@ -20,7 +20,25 @@ var zhDB zh.DB
 
 // DB is the storage for current DB
 type DB struct {
-	Current *gorm.DB
+	// current is shared by copies of DB, so that Restore can swap it
+	current *current
+
+	// stop stops StartBackups, on Close
+	stop chan struct{}
+}
+
+// current guards the handle of data.db, which is replaced by Restore
+type current struct {
+	sync.RWMutex
+	db *gorm.DB
+}
+
+// Current is the handle of data.db. After Restore, it is the reopened one.
+func (d DB) Current() *gorm.DB {
+	d.current.RLock()
+	defer d.current.RUnlock()
+
+	return d.current.db
 }
 
 // Connect connects to DATABASE_URL
@@ -30,141 +48,63 @@ func Connect() DB {
 
 	output := DB{}
 
-	db, err := gorm.Open(sqlite.Open(filepath.Join(shared.UserDataDir(), "data.db")), &gorm.Config{
-		NamingStrategy: schema.NamingStrategy{
-			SingularTable: true,
-		},
-	})
+	db, err := open(filepath.Join(shared.UserDataDir(), "data.db"))
 	if err != nil {
 		log.Fatalln(err)
 	}
 
 	output = DB{
-		Current: db,
+		current: &current{db: db},
+		stop:    make(chan struct{}),
 	}
 
-	output.Current.AutoMigrate(
-		&User{},
-		&Quiz{},
-		&Extra{},
-		&Library{},
-		&Sentence{},
-	)
+	if e := Migrate(output.Current()); e != nil {
+		log.Fatalln(e)
+	}
 
 	var nUser int64
 
-	if r := output.Current.Model(&User{}).Count(&nUser); r.Error != nil {
+	if r := output.Current().Model(&User{}).Count(&nUser); r.Error != nil {
 		panic(r.Error)
 	}
 
 	if nUser == 0 {
-		if r := output.Current.Create(&User{}); r.Error != nil {
+		if r := output.Current().Create(&User{}); r.Error != nil {
 			panic(r.Error)
 		}
 	}
 
-	if r := output.Current.Raw("SELECT Name FROM sqlite_master WHERE type='table' AND name='quiz_q'").First(&struct {
-		Name string
-	}{}); r.Error != nil {
-		if errors.Is(r.Error, gorm.ErrRecordNotFound) {
-			output.Current.Exec(`
-			CREATE VIRTUAL TABLE "quiz_q" USING fts5 (
-				[id], [entry], [pinyin], [english], [description], [tag],
-				[type], [direction], [source]
-			);
-			`)
-
-			var quizzes []Quiz
-			output.Current.Find(&quizzes)
-
-			output.Current.Transaction(func(tx *gorm.DB) error {
-				for _, q := range quizzes {
-					q.Create(tx)
-				}
-
-				return nil
-			})
-		} else {
-			log.Fatalln(r.Error)
-		}
+	return output
+}
+
+func open(path string) (*gorm.DB, error) {
+	return gorm.Open(sqlite.Open(path), &gorm.Config{
+		NamingStrategy: schema.NamingStrategy{
+			SingularTable: true,
+		},
+	})
+}
+
+// Close stops backups, checkpoints WAL, if any, and closes the database
+func (d DB) Close() error {
+	if d.stop != nil {
+		close(d.stop)
 	}
 
-	if r := output.Current.Raw("SELECT Name FROM sqlite_master WHERE type='table' AND name='extra_q'").First(&struct {
-		Name string
-	}{}); r.Error != nil {
-		if errors.Is(r.Error, gorm.ErrRecordNotFound) {
-			output.Current.Exec(`
-			CREATE VIRTUAL TABLE extra_q USING fts5(
-				[id],
-				[chinese],
-				[pinyin],
-				[english],
-				[type],
-				[description],
-				[tag]
-			);
-			`)
-
-			var extras []Extra
-			output.Current.Find(&extras)
-
-			output.Current.Transaction(func(tx *gorm.DB) error {
-				for _, ex := range extras {
-					ex.Create(tx)
-				}
-
-				return nil
-			})
-		} else {
-			log.Fatalln(r.Error)
-		}
+	return closeDB(d.Current())
+}
+
+func closeDB(db *gorm.DB) error {
+	if r := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); r.Error != nil {
+		return r.Error
 	}
 
-	if r := output.Current.Raw("SELECT Name FROM sqlite_master WHERE type='table' AND name='library_q'").First(&struct {
-		Name string
-	}{}); r.Error != nil {
-		if errors.Is(r.Error, gorm.ErrRecordNotFound) {
-			output.Current.Exec(`
-			CREATE VIRTUAL TABLE library_q USING fts5(
-				[id],
-				[title],
-				[entry],
-				[description],
-				[tag]
-			);
-			`)
-
-			if e := output.Current.Transaction(func(tx *gorm.DB) error {
-				var libs []map[string]interface{}
-				if r := zhDB.Current.Raw("SELECT title, entries FROM library").Find(&libs); r.Error != nil {
-					log.Fatalln(r.Error)
-				}
-
-				for _, a := range libs {
-					lib := Library{
-						ID:    " " + a["title"].(string),
-						Title: a["title"].(string),
-					}
-
-					if e := lib.Entries.Scan(a["entries"]); e != nil {
-						return e
-					}
-
-					if e := lib.Create(tx); e != nil {
-						return e
-					}
-				}
-
-				return nil
-			}); e != nil {
-				panic(e)
-			}
-		} else {
-			log.Fatalln(r.Error)
-		}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
 	}
 
-	return output
+	return sqlDB.Close()
 }
 
 func parseChinese(s string) string {
@@ -182,13 +122,14 @@ func parseChinese(s string) string {
 	return strings.Join(out, " ")
 }
 
+// parsePinyin makes pinyin searchable both with and without tones, e.g. "nǐhǎo" as "ni hao ni3 hao3"
 func parsePinyin(s string) string {
-	out := make([]string, 0)
-	re := regexp.MustCompile(`\d+$`)
+	toneless := pinyin.Toneless(s)
+	numbered := pinyin.Numbered(s)
 
-	for _, c := range strings.Split(s, " ") {
-		out = append(out, re.ReplaceAllString(c, ""))
+	if numbered == toneless {
+		return toneless
 	}
 
-	return strings.Join(out, " ")
+	return toneless + " " + numbered
 }
@@ -0,0 +1,21 @@
+package db
+
+import "testing"
+
+func TestParsePinyin(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want string
+	}{
+		{"nǐhǎo", "ni hao ni3 hao3"},
+		{"ni3 hao3", "ni hao ni3 hao3"},
+		{"ni hao", "ni hao"},
+		{"lüè", "lve lve4"},
+		{"ㄋㄧˇㄏㄠˇ", "ni hao ni3 hao3"},
+		{"", ""},
+	} {
+		if out := parsePinyin(c.in); out != c.want {
+			t.Errorf("%q is %q, not %q", c.in, out, c.want)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package db
 
 import (
-	"strings"
 	"time"
 
 	"github.com/jkomyno/nanoid"
@@ -14,13 +13,16 @@ type Library struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 
+	// UserID is the profile owning the entry, see User
+	UserID string `gorm:"index:idx_library_user_title,unique;not null;default:'_'" json:"-"`
+
 	Title       string      `gorm:"index:idx_library_user_title,unique;not null" json:"title"`
 	Entries     StringArray `json:"entries"`
 	Description string      `json:"description"`
 	Tag         string      `gorm:"-" json:"tag"`
 }
 
-// Create creates along with q
+// Create generates ID, if not set, and creates u, to be indexed by AfterCreate
 func (u *Library) Create(tx *gorm.DB) error {
 	for u.ID == "" {
 		id, err := nanoid.Nanoid(6)
@@ -30,7 +32,7 @@ func (u *Library) Create(tx *gorm.DB) error {
 
 		var count int64
 		if r := tx.Model(Library{}).Where("id = ?", id).Count(&count); r.Error != nil {
-			return err
+			return r.Error
 		}
 
 		if count == 0 {
@@ -38,70 +40,23 @@ func (u *Library) Create(tx *gorm.DB) error {
 		}
 	}
 
-	if r := tx.Create(u); r.Error != nil {
-		return r.Error
-	}
-
-	if r := tx.Exec(`
-	INSERT INTO library_q (id, title, [entry], [description], tag)
-	SELECT @id, @title, @entry, @description, @tag
-	WHERE EXISTS (SELECT 1 FROM library WHERE id = @id)
-	`, map[string]interface{}{
-		"id":          u.ID,
-		"title":       u.Title,
-		"entry":       strings.Join(u.Entries, " "),
-		"description": parseChinese(u.Description),
-		"tag":         u.Tag,
-	}); r.Error != nil {
-		return r.Error
-	}
-
-	return nil
+	return tx.Create(u).Error
 }
 
-// Update makes sure description and tag are always updated
+// Update makes sure description and tag are always updated, and AfterUpdate indexes u
 func (u *Library) Update(tx *gorm.DB) error {
 	if u.Description == "" {
 		u.Description = " "
 	}
 
-	if r := tx.Updates(u); r.Error != nil {
-		return r.Error
-	}
-
-	if r := tx.Where("id = ?", u.ID).Updates(&u); r.Error != nil {
-		return r.Error
-	}
-
-	if r := tx.Exec(`
-	UPDATE library_q
-	SET title = @title, entry = @entry, [description] = @description, tag = @tag
-	WHERE id = @id
-	`, map[string]interface{}{
-		"id":          u.ID,
-		"title":       u.Title,
-		"entry":       strings.Join(u.Entries, " "),
-		"description": parseChinese(u.Description),
-		"tag":         u.Tag,
-	}); r.Error != nil {
-		return r.Error
+	if u.Tag == "" {
+		u.Tag = " "
 	}
 
-	return nil
+	return tx.Updates(u).Error
 }
 
-// Delete ensures q delete
+// Delete deletes u, and AfterDelete deletes its library_q row
 func (u *Library) Delete(tx *gorm.DB) error {
-	if r := tx.Delete(u); r.Error != nil {
-		return r.Error
-	}
-
-	if r := tx.Exec(`
-	DELETE FROM library_q
-	WHERE id = ?
-	`, u.ID); r.Error != nil {
-		return r.Error
-	}
-
-	return nil
+	return tx.Delete(u).Error
 }
@@ -0,0 +1,363 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SchemaVersion records an applied migration, in schema_version table
+type SchemaVersion struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// migration is a numbered up-step of the schema.
+// Databases from before schema_version start at 0, so steps must also check for what already exists.
+type migration struct {
+	Version int
+	Name    string
+	// Up may be nil, for steps that only reindex
+	Up func(tx *gorm.DB) error
+	// Reindex is whether FTS tables must be rebuilt after the step.
+	// Indexing uses the models, so it is done once by RebuildFTS, with the last pending step,
+	// when the schema is at LatestSchemaVersion, rather than by the step itself.
+	Reindex bool
+}
+
+// migrations are in order of Version, which must not be reused.
+// To change the schema, append a step, rather than editing an existing one.
+// Steps define tables by snapshots or SQL, rather than by the models, which change; see TestMigrateNew.
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "create tables",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(
+				&v1User{},
+				&v1Quiz{},
+				&v1Extra{},
+				&v1Library{},
+				&v1Sentence{},
+				&v1ReviewLog{},
+			)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create FTS tables",
+		Up:      migrateFTS,
+		Reindex: true,
+	},
+	{
+		Version: 3,
+		Name:    "widen unique indexes with user_id, for profiles",
+		Up:      migrateProfiles,
+	},
+	{
+		Version: 4,
+		Name:    "index sentences saved before sentence_q",
+		Reindex: true,
+	},
+	{
+		Version: 5,
+		Name:    "index pinyin with tone numbers",
+		Reindex: true,
+	},
+}
+
+// LatestSchemaVersion is the version that Migrate brings data.db to
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// CurrentSchemaVersion gets the version of the last applied migration, or 0 if none
+func CurrentSchemaVersion(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&SchemaVersion{}) {
+		return 0, nil
+	}
+
+	var v SchemaVersion
+	if r := db.Order("version DESC").Limit(1).Find(&v); r.Error != nil {
+		return 0, r.Error
+	}
+
+	return v.Version, nil
+}
+
+// Migrate applies pending migrations, each in its own transaction,
+// after backing up data.db, unless it is new.
+func Migrate(db *gorm.DB) error {
+	if e := db.AutoMigrate(&SchemaVersion{}); e != nil {
+		return e
+	}
+
+	current, e := CurrentSchemaVersion(db)
+	if e != nil {
+		return e
+	}
+
+	if current > LatestSchemaVersion() {
+		return fmt.Errorf("data.db is at schema version %d, newer than this app (%d)", current, LatestSchemaVersion())
+	}
+
+	if current == LatestSchemaVersion() {
+		return nil
+	}
+
+	// New databases have nothing to back up
+	if db.Migrator().HasTable(&User{}) {
+		b, e := backup(db, fmt.Sprintf("migration-v%d", current))
+		if e != nil {
+			return fmt.Errorf("cannot back up before migration: %w", e)
+		}
+		log.Printf("Backed up data.db to %s, before migrating from schema version %d\n", b.Name, current)
+	}
+
+	reindex := false
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		reindex = reindex || m.Reindex
+
+		if e := db.Transaction(func(tx *gorm.DB) error {
+			if m.Up != nil {
+				if e := m.Up(tx); e != nil {
+					return e
+				}
+			}
+
+			if reindex && m.Version == LatestSchemaVersion() {
+				if e := RebuildFTS(tx); e != nil {
+					return e
+				}
+			}
+
+			return tx.Create(&SchemaVersion{
+				Version:   m.Version,
+				Name:      m.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		}); e != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, e)
+		}
+
+		log.Printf("Migrated data.db to schema version %d: %s\n", m.Version, m.Name)
+	}
+
+	return nil
+}
+
+// migrateFTS creates FTS tables that do not yet exist, with rows of their main tables by SQL,
+// to be completed by the reindex after all steps; see migration.Reindex.
+// All tables are created before any row, as quizzes of extras are indexed from extra_q.
+func migrateFTS(tx *gorm.DB) error {
+	created := map[string]bool{}
+
+	for _, t := range []struct {
+		name    string
+		columns string
+	}{
+		{"quiz_q", "[id], [entry], [pinyin], [english], [description], [tag], [type], [direction], [source]"},
+		{"extra_q", "[id], [chinese], [pinyin], [english], [type], [description], [tag]"},
+		{"library_q", "[id], [title], [entry], [description], [tag]"},
+		{"sentence_q", "[id], [chinese], [pinyin], [english]"},
+	} {
+		var count int64
+		if r := tx.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", t.name).Scan(&count); r.Error != nil {
+			return r.Error
+		}
+
+		if count > 0 {
+			continue
+		}
+
+		if r := tx.Exec(fmt.Sprintf("CREATE VIRTUAL TABLE %s USING fts5 (%s)", t.name, t.columns)); r.Error != nil {
+			return r.Error
+		}
+		created[t.name] = true
+	}
+
+	if created["quiz_q"] {
+		if r := tx.Exec(`
+		INSERT INTO quiz_q (id, entry, type, direction, source)
+		SELECT id, entry, [type], direction, source FROM quiz
+		`); r.Error != nil {
+			return r.Error
+		}
+	}
+
+	if created["extra_q"] {
+		if r := tx.Exec(`
+		INSERT INTO extra_q (id, chinese, pinyin, description)
+		SELECT id, chinese, pinyin, description FROM extra
+		`); r.Error != nil {
+			return r.Error
+		}
+	}
+
+	if created["library_q"] {
+		// Built-in libraries, from zh.db, with IDs starting with space
+		var builtins []struct {
+			Title   string
+			Entries string
+		}
+		if r := zhDB.Current.Raw("SELECT title, entries FROM library").Scan(&builtins); r.Error != nil {
+			return r.Error
+		}
+
+		now := time.Now()
+		for _, lib := range builtins {
+			if r := tx.Exec("DELETE FROM library WHERE id = ?", " "+lib.Title); r.Error != nil {
+				return r.Error
+			}
+
+			if r := tx.Exec(
+				"INSERT INTO library (id, created_at, updated_at, title, entries) VALUES (?, ?, ?, ?, ?)",
+				" "+lib.Title, now, now, lib.Title, lib.Entries,
+			); r.Error != nil {
+				return r.Error
+			}
+		}
+
+		if r := tx.Exec(`
+		INSERT INTO library_q (id, title, description)
+		SELECT id, title, description FROM library
+		`); r.Error != nil {
+			return r.Error
+		}
+	}
+
+	return nil
+}
+
+// migrateProfiles replaces unique indexes from before profiles, which did not include user_id.
+// Existing rows already belong to DefaultUserID, by the column default.
+func migrateProfiles(tx *gorm.DB) error {
+	if r := tx.Exec("DROP INDEX IF EXISTS idx_extra_chinese"); r.Error != nil {
+		return r.Error
+	}
+
+	for name, model := range map[string]interface{}{
+		"quiz_unique_idx":        &v1Quiz{},
+		"idx_extra_user_chinese": &v1Extra{},
+		"idx_library_user_title": &v1Library{},
+	} {
+		var sql string
+		if r := tx.Raw("SELECT sql FROM sqlite_master WHERE type = 'index' AND name = ?", name).Scan(&sql); r.Error != nil {
+			if !errors.Is(r.Error, gorm.ErrRecordNotFound) {
+				return r.Error
+			}
+		}
+
+		if strings.Contains(sql, "user_id") {
+			continue
+		}
+
+		if r := tx.Exec("DROP INDEX IF EXISTS " + name); r.Error != nil {
+			return r.Error
+		}
+
+		if e := tx.Migrator().CreateIndex(model, name); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// v1 tables are snapshots of the models at schema version 1, so that later changes to the models do not change it.
+// AutoMigrate also adds their missing columns to databases from before schema_version.
+
+type v1User struct {
+	ID        string `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Name      string
+	Meta      string `gorm:"type:JSON"`
+}
+
+func (v1User) TableName() string { return "user" }
+
+type v1Quiz struct {
+	ID          string `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      string     `gorm:"index:quiz_unique_idx,unique;not null;default:'_'"`
+	Entry       string     `gorm:"index:quiz_unique_idx,unique;not null"`
+	Type        string     `gorm:"index:quiz_unique_idx,unique;not null;check:[type] in ('hanzi','vocab','sentence')"`
+	Direction   string     `gorm:"index:quiz_unique_idx,unique;not null;check:direction in ('se','ec','te')"`
+	Source      string     `gorm:"index;not null"`
+	SRSLevel    *int8      `gorm:"index"`
+	NextReview  *time.Time `gorm:"index"`
+	LastRight   *time.Time `gorm:"index"`
+	LastWrong   *time.Time `gorm:"index"`
+	RightStreak *uint      `gorm:"index"`
+	WrongStreak *uint      `gorm:"index"`
+	MaxRight    *uint      `gorm:"index"`
+	MaxWrong    *uint      `gorm:"index"`
+	Stability   *float64
+	Difficulty  *float64
+}
+
+func (v1Quiz) TableName() string { return "quiz" }
+
+type v1Extra struct {
+	ID          string `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      string `gorm:"index:idx_extra_user_chinese,unique;not null;default:'_'"`
+	Chinese     string `gorm:"index:idx_extra_user_chinese,unique;not null"`
+	Pinyin      string
+	Description string
+}
+
+func (v1Extra) TableName() string { return "extra" }
+
+type v1Library struct {
+	ID          string `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      string `gorm:"index:idx_library_user_title,unique;not null;default:'_'"`
+	Title       string `gorm:"index:idx_library_user_title,unique;not null"`
+	Entries     string
+	Description string
+}
+
+func (v1Library) TableName() string { return "library" }
+
+type v1Sentence struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Chinese   string         `gorm:"uniqueIndex"`
+	English   string
+	Level     *float64 `gorm:"index"`
+}
+
+func (v1Sentence) TableName() string { return "sentence" }
+
+type v1ReviewLog struct {
+	ID             uint      `gorm:"primaryKey"`
+	CreatedAt      time.Time `gorm:"index"`
+	QuizID         string    `gorm:"index;not null"`
+	Type           string    `gorm:"not null;check:[type] in ('again','hard','good','easy','repeat','right','wrong')"`
+	Latency        *uint
+	PrevSRSLevel   *int8
+	NewSRSLevel    *int8
+	PrevNextReview *time.Time
+	NewNextReview  *time.Time
+	Session        string `gorm:"index"`
+	Snapshot       string `gorm:"type:JSON"`
+}
+
+func (v1ReviewLog) TableName() string { return "review_log" }
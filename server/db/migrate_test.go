@@ -0,0 +1,238 @@
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/wangbin/jiebago"
+	"github.com/zhquiz/go-zhquiz/server/zh"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// setupTest points zh.db, the jieba dictionary and USER_DATA_DIR to a temporary directory, which is returned
+func setupTest(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "zhquiz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	os.Setenv("USER_DATA_DIR", dir)
+
+	dict := filepath.Join(dir, "dict.txt")
+	if err := ioutil.WriteFile(dict, []byte("你好 10 l\n好久 10 d\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jieba = jiebago.Segmenter{}
+	jieba.LoadDictionary(dict)
+
+	z, err := gorm.Open(sqlite.Open(filepath.Join(dir, "zh.db")), &gorm.Config{
+		NamingStrategy: schema.NamingStrategy{
+			SingularTable: true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE VIRTUAL TABLE token_q USING fts5(entry, pinyin, english, description, tag)`,
+		`CREATE TABLE vocab (simplified, traditional, pinyin, english, frequency, source)`,
+		`CREATE TABLE token (entry, pinyin, english, frequency, hanzi_level, vocab_level)`,
+		`CREATE TABLE sentence (id, chinese, pinyin, english, frequency, level)`,
+		`CREATE TABLE library (title, entries)`,
+		`INSERT INTO vocab VALUES ('你好', '你好', 'ni3 hao3', 'hello', 1, '')`,
+		`INSERT INTO token VALUES ('你好', 'ni3 hao3', 'hello', 1, NULL, 1)`,
+		`INSERT INTO token VALUES ('好', 'hao3', 'good', 1, 1, NULL)`,
+		`INSERT INTO library VALUES ('HSK1', char(31) || '你好' || char(31))`,
+	} {
+		if r := z.Exec(stmt); r.Error != nil {
+			t.Fatal(r.Error)
+		}
+	}
+
+	zhDB = zh.DB{Current: z}
+	t.Cleanup(func() { zhDB.Close() })
+
+	return dir
+}
+
+// openTest opens a copy of fixture in testdata, or a new database if fixture is empty
+func openTest(t *testing.T, dir string, fixture string) *gorm.DB {
+	path := filepath.Join(dir, "data.db")
+
+	if fixture != "" {
+		b, err := ioutil.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeDB(db) })
+
+	return db
+}
+
+// schemaOf lists CREATE statements of tables and indexes, except those of FTS and schema_version.
+// Columns and constraints are sorted, as gorm orders constraints randomly.
+func schemaOf(t *testing.T, db *gorm.DB) []string {
+	var out []string
+	if r := db.Raw(`
+	SELECT sql FROM sqlite_master
+	WHERE sql IS NOT NULL AND tbl_name NOT LIKE '%\_q%' ESCAPE '\' AND tbl_name != 'schema_version'
+	ORDER BY name
+	`).Scan(&out); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+
+	for i, sql := range out {
+		start := strings.Index(sql, "(")
+		if start == -1 || !strings.HasSuffix(sql, ")") {
+			continue
+		}
+
+		// Split at commas outside of parentheses
+		items := make([]string, 0)
+		depth, from := 0, start+1
+		for j := from; j < len(sql)-1; j++ {
+			switch sql[j] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			case ',':
+				if depth == 0 {
+					items = append(items, sql[from:j])
+					from = j + 1
+				}
+			}
+		}
+		items = append(items, sql[from:len(sql)-1])
+		sort.Strings(items)
+
+		out[i] = sql[:start+1] + strings.Join(items, ",") + ")"
+	}
+
+	return out
+}
+
+func TestMigrateFixtures(t *testing.T) {
+	for _, c := range []struct {
+		fixture string
+		version int
+		// counts are rows that must survive, by table
+		counts map[string]int64
+	}{
+		// Before FTS tables, with a quiz of an extra
+		{"pre-fts.db", 0, map[string]int64{"user": 1, "quiz": 3, "extra": 1, "library": 2, "sentence": 1}},
+		// Before review_log, sentence_q and profiles
+		{"baseline.db", 0, map[string]int64{"user": 1, "quiz": 3, "extra": 1, "library": 2, "sentence": 1}},
+		// With review_log and sentence_q
+		{"review-log.db", 0, map[string]int64{"user": 1, "quiz": 3, "extra": 1, "library": 2, "sentence": 1, "review_log": 1}},
+		// With profiles, before schema_version
+		{"profiles.db", 0, map[string]int64{"user": 2, "quiz": 4, "extra": 2, "library": 2, "sentence": 1, "review_log": 1}},
+		{"v4.db", 4, map[string]int64{"user": 2, "quiz": 4, "extra": 2, "library": 2, "sentence": 1, "review_log": 1}},
+	} {
+		t.Run(c.fixture, func(t *testing.T) {
+			dir := setupTest(t)
+			db := openTest(t, dir, c.fixture)
+
+			if v, err := CurrentSchemaVersion(db); err != nil || v != c.version {
+				t.Fatalf("fixture is at version %d, not %d: %v", v, c.version, err)
+			}
+
+			if err := Migrate(db); err != nil {
+				t.Fatal(err)
+			}
+
+			if v, err := CurrentSchemaVersion(db); err != nil || v != LatestSchemaVersion() {
+				t.Errorf("migrated to version %d, not %d: %v", v, LatestSchemaVersion(), err)
+			}
+
+			for table, want := range c.counts {
+				var n int64
+				if r := db.Table(table).Count(&n); r.Error != nil || n != want {
+					t.Errorf("%s has %d rows, not %d: %v", table, n, want, r.Error)
+				}
+			}
+
+			// Unique indexes from before profiles are widened
+			for _, name := range []string{"quiz_unique_idx", "idx_extra_user_chinese", "idx_library_user_title"} {
+				var sql string
+				if r := db.Raw("SELECT sql FROM sqlite_master WHERE name = ?", name).Scan(&sql); r.Error != nil || !strings.Contains(sql, "user_id") {
+					t.Errorf("%s is %q: %v", name, sql, r.Error)
+				}
+			}
+
+			res, err := Verify(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !res.OK() {
+				t.Errorf("FTS issues after migration: %+v", res.Issues)
+			}
+
+			// Pinyin is indexed with tone numbers, as of version 5
+			var n int64
+			if r := db.Raw("SELECT COUNT(*) FROM extra_q WHERE extra_q MATCH 'pinyin:hao3'").Scan(&n); r.Error != nil || n == 0 {
+				t.Errorf("extra_q not indexed with tone numbers: %v", r.Error)
+			}
+
+			// Backed up before migrating
+			backups, err := Backups()
+			if err != nil || len(backups) != 1 {
+				t.Errorf("backups %v: %v", backups, err)
+			}
+
+			// and then, nothing to do
+			if err := Migrate(db); err != nil {
+				t.Fatal(err)
+			}
+			if backups, _ := Backups(); len(backups) != 1 {
+				t.Errorf("backed up again, with nothing to migrate")
+			}
+		})
+	}
+}
+
+// TestMigrateNew checks that migrations of a new database arrive at the schema of the models.
+// If it fails after a model is changed, append a migration.
+func TestMigrateNew(t *testing.T) {
+	dir := setupTest(t)
+	db := openTest(t, dir, "")
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	if backups, _ := Backups(); len(backups) != 0 {
+		t.Errorf("backed up a new database")
+	}
+
+	models, err := open("file:models?mode=memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeDB(models)
+
+	if err := models.AutoMigrate(&User{}, &Quiz{}, &Extra{}, &Library{}, &Sentence{}, &ReviewLog{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := schemaOf(t, db), schemaOf(t, models); !reflect.DeepEqual(got, want) {
+		t.Errorf("migrated schema\n  %s\nis not that of the models\n  %s", strings.Join(got, "\n  "), strings.Join(want, "\n  "))
+	}
+}
@@ -1,10 +1,9 @@
 package db
 
 import (
-	"errors"
+	"fmt"
 	"math"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/jkomyno/nanoid"
@@ -12,12 +11,18 @@ import (
 	"gorm.io/gorm"
 )
 
+// LeechStreak is the WrongStreak from which a quiz is a leech
+const LeechStreak = 2
+
 // Quiz is the database model for quiz
 type Quiz struct {
 	ID        string `gorm:"primaryKey" json:"id"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
 
+	// UserID is the profile owning the quiz, see User
+	UserID string `gorm:"index:quiz_unique_idx,unique;not null;default:'_'" json:"-"`
+
 	// Entry references
 	Entry     string `gorm:"index:quiz_unique_idx,unique;not null" json:"entry"`
 	Type      string `gorm:"index:quiz_unique_idx,unique;not null;check:[type] in ('hanzi','vocab','sentence')" json:"type"`
@@ -36,10 +41,14 @@ type Quiz struct {
 	WrongStreak *uint      `gorm:"index" json:"wrongStreak"`
 	MaxRight    *uint      `gorm:"index"`
 	MaxWrong    *uint      `gorm:"index"`
+
+	// FSRSScheduler memory model
+	Stability  *float64
+	Difficulty *float64
 }
 
-// Create ensures q update
-func (q *Quiz) Create(tx *gorm.DB) (err error) {
+// Create generates ID, if not set, and creates q, to be indexed by AfterCreate
+func (q *Quiz) Create(tx *gorm.DB) error {
 	for q.ID == "" {
 		id, err := nanoid.Nanoid(6)
 		if err != nil {
@@ -48,319 +57,276 @@ func (q *Quiz) Create(tx *gorm.DB) (err error) {
 
 		var count int64
 		if r := tx.Model(Quiz{}).Where("id = ?", id).Count(&count); r.Error != nil {
-			return err
+			return r.Error
 		}
 
 		if count == 0 {
 			q.ID = id
-			return nil
 		}
 	}
 
-	if r := tx.Create(q); r.Error != nil {
-		return r.Error
-	}
-
-	var old struct {
-		ID          string
-		Description string
-		Tag         string
-	}
-
-	if r := tx.Raw(`
-	SELECT ID, Description, Tag
-	FROM quiz_q
-	WHERE id = ?
-	`, q.ID).Scan(&old); r.Error != nil && !errors.Is(r.Error, gorm.ErrRecordNotFound) {
-		panic(r.Error)
-	}
-
-	descSet := map[string]bool{}
-	tagSet := map[string]bool{}
-
-	if old.ID != "" {
-		if strings.TrimSpace(old.Description) != "" {
-			for _, d := range strings.Split(old.Description, " ") {
-				descSet[d] = true
-			}
-		}
-
-		if strings.TrimSpace(old.Tag) != "" {
-			for _, t := range strings.Split(old.Tag, " ") {
-				tagSet[t] = true
-			}
-		}
-	}
+	return tx.Create(q).Error
+}
 
-	if strings.TrimSpace(q.Description) != "" {
-		for _, d := range strings.Split(parseChinese(q.Description), " ") {
-			descSet[d] = true
-		}
-	}
+// QuizContent is what a Quiz entry resolves to, from zh.db, or from Extra
+type QuizContent struct {
+	// Entries are the entry itself, or simplified and traditional forms of vocab
+	Entries     []string
+	Traditional []string
+	Pinyin      []string
+	English     []string
+	Level       string
+	Description []string
+	Tag         []string
+}
 
-	if strings.TrimSpace(q.Tag) != "" {
-		for _, d := range strings.Split(parseChinese(q.Tag), " ") {
-			tagSet[d] = true
-		}
+// Resolve looks up pinyin, english, level, description and tag of the entry, as indexed in quiz_q
+func (q *Quiz) Resolve(tx *gorm.DB) (*QuizContent, error) {
+	c := QuizContent{
+		Entries:     make([]string, 0),
+		Traditional: make([]string, 0),
+		Pinyin:      make([]string, 0),
+		English:     make([]string, 0),
+		Description: make([]string, 0),
+		Tag:         make([]string, 0),
 	}
 
-	entry := q.Entry
-	pinyin := ""
-	english := ""
-	level := ""
-
 	var getter []struct {
 		Description string
 		Tag         string
 	}
 
-	zhDB.Current.Raw(`
+	if r := zhDB.Current.Raw(`
 	SELECT [Description], [Tag] FROM token_q WHERE entry = ?
-	`, q.Entry).Find(&getter)
+	`, q.Entry).Find(&getter); r.Error != nil {
+		return nil, r.Error
+	}
 
 	for _, d := range getter {
-		if strings.TrimSpace(d.Description) != "" {
-			for _, k := range strings.Split(parseChinese(d.Description), " ") {
-				descSet[k] = true
-			}
-		}
-
-		if strings.TrimSpace(d.Tag) != "" {
-			for _, k := range strings.Split(parseChinese(d.Tag), " ") {
-				tagSet[k] = true
-			}
-		}
+		c.Description = append(c.Description, d.Description)
+		c.Tag = append(c.Tag, d.Tag)
 	}
 
 	switch q.Type {
 	case "vocab":
 		var vocabs []zh.Vocab
 		var tokens []zh.Token
-		zhDB.Current.Where("simplified = ? OR traditional = ?", q.Entry, q.Entry).Find(&vocabs)
-		zhDB.Current.Where("entry = ?", q.Entry).Find(&tokens)
-
-		entry = ""
+		if r := zhDB.Current.Where("simplified = ? OR traditional = ?", q.Entry, q.Entry).Find(&vocabs); r.Error != nil {
+			return nil, r.Error
+		}
+		if r := zhDB.Current.Where("entry = ?", q.Entry).Find(&tokens); r.Error != nil {
+			return nil, r.Error
+		}
 
 		for _, v := range vocabs {
-			entry += v.Simplified + " " + v.Traditional + " "
-			pinyin += v.Pinyin + " "
-			english += v.English + " "
+			c.Entries = append(c.Entries, v.Simplified, v.Traditional)
+			c.Pinyin = append(c.Pinyin, v.Pinyin)
+			c.English = append(c.English, v.English)
+
+			if v.Traditional != "" {
+				c.Traditional = append(c.Traditional, v.Traditional)
+			}
 
 			if v.Source != "" {
-				tagSet[v.Source] = true
+				c.Tag = append(c.Tag, v.Source)
 			}
 		}
 
 		for _, t := range tokens {
 			if t.VocabLevel != 0 {
-				level = strconv.Itoa(t.HanziLevel)
+				c.Level = strconv.Itoa(t.VocabLevel)
 			}
 		}
 
 	case "sentence":
-		type sen struct {
+		var sentences []struct {
 			Pinyin  string
 			English string
 			Level   float64
 		}
-		var sentences []sen
 
-		rows, err := zhDB.Current.Raw(`
-		SELECT sentence.pinyin Pinyin, English, Level
+		if r := zhDB.Current.Raw(`
+		SELECT sentence.pinyin Pinyin, sentence.english English, sentence.level Level
 		FROM sentence
 		LEFT JOIN sentence_q ON sentence_q.id = sentence.id
-		WHERE chinese = ?
+		WHERE sentence.chinese = ?
 		GROUP BY sentence.id
-		`, q.Entry).Rows()
-		if err != nil {
-			panic(err)
-		}
-
-		for rows.Next() {
-			var s sen
-			rows.Scan(&s)
-			sentences = append(sentences, s)
+		`, q.Entry).Scan(&sentences); r.Error != nil {
+			return nil, r.Error
 		}
 
 		for _, s := range sentences {
-			pinyin += s.Pinyin + " "
-			english += s.English + " "
+			c.Pinyin = append(c.Pinyin, s.Pinyin)
+			c.English = append(c.English, s.English)
 
 			if s.Level != 0 {
-				level = strconv.Itoa(int(math.Round(s.Level)))
+				c.Level = strconv.Itoa(int(math.Round(s.Level)))
 			}
 		}
 	default:
 		var tokens []zh.Token
-		zhDB.Current.Where("entry = ?", q.Entry).Find(&tokens)
+		if r := zhDB.Current.Where("entry = ?", q.Entry).Find(&tokens); r.Error != nil {
+			return nil, r.Error
+		}
 
 		for _, t := range tokens {
-			pinyin += t.Pinyin + " "
-			english += t.English + " "
+			c.Pinyin = append(c.Pinyin, t.Pinyin)
+			c.English = append(c.English, t.English)
 
 			if t.HanziLevel != 0 {
-				level = strconv.Itoa(t.HanziLevel)
+				c.Level = strconv.Itoa(t.HanziLevel)
 			}
 		}
 	}
 
+	if len(c.Entries) == 0 {
+		c.Entries = append(c.Entries, q.Entry)
+	}
+
 	if q.Source == "extra" {
-		var extra Extra
-		tx.Select(`
-		extra.description [Description],
-		extra_q.tag       [Tag]
-		`).Joins("LEFT JOIN extra_q ON extra.id = extra_q.id").
-			Where("extra.chinese = ? AND type = ?", q.Entry, q.Type).
-			Group("extra.id").
-			First(&extra)
-
-		if strings.TrimSpace(extra.Description) != "" {
-			for _, d := range strings.Split(parseChinese(extra.Description), " ") {
-				descSet[d] = true
-			}
+		var extra struct {
+			Pinyin      string
+			English     string
+			Description string
+			Tag         string
 		}
 
-		if strings.TrimSpace(extra.Tag) != "" {
-			for _, d := range strings.Split(parseChinese(extra.Tag), " ") {
-				tagSet[d] = true
-			}
+		if r := tx.Raw(`
+		SELECT
+			extra.pinyin      [Pinyin],
+			extra_q.english   [English],
+			extra.description [Description],
+			extra_q.tag       [Tag]
+		FROM extra
+		LEFT JOIN extra_q ON extra.id = extra_q.id
+		WHERE extra.user_id = ? AND extra.chinese = ? AND extra_q.type = ?
+		GROUP BY extra.id
+		`, q.UserID, q.Entry, q.Type).Scan(&extra); r.Error != nil {
+			return nil, r.Error
 		}
+
+		c.Pinyin = append(c.Pinyin, extra.Pinyin)
+		c.English = append(c.English, extra.English)
+		c.Description = append(c.Description, extra.Description)
+		c.Tag = append(c.Tag, extra.Tag)
 	}
 
-	old.Description = func() string {
-		desc := make([]string, 0)
-		for k := range descSet {
-			desc = append(desc, k)
-		}
+	return &c, nil
+}
 
-		return strings.Join(desc, " ")
-	}()
+// Delete deletes q, and AfterDelete deletes its quiz_q row and review logs
+func (q *Quiz) Delete(tx *gorm.DB) error {
+	return tx.Delete(q).Error
+}
 
-	old.Tag = func() string {
-		tags := make([]string, 0)
-		for k := range tagSet {
-			tags = append(tags, k)
-		}
+// Mark updates SRSLevel, and saves along with ReviewLog in the same transaction
+func (q *Quiz) Mark(tx *gorm.DB, s Scheduler, g Grade, latency *uint) error {
+	if !g.IsValid() {
+		return fmt.Errorf("invalid grade: %s", g)
+	}
 
-		tags = append(tags, "level"+level)
+	log := ReviewLog{
+		QuizID:         q.ID,
+		Type:           string(g.Normalize()),
+		Latency:        latency,
+		PrevSRSLevel:   q.SRSLevel,
+		PrevNextReview: q.NextReview,
+		Session:        sessionID,
+		Snapshot:       q.snapshot(),
+	}
 
-		return strings.Join(tags, " ")
-	}()
+	q.UpdateSRSLevel(s, g)
 
-	if old.ID != "" {
-		if r := tx.Exec(`
-		UPDATE quiz_q SET description = @Description, tag = @Tag WHERE id = @ID
-		`, old); r.Error != nil {
-			panic(r.Error)
+	log.NewSRSLevel = q.SRSLevel
+	log.NewNextReview = q.NextReview
+
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if r := tx.Save(q); r.Error != nil {
+			return r.Error
 		}
-	} else {
-		if r := tx.Exec(`
-		INSERT INTO quiz_q (id, [entry], [pinyin], [english], [type], [direction], [source], [description], [tag])
-		SELECT @id, @entry, @pinyin, @english, @type, @direction, @source, @description, @tag
-		WHERE EXISTS (SELECT 1 FROM quiz WHERE id = @id)
-		`, map[string]interface{}{
-			"id":          q.ID,
-			"entry":       parseChinese(entry),
-			"type":        q.Type,
-			"direction":   q.Direction,
-			"source":      q.Source,
-			"level":       level,
-			"pinyin":      parsePinyin(pinyin),
-			"english":     english,
-			"description": old.Description,
-			"tag":         old.Tag,
-		}); r.Error != nil {
-			panic(r.Error)
+
+		if r := tx.Create(&log); r.Error != nil {
+			return r.Error
 		}
-	}
 
-	return
+		return nil
+	})
 }
 
-// Delete ensures q delete
-func (q *Quiz) Delete(tx *gorm.DB) error {
-	if r := tx.Delete(q); r.Error != nil {
-		return r.Error
+// snapshot copies Quiz statistics, for Undo
+func (q *Quiz) snapshot() QuizSnapshot {
+	s := QuizSnapshot{
+		UpdatedAt:  q.UpdatedAt,
+		SRSLevel:   q.SRSLevel,
+		NextReview: q.NextReview,
+		LastRight:  q.LastRight,
+		LastWrong:  q.LastWrong,
+		Stability:  q.Stability,
+		Difficulty: q.Difficulty,
 	}
 
-	if r := tx.Exec(`
-	DELETE FROM quiz_q
-	WHERE id = ?
-	`, q.ID); r.Error != nil {
-		return r.Error
-	}
-
-	return nil
-}
-
-var srsMap []time.Duration = []time.Duration{
-	4 * time.Hour,
-	8 * time.Hour,
-	24 * time.Hour,
-	3 * 24 * time.Hour,
-	7 * 24 * time.Hour,
-	2 * 7 * 24 * time.Hour,
-	4 * 7 * 24 * time.Hour,
-	16 * 7 * 24 * time.Hour,
-}
+	copyUint := func(p *uint) *uint {
+		if p == nil {
+			return nil
+		}
 
-func getNextReview(srsLevel int8) time.Time {
-	if srsLevel >= 0 && srsLevel < int8(len(srsMap)) {
-		return time.Now().Add(srsMap[srsLevel])
+		v := *p
+		return &v
 	}
 
-	return time.Now().Add(1 * time.Hour)
+	s.RightStreak = copyUint(q.RightStreak)
+	s.WrongStreak = copyUint(q.WrongStreak)
+	s.MaxRight = copyUint(q.MaxRight)
+	s.MaxWrong = copyUint(q.MaxWrong)
+
+	return s
 }
 
-// UpdateSRSLevel updates SRSLevel and also updates stats
-func (q *Quiz) UpdateSRSLevel(dSRSLevel int8) {
+// UpdateSRSLevel updates SRSLevel via Scheduler and also updates stats.
+//
+// Good and easy extend RightStreak, while again extends WrongStreak;
+// each resets the other streak. Hard is recalled, so it ends WrongStreak,
+// but keeps RightStreak as is. Repeat changes no stats.
+func (q *Quiz) UpdateSRSLevel(s Scheduler, g Grade) {
 	now := time.Now()
+	state := s.Next(*q, g, now)
+
+	var zero uint = 0
 
-	if dSRSLevel > 0 {
+	switch g.Normalize() {
+	case GradeGood, GradeEasy:
 		q.LastRight = &now
 
-		if q.RightStreak == nil {
-			var s uint = 0
-			q.RightStreak = &s
+		rightStreak := uint(1)
+		if q.RightStreak != nil {
+			rightStreak += *q.RightStreak
 		}
-
-		*q.RightStreak++
+		q.RightStreak = &rightStreak
+		q.WrongStreak = &zero
 
 		if q.MaxRight == nil || *q.MaxRight < *q.RightStreak {
 			q.MaxRight = q.RightStreak
 		}
-	} else if dSRSLevel < 0 {
+	case GradeHard:
+		q.LastRight = &now
+		q.WrongStreak = &zero
+	case GradeAgain:
 		q.LastWrong = &now
 
-		if q.WrongStreak == nil {
-			var s uint = 0
-			q.WrongStreak = &s
+		wrongStreak := uint(1)
+		if q.WrongStreak != nil {
+			wrongStreak += *q.WrongStreak
 		}
-
-		*q.WrongStreak++
+		q.WrongStreak = &wrongStreak
+		q.RightStreak = &zero
 
 		if q.MaxWrong == nil || *q.MaxWrong < *q.WrongStreak {
 			q.MaxWrong = q.WrongStreak
 		}
 	}
 
-	if q.SRSLevel == nil {
-		var s int8 = 0
-		q.SRSLevel = &s
-	}
-
-	*q.SRSLevel += dSRSLevel
-
-	if *q.SRSLevel >= int8(len(srsMap)) {
-		*q.SRSLevel = int8(len(srsMap) - 1)
-	}
-
-	if *q.SRSLevel < 0 {
-		*q.SRSLevel = 0
-		nextReview := getNextReview(-1)
-		q.NextReview = &nextReview
-	} else {
-		nextReview := getNextReview(*q.SRSLevel)
-		q.NextReview = &nextReview
-	}
+	q.SRSLevel = state.SRSLevel
+	q.NextReview = state.NextReview
+	q.Stability = state.Stability
+	q.Difficulty = state.Difficulty
 }
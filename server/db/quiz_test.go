@@ -0,0 +1,80 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateSRSLevel(t *testing.T) {
+	q := Quiz{}
+
+	// Each step is marked after the previous one, on the same quiz
+	for _, c := range []struct {
+		g                    Grade
+		level                int8
+		interval             time.Duration
+		right, wrong         uint
+		maxRight, maxWrong   uint
+		lastRight, lastWrong bool
+	}{
+		{GradeGood, 1, 8 * time.Hour, 1, 0, 1, 0, true, false},
+		{GradeEasy, 3, 3 * 24 * time.Hour, 2, 0, 2, 0, true, false},
+		// Hard keeps the level at half the interval, and RightStreak as is
+		{GradeHard, 3, 36 * time.Hour, 2, 0, 2, 0, true, false},
+		{GradeAgain, 2, 24 * time.Hour, 0, 1, 2, 1, false, true},
+		{GradeWrong, 1, 8 * time.Hour, 0, 2, 2, 2, false, true},
+		// Repeat changes no stats
+		{GradeRepeat, 1, 8 * time.Hour, 0, 2, 2, 2, false, false},
+		// Hard ends WrongStreak, but not MaxWrong
+		{GradeHard, 1, 4 * time.Hour, 0, 0, 2, 2, true, false},
+		{GradeAgain, 0, 4 * time.Hour, 0, 1, 2, 2, false, true},
+		// Again at level 0 is due in an hour
+		{GradeAgain, 0, 1 * time.Hour, 0, 2, 2, 2, false, true},
+		{GradeAgain, 0, 1 * time.Hour, 0, 3, 2, 3, false, true},
+		// Right ends WrongStreak
+		{GradeRight, 1, 8 * time.Hour, 1, 0, 2, 3, true, false},
+		{GradeGood, 2, 24 * time.Hour, 2, 0, 2, 3, true, false},
+		{GradeEasy, 4, 7 * 24 * time.Hour, 3, 0, 3, 3, true, false},
+	} {
+		lastRight, lastWrong := q.LastRight, q.LastWrong
+
+		before := time.Now()
+		q.UpdateSRSLevel(LeitnerScheduler{}, c.g)
+		after := time.Now()
+
+		if *q.SRSLevel != c.level {
+			t.Errorf("%s: level %d, not %d", c.g, *q.SRSLevel, c.level)
+		}
+		if q.NextReview.Before(before.Add(c.interval)) || q.NextReview.After(after.Add(c.interval)) {
+			t.Errorf("%s: next review in %v, not %v", c.g, q.NextReview.Sub(before), c.interval)
+		}
+
+		if q.RightStreak != nil && *q.RightStreak != c.right || q.RightStreak == nil && c.right != 0 {
+			t.Errorf("%s: RightStreak %v, not %d", c.g, fmtUint(q.RightStreak), c.right)
+		}
+		if q.WrongStreak != nil && *q.WrongStreak != c.wrong || q.WrongStreak == nil && c.wrong != 0 {
+			t.Errorf("%s: WrongStreak %v, not %d", c.g, fmtUint(q.WrongStreak), c.wrong)
+		}
+		if q.MaxRight != nil && *q.MaxRight != c.maxRight || q.MaxRight == nil && c.maxRight != 0 {
+			t.Errorf("%s: MaxRight %v, not %d", c.g, fmtUint(q.MaxRight), c.maxRight)
+		}
+		if q.MaxWrong != nil && *q.MaxWrong != c.maxWrong || q.MaxWrong == nil && c.maxWrong != 0 {
+			t.Errorf("%s: MaxWrong %v, not %d", c.g, fmtUint(q.MaxWrong), c.maxWrong)
+		}
+
+		if (q.LastRight != lastRight) != c.lastRight {
+			t.Errorf("%s: LastRight is updated: %v", c.g, !c.lastRight)
+		}
+		if (q.LastWrong != lastWrong) != c.lastWrong {
+			t.Errorf("%s: LastWrong is updated: %v", c.g, !c.lastWrong)
+		}
+	}
+}
+
+func fmtUint(p *uint) interface{} {
+	if p == nil {
+		return "nil"
+	}
+
+	return *p
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jkomyno/nanoid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// sessionID identifies ReviewLog's written by the current process, for Undo
+var sessionID string
+
+func init() {
+	id, err := nanoid.Nanoid(10)
+	if err != nil {
+		panic(err)
+	}
+
+	sessionID = id
+}
+
+// ReviewLog records every quiz mark, for stats and scheduler tuning
+type ReviewLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+
+	QuizID string `gorm:"index;not null" json:"quizId"`
+	// Type is the normalized Grade, i.e. again, hard, good, easy or repeat
+	Type string `gorm:"not null;check:[type] in ('again','hard','good','easy','repeat','right','wrong')" json:"type"`
+
+	// Latency is time taken to answer, in milliseconds
+	Latency *uint `json:"latency"`
+
+	PrevSRSLevel   *int8      `json:"prevSrsLevel"`
+	NewSRSLevel    *int8      `json:"newSrsLevel"`
+	PrevNextReview *time.Time `json:"prevNextReview"`
+	NewNextReview  *time.Time `json:"newNextReview"`
+
+	Session  string       `gorm:"index" json:"-"`
+	Snapshot QuizSnapshot `json:"-"`
+}
+
+// QuizSnapshot holds Quiz statistics before a mark, to be restored by Undo
+type QuizSnapshot struct {
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	SRSLevel    *int8      `json:"srsLevel"`
+	NextReview  *time.Time `json:"nextReview"`
+	LastRight   *time.Time `json:"lastRight"`
+	LastWrong   *time.Time `json:"lastWrong"`
+	RightStreak *uint      `json:"rightStreak"`
+	WrongStreak *uint      `json:"wrongStreak"`
+	MaxRight    *uint      `json:"maxRight"`
+	MaxWrong    *uint      `json:"maxWrong"`
+	Stability   *float64   `json:"stability"`
+	Difficulty  *float64   `json:"difficulty"`
+}
+
+// Scan scan value into Jsonb, implements sql.Scanner interface
+func (j *QuizSnapshot) Scan(value interface{}) error {
+	var bytes []byte
+
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New(fmt.Sprint("Failed to unmarshal JSONB value:", value))
+	}
+
+	result := QuizSnapshot{}
+	err := json.Unmarshal(bytes, &result)
+	*j = result
+	return err
+}
+
+// Value return json value, implement driver.Valuer interface
+func (j QuizSnapshot) Value() (driver.Value, error) {
+	return json.Marshal(j)
+}
+
+// GormDBDataType represents QuizSnapshot's data type
+func (QuizSnapshot) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "mysql", "sqlite":
+		return "JSON"
+	case "postgres":
+		return "JSONB"
+	}
+	return "TEXT"
+}
+
+// Undo restores quizzes of a profile to before the latest n marks of the current session,
+// and deletes the ReviewLog's. Returns IDs of restored quizzes, latest first.
+// N must be positive.
+func Undo(tx *gorm.DB, userID string, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid number of marks to undo: %d", n)
+	}
+
+	var logs []ReviewLog
+
+	if r := tx.
+		Where("session = ?", sessionID).
+		Where("quiz_id IN (SELECT id FROM quiz WHERE user_id = ?)", userID).
+		Order("id DESC").
+		Limit(n).
+		Find(&logs); r.Error != nil {
+		return nil, r.Error
+	}
+
+	ids := make([]string, 0)
+
+	for _, log := range logs {
+		s := log.Snapshot
+
+		if r := tx.Model(&Quiz{}).Where("id = ?", log.QuizID).UpdateColumns(map[string]interface{}{
+			"updated_at":   s.UpdatedAt,
+			"srs_level":    s.SRSLevel,
+			"next_review":  s.NextReview,
+			"last_right":   s.LastRight,
+			"last_wrong":   s.LastWrong,
+			"right_streak": s.RightStreak,
+			"wrong_streak": s.WrongStreak,
+			"max_right":    s.MaxRight,
+			"max_wrong":    s.MaxWrong,
+			"stability":    s.Stability,
+			"difficulty":   s.Difficulty,
+		}); r.Error != nil {
+			return nil, r.Error
+		}
+
+		if r := tx.Delete(&log); r.Error != nil {
+			return nil, r.Error
+		}
+
+		ids = append(ids, log.QuizID)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUndo(t *testing.T) {
+	dir := setupTest(t)
+	db := openTest(t, dir, "")
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{"q1", "q2", "q3"}
+	for i, id := range ids {
+		q := Quiz{ID: id, Entry: "你好", Type: "vocab", Direction: []string{"se", "ec", "te"}[i], Source: "vocab"}
+		if err := q.Create(db); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.Mark(db, LeitnerScheduler{}, GradeRight, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without a limit, all marks would be undone
+	for _, n := range []int{0, -1} {
+		if _, err := Undo(db, DefaultUserID, n); err == nil {
+			t.Errorf("undid %d marks", n)
+		}
+	}
+
+	out, err := Undo(db, DefaultUserID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"q3", "q2"}; !reflect.DeepEqual(out, want) {
+		t.Errorf("undid %v, not %v", out, want)
+	}
+
+	var marked []string
+	if r := db.Model(&Quiz{}).Where("srs_level IS NOT NULL").Order("id").Pluck("id", &marked); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	if want := []string{"q1"}; !reflect.DeepEqual(marked, want) {
+		t.Errorf("marked quizzes are %v, not %v", marked, want)
+	}
+}
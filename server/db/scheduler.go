@@ -0,0 +1,321 @@
+package db
+
+import (
+	"math"
+	"time"
+)
+
+// Grade is the answer given on marking a quiz
+type Grade string
+
+// Grades accepted by Scheduler
+const (
+	GradeAgain  Grade = "again"
+	GradeHard   Grade = "hard"
+	GradeGood   Grade = "good"
+	GradeEasy   Grade = "easy"
+	GradeRepeat Grade = "repeat"
+
+	// GradeRight is the legacy alias of GradeGood
+	GradeRight Grade = "right"
+	// GradeWrong is the legacy alias of GradeAgain
+	GradeWrong Grade = "wrong"
+)
+
+// IsValid checks if Grade is known to schedulers
+func (g Grade) IsValid() bool {
+	switch g {
+	case GradeAgain, GradeHard, GradeGood, GradeEasy, GradeRepeat, GradeRight, GradeWrong:
+		return true
+	}
+
+	return false
+}
+
+// Normalize converts legacy right/wrong to good/again
+func (g Grade) Normalize() Grade {
+	switch g {
+	case GradeRight:
+		return GradeGood
+	case GradeWrong:
+		return GradeAgain
+	}
+
+	return g
+}
+
+// SRSState is the part of Quiz decided by a Scheduler
+type SRSState struct {
+	SRSLevel   *int8
+	NextReview *time.Time
+	Stability  *float64
+	Difficulty *float64
+}
+
+// Scheduler decides the next SRSState of a quiz, given a Grade
+type Scheduler interface {
+	Next(q Quiz, g Grade, now time.Time) SRSState
+}
+
+// NewScheduler creates Scheduler from UserMeta.Settings.Quiz.Scheduler,
+// defaulting to LeitnerScheduler
+func NewScheduler(meta UserMeta) Scheduler {
+	switch meta.Settings.Quiz.Scheduler {
+	case "fsrs":
+		return NewFSRSScheduler(meta.Settings.Quiz.FSRS)
+	}
+
+	return LeitnerScheduler{}
+}
+
+var srsMap []time.Duration = []time.Duration{
+	4 * time.Hour,
+	8 * time.Hour,
+	24 * time.Hour,
+	3 * 24 * time.Hour,
+	7 * 24 * time.Hour,
+	2 * 7 * 24 * time.Hour,
+	4 * 7 * 24 * time.Hour,
+	16 * 7 * 24 * time.Hour,
+}
+
+// SRSLevelOf finds the highest SRSLevel whose interval is within the given interval
+func SRSLevelOf(interval time.Duration) int8 {
+	var srsLevel int8 = 0
+	for i, d := range srsMap {
+		if d <= interval {
+			srsLevel = int8(i)
+		}
+	}
+
+	return srsLevel
+}
+
+// SRSInterval gets the interval of SRSLevel, in LeitnerScheduler
+func SRSInterval(srsLevel int8) time.Duration {
+	if srsLevel < 0 {
+		return 1 * time.Hour
+	}
+
+	if srsLevel >= int8(len(srsMap)) {
+		srsLevel = int8(len(srsMap) - 1)
+	}
+
+	return srsMap[srsLevel]
+}
+
+// LeitnerScheduler moves SRSLevel up and down a fixed ladder of intervals (srsMap).
+// Hard keeps the level at half the interval, and easy skips a level.
+type LeitnerScheduler struct{}
+
+// Next implements Scheduler
+func (LeitnerScheduler) Next(q Quiz, g Grade, now time.Time) SRSState {
+	g = g.Normalize()
+
+	dSRSLevel := map[Grade]int8{
+		GradeAgain:  -1,
+		GradeHard:   0,
+		GradeGood:   1,
+		GradeEasy:   2,
+		GradeRepeat: 0,
+	}[g]
+
+	var srsLevel int8 = 0
+	if q.SRSLevel != nil {
+		srsLevel = *q.SRSLevel
+	}
+
+	srsLevel += dSRSLevel
+
+	if srsLevel >= int8(len(srsMap)) {
+		srsLevel = int8(len(srsMap) - 1)
+	}
+
+	nextReview := now.Add(1 * time.Hour)
+
+	if srsLevel < 0 {
+		srsLevel = 0
+	} else if g == GradeHard {
+		nextReview = now.Add(srsMap[srsLevel] / 2)
+	} else {
+		nextReview = now.Add(srsMap[srsLevel])
+	}
+
+	return SRSState{
+		SRSLevel:   &srsLevel,
+		NextReview: &nextReview,
+		Stability:  q.Stability,
+		Difficulty: q.Difficulty,
+	}
+}
+
+// FSRSSettings holds user-fitted parameters for FSRSScheduler
+type FSRSSettings struct {
+	Weights          []float64 `json:"weights"`
+	RequestRetention *float64  `json:"requestRetention"`
+}
+
+var defaultFSRSWeights = [17]float64{
+	0.4, 0.6, 2.4, 5.8, 4.93, 0.94, 0.86, 0.01, 1.49, 0.14, 0.94, 2.18, 0.05, 0.34, 1.26, 0.29, 2.61,
+}
+
+// FSRSScheduler schedules by a memory model of stability and difficulty (FSRS v4)
+type FSRSScheduler struct {
+	W                [17]float64
+	RequestRetention float64
+	// MaximumInterval is in days
+	MaximumInterval float64
+}
+
+// NewFSRSScheduler creates FSRSScheduler, falling back to default weights
+func NewFSRSScheduler(s FSRSSettings) FSRSScheduler {
+	f := FSRSScheduler{
+		W:                defaultFSRSWeights,
+		RequestRetention: 0.9,
+		MaximumInterval:  36500,
+	}
+
+	if len(s.Weights) == len(f.W) {
+		copy(f.W[:], s.Weights)
+	}
+
+	if s.RequestRetention != nil && *s.RequestRetention > 0 && *s.RequestRetention < 1 {
+		f.RequestRetention = *s.RequestRetention
+	}
+
+	return f
+}
+
+// Next implements Scheduler
+func (f FSRSScheduler) Next(q Quiz, g Grade, now time.Time) SRSState {
+	rating, ok := map[Grade]float64{
+		GradeAgain: 1,
+		GradeHard:  2,
+		GradeGood:  3,
+		GradeEasy:  4,
+	}[g.Normalize()]
+
+	out := SRSState{
+		Stability:  q.Stability,
+		Difficulty: q.Difficulty,
+	}
+
+	if ok {
+		var s, d float64
+
+		if q.Stability == nil || q.Difficulty == nil {
+			s = f.initStability(rating)
+			d = f.initDifficulty(rating)
+		} else {
+			s, d = *q.Stability, *q.Difficulty
+
+			r := f.retrievability(lastReviewed(q, now), s)
+			if rating == 1 {
+				s = f.forgetStability(d, s, r)
+			} else {
+				s = f.recallStability(d, s, r, rating)
+			}
+			d = f.nextDifficulty(d, rating)
+		}
+
+		out.Stability = &s
+		out.Difficulty = &d
+	}
+
+	interval := srsMap[0]
+	if rating == 1 {
+		interval = 1 * time.Hour
+	} else if out.Stability != nil {
+		interval = f.interval(*out.Stability)
+	}
+
+	var srsLevel int8 = 0
+	if rating != 1 {
+		srsLevel = SRSLevelOf(interval)
+	}
+
+	nextReview := now.Add(interval)
+
+	out.SRSLevel = &srsLevel
+	out.NextReview = &nextReview
+
+	return out
+}
+
+func (f FSRSScheduler) initStability(rating float64) float64 {
+	return math.Max(f.W[int(rating)-1], 0.1)
+}
+
+func (f FSRSScheduler) initDifficulty(rating float64) float64 {
+	return clampDifficulty(f.W[4] - f.W[5]*(rating-3))
+}
+
+func (f FSRSScheduler) nextDifficulty(d float64, rating float64) float64 {
+	d = d - f.W[6]*(rating-3)
+	return clampDifficulty(f.W[7]*f.initDifficulty(3) + (1-f.W[7])*d)
+}
+
+func (f FSRSScheduler) retrievability(elapsedDays float64, s float64) float64 {
+	return math.Pow(1+elapsedDays/(9*s), -1)
+}
+
+func (f FSRSScheduler) recallStability(d, s, r, rating float64) float64 {
+	hardPenalty := 1.0
+	if rating == 2 {
+		hardPenalty = f.W[15]
+	}
+
+	easyBonus := 1.0
+	if rating == 4 {
+		easyBonus = f.W[16]
+	}
+
+	return s * (1 + math.Exp(f.W[8])*
+		(11-d)*
+		math.Pow(s, -f.W[9])*
+		(math.Exp((1-r)*f.W[10])-1)*
+		hardPenalty*
+		easyBonus)
+}
+
+func (f FSRSScheduler) forgetStability(d, s, r float64) float64 {
+	return f.W[11] *
+		math.Pow(d, -f.W[12]) *
+		(math.Pow(s+1, f.W[13]) - 1) *
+		math.Exp((1-r)*f.W[14])
+}
+
+func (f FSRSScheduler) interval(s float64) time.Duration {
+	days := 9 * s * (1/f.RequestRetention - 1)
+	days = math.Min(math.Max(days, 0), f.MaximumInterval)
+
+	interval := time.Duration(days * float64(24*time.Hour))
+	if interval < srsMap[0] {
+		interval = srsMap[0]
+	}
+
+	return interval
+}
+
+func clampDifficulty(d float64) float64 {
+	return math.Min(math.Max(d, 1), 10)
+}
+
+// lastReviewed returns days elapsed since the last right or wrong
+func lastReviewed(q Quiz, now time.Time) float64 {
+	var last *time.Time
+
+	if q.LastRight != nil {
+		last = q.LastRight
+	}
+
+	if q.LastWrong != nil && (last == nil || q.LastWrong.After(*last)) {
+		last = q.LastWrong
+	}
+
+	if last == nil {
+		return 0
+	}
+
+	return math.Max(now.Sub(*last).Hours()/24, 0)
+}
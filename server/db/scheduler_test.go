@@ -0,0 +1,194 @@
+package db
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// baselineNext is UpdateSRSLevel with srsMap and getNextReview, before Scheduler
+func baselineNext(srsLevel *int8, dSRSLevel int8, now time.Time) (int8, time.Time) {
+	var level int8 = 0
+	if srsLevel != nil {
+		level = *srsLevel
+	}
+
+	level += dSRSLevel
+	if level >= int8(len(srsMap)) {
+		level = int8(len(srsMap) - 1)
+	}
+
+	if level < 0 {
+		return 0, now.Add(1 * time.Hour)
+	}
+
+	return level, now.Add(srsMap[level])
+}
+
+func TestLeitnerBaseline(t *testing.T) {
+	now := time.Now()
+
+	levels := []*int8{nil}
+	for i := int8(0); i < int8(len(srsMap)); i++ {
+		level := i
+		levels = append(levels, &level)
+	}
+
+	for _, level := range levels {
+		for g, d := range map[Grade]int8{GradeRight: 1, GradeWrong: -1, GradeRepeat: 0} {
+			out := LeitnerScheduler{}.Next(Quiz{SRSLevel: level}, g, now)
+			wantLevel, wantNext := baselineNext(level, d, now)
+
+			if *out.SRSLevel != wantLevel || !out.NextReview.Equal(wantNext) {
+				t.Errorf("%s at %v is %d, %v, not %d, %v", g, fmtLevel(level), *out.SRSLevel, out.NextReview.Sub(now), wantLevel, wantNext.Sub(now))
+			}
+		}
+	}
+}
+
+func TestLeitner(t *testing.T) {
+	now := time.Now()
+	level := func(n int8) *int8 { return &n }
+
+	for _, c := range []struct {
+		level    *int8
+		g        Grade
+		want     int8
+		interval time.Duration
+	}{
+		{nil, GradeGood, 1, 8 * time.Hour},
+		{nil, GradeAgain, 0, 1 * time.Hour},
+		{level(0), GradeAgain, 0, 1 * time.Hour},
+		{level(3), GradeAgain, 2, 24 * time.Hour},
+		{level(7), GradeGood, 7, 16 * 7 * 24 * time.Hour},
+		{level(7), GradeEasy, 7, 16 * 7 * 24 * time.Hour},
+		{level(2), GradeEasy, 4, 7 * 24 * time.Hour},
+		{level(6), GradeEasy, 7, 16 * 7 * 24 * time.Hour},
+		// Hard keeps the level, at half the interval
+		{level(2), GradeHard, 2, 12 * time.Hour},
+		{nil, GradeHard, 0, 2 * time.Hour},
+		{level(2), GradeRepeat, 2, 24 * time.Hour},
+	} {
+		out := LeitnerScheduler{}.Next(Quiz{SRSLevel: c.level}, c.g, now)
+
+		if *out.SRSLevel != c.want || out.NextReview.Sub(now) != c.interval {
+			t.Errorf("%s at %v is %d, %v, not %d, %v", c.g, fmtLevel(c.level), *out.SRSLevel, out.NextReview.Sub(now), c.want, c.interval)
+		}
+	}
+}
+
+func TestFSRS(t *testing.T) {
+	now := time.Now()
+	f := NewFSRSScheduler(FSRSSettings{})
+
+	// Reviewed after 2.4 days, the interval of good at first, so that retrievability is 0.9
+	s, d := 2.4, 4.93
+	last := now.Add(-time.Duration(2.4 * float64(24*time.Hour)))
+	later := Quiz{Stability: &s, Difficulty: &d, LastRight: &last}
+
+	for _, c := range []struct {
+		name  string
+		q     Quiz
+		g     Grade
+		s, d  float64
+		days  float64
+		level int8
+	}{
+		{"first again", Quiz{}, GradeAgain, 0.4, 6.81, 1.0 / 24, 0},
+		{"first hard", Quiz{}, GradeHard, 0.6, 5.87, 0.6, 1},
+		{"first good", Quiz{}, GradeGood, 2.4, 4.93, 2.4, 2},
+		{"first right", Quiz{}, GradeRight, 2.4, 4.93, 2.4, 2},
+		{"first easy", Quiz{}, GradeEasy, 5.8, 3.99, 5.8, 3},
+		{"later again", later, GradeAgain, 1.1781365, 6.6328, 1.0 / 24, 0},
+		{"later hard", later, GradeHard, 4.0344314, 5.7814, 4.0344314, 3},
+		{"later good", later, GradeGood, 8.0359705, 4.93, 8.0359705, 4},
+		{"later easy", later, GradeEasy, 17.109883, 4.0786, 17.109883, 5},
+	} {
+		out := f.Next(c.q, c.g, now)
+		days := out.NextReview.Sub(now).Hours() / 24
+
+		if !near(*out.Stability, c.s) || !near(*out.Difficulty, c.d) || !near(days, c.days) || *out.SRSLevel != c.level {
+			t.Errorf("%s: stability %v, difficulty %v, %v days, level %d; not %v, %v, %v days, level %d",
+				c.name, *out.Stability, *out.Difficulty, days, *out.SRSLevel, c.s, c.d, c.days, c.level)
+		}
+	}
+
+	// Repeat changes no memory state
+	out := f.Next(later, GradeRepeat, now)
+	if *out.Stability != s || *out.Difficulty != d {
+		t.Errorf("repeat: stability %v, difficulty %v", *out.Stability, *out.Difficulty)
+	}
+}
+
+func TestFSRSSettings(t *testing.T) {
+	retention := 0.8
+	invalid := 1.5
+
+	weights := append([]float64{}, defaultFSRSWeights[:]...)
+	weights[2] = 3
+
+	for _, c := range []struct {
+		name      string
+		settings  FSRSSettings
+		w         [17]float64
+		retention float64
+	}{
+		{"default", FSRSSettings{}, defaultFSRSWeights, 0.9},
+		{"weights", FSRSSettings{Weights: weights, RequestRetention: &retention}, func() (w [17]float64) { copy(w[:], weights); return }(), 0.8},
+		{"too few weights", FSRSSettings{Weights: []float64{1, 2, 3}}, defaultFSRSWeights, 0.9},
+		{"too many weights", FSRSSettings{Weights: append(weights, 1)}, defaultFSRSWeights, 0.9},
+		{"invalid retention", FSRSSettings{RequestRetention: &invalid}, defaultFSRSWeights, 0.9},
+	} {
+		f := NewFSRSScheduler(c.settings)
+		if f.W != c.w || f.RequestRetention != c.retention {
+			t.Errorf("%s: %v, %v", c.name, f.W, f.RequestRetention)
+			continue
+		}
+
+		// Schedules without panic
+		out := f.Next(Quiz{}, GradeGood, time.Now())
+		if *out.Stability != f.W[2] {
+			t.Errorf("%s: stability %v", c.name, *out.Stability)
+		}
+	}
+}
+
+func TestNewScheduler(t *testing.T) {
+	for _, c := range []struct {
+		scheduler string
+		fsrs      bool
+	}{
+		{"", false},
+		{"leitner", false},
+		{"unknown", false},
+		{"fsrs", true},
+	} {
+		meta := UserMeta{}
+		meta.Settings.Quiz.Scheduler = c.scheduler
+
+		_, ok := NewScheduler(meta).(FSRSScheduler)
+		if ok != c.fsrs {
+			t.Errorf("%q is %T", c.scheduler, NewScheduler(meta))
+		}
+	}
+
+	meta := UserMeta{}
+	meta.Settings.Quiz.Scheduler = "fsrs"
+	meta.Settings.Quiz.FSRS.Weights = make([]float64, 17)
+
+	if s := NewScheduler(meta).(FSRSScheduler); s.W != [17]float64{} {
+		t.Errorf("FSRS settings are not used: %v", s.W)
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-4
+}
+
+func fmtLevel(level *int8) interface{} {
+	if level == nil {
+		return "nil"
+	}
+
+	return *level
+}
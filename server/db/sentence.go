@@ -1,11 +1,126 @@
 package db
 
-import "gorm.io/gorm"
+import (
+	"regexp"
+	"strings"
 
-// Sentence caches sentences from http://www.jukuu.com/search.php?q=%s
+	"github.com/zhquiz/go-zhquiz/server/zh"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Sentence caches sentences from http://www.jukuu.com/search.php?q=%s, and imported by user
 type Sentence struct {
 	gorm.Model
 
 	Chinese string `gorm:"uniqueIndex"`
 	English string
+	// Level is the highest level of its tokens, like zh.db sentences
+	Level *float64 `gorm:"index"`
+}
+
+// CreateSentences creates and indexes sentences, skipping existing Chinese. Returns the number created.
+func CreateSentences(tx *gorm.DB, ss []Sentence) (int, error) {
+	created := 0
+
+	for _, s := range ss {
+		s.Chinese = strings.TrimSpace(s.Chinese)
+		if s.Chinese == "" {
+			continue
+		}
+
+		r := tx.Clauses(clause.OnConflict{
+			DoNothing: true,
+		}).Create(&s)
+		if r.Error != nil {
+			return created, r.Error
+		}
+
+		if r.RowsAffected == 0 {
+			continue
+		}
+
+		if e := s.Index(tx); e != nil {
+			return created, e
+		}
+
+		created++
+	}
+
+	return created, nil
+}
+
+// Index computes Level, and replaces sentence_q row with s
+func (s *Sentence) Index(tx *gorm.DB) error {
+	if err := index(tx, s); err != nil {
+		return err
+	}
+
+	return tx.Model(&Sentence{}).Where("id = ?", s.ID).UpdateColumn("level", s.Level).Error
+}
+
+// sentenceLevel segments Chinese, and looks up tokens in zh.db.
+// Level is the highest vocab level of words, or hanzi level of characters not in any leveled word.
+func sentenceLevel(chinese string) (*float64, string, error) {
+	reHan := regexp.MustCompile(`\p{Han}`)
+
+	words := make([]string, 0)
+	func(ch <-chan string) {
+		for word := range ch {
+			if reHan.MatchString(word) {
+				words = append(words, word)
+			}
+		}
+	}(jieba.Cut(chinese, true))
+
+	if len(words) == 0 {
+		return nil, "", nil
+	}
+
+	entries := append([]string{}, words...)
+	for _, w := range words {
+		for _, c := range w {
+			entries = append(entries, string(c))
+		}
+	}
+
+	var tokens []zh.Token
+	if r := zhDB.Current.Where("entry IN ?", entries).Find(&tokens); r.Error != nil {
+		return nil, "", r.Error
+	}
+
+	tMap := map[string]zh.Token{}
+	for _, t := range tokens {
+		tMap[t.Entry] = t
+	}
+
+	level := 0
+	pinyin := make([]string, 0)
+
+	for _, w := range words {
+		if t, ok := tMap[w]; ok && t.VocabLevel != 0 {
+			if t.VocabLevel > level {
+				level = t.VocabLevel
+			}
+			pinyin = append(pinyin, t.Pinyin)
+			continue
+		}
+
+		for _, c := range w {
+			t := tMap[string(c)]
+			if t.HanziLevel > level {
+				level = t.HanziLevel
+			}
+			if t.Pinyin != "" {
+				pinyin = append(pinyin, strings.Split(t.Pinyin, " ")[0])
+			}
+		}
+	}
+
+	if level == 0 {
+		return nil, strings.Join(pinyin, " "), nil
+	}
+
+	out := float64(level)
+	return &out, strings.Join(pinyin, " "), nil
 }
@@ -7,22 +7,54 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/zhquiz/go-zhquiz/server/tts"
 	"gorm.io/gorm"
 	"gorm.io/gorm/schema"
 )
 
-// User holds user data
+// DefaultUserID is the profile of single-user installs, and the fallback when no profile is chosen
+const DefaultUserID = "_"
+
+// User holds user data, one per profile.
+// Quiz, Extra and Library are owned by a User via UserID.
 type User struct {
 	ID        string `gorm:"primaryKey"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
 
+	Name string
+
 	Meta UserMeta
 }
 
-// BeforeCreate forces single user
+// OwnedBy scopes queries on Quiz, Extra and Library to a profile
+func OwnedBy(userID string) func(tx *gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("user_id = ?", userID)
+	}
+}
+
+// Delete deletes u, with its quizzes, extras and libraries,
+// and AfterDelete of each deletes their FTS rows and review logs
+func (u *User) Delete(tx *gorm.DB) error {
+	if u.ID == "" || u.ID == DefaultUserID {
+		return errors.New("cannot delete the default profile")
+	}
+
+	for _, m := range []interface{}{&Quiz{}, &Extra{}, &Library{}} {
+		if r := tx.Scopes(OwnedBy(u.ID)).Delete(m); r.Error != nil {
+			return r.Error
+		}
+	}
+
+	return tx.Delete(u).Error
+}
+
+// BeforeCreate defaults to DefaultUserID
 func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
-	u.ID = "_"
+	if u.ID == "" {
+		u.ID = DefaultUserID
+	}
 	return
 }
 
@@ -36,17 +68,24 @@ type UserMeta struct {
 			WhatToShow string `json:"whatToShow"`
 		} `json:"level"`
 		Quiz struct {
-			Type         []string `json:"type"`
-			Stage        []string `json:"stage"`
-			Direction    []string `json:"direction"`
-			IncludeUndue bool     `json:"includeUndue"`
-			IncludeExtra bool     `json:"includeExtra"`
-			Q            string   `json:"q"`
+			Type         []string     `json:"type"`
+			Stage        []string     `json:"stage"`
+			Direction    []string     `json:"direction"`
+			IncludeUndue bool         `json:"includeUndue"`
+			IncludeExtra bool         `json:"includeExtra"`
+			Q            string       `json:"q"`
+			Scheduler    string       `json:"scheduler"`
+			FSRS         FSRSSettings `json:"fsrs"`
 		} `json:"quiz"`
 		Sentence struct {
 			Min *uint `json:"min"`
 			Max *uint `json:"max"`
+			// Providers are example sentence sources, in priority order
+			Providers []string `json:"providers"`
+			// Corpus is path to user-supplied sentences, as TSV, inside or relative to the user data folder
+			Corpus string `json:"corpus"`
 		} `json:"sentence"`
+		TTS tts.Settings `json:"tts"`
 	} `json:"settings"`
 }
 
@@ -36,3 +36,12 @@ func (sa StringArray) Value() (driver.Value, error) {
 
 	return "\x1f" + strings.Join(sa, "\x1f") + "\x1f", nil
 }
+
+// ifEmpty is s, or else fallback if s is empty
+func ifEmpty(s string, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+
+	return s
+}
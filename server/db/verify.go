@@ -0,0 +1,250 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// FTSProblem is how an FTS row is out of sync with its main table
+type FTSProblem string
+
+const (
+	// FTSOrphaned is an FTS row without a main row, e.g. after bulk deletes
+	FTSOrphaned FTSProblem = "orphaned"
+	// FTSDuplicated is an ID with more than one FTS row
+	FTSDuplicated FTSProblem = "duplicated"
+	// FTSMissing is a main row without an FTS row
+	FTSMissing FTSProblem = "missing"
+	// FTSStale is an FTS row with columns not as Index would write them now
+	FTSStale FTSProblem = "stale"
+)
+
+// FTSIssue is an FTS row, found by Verify
+type FTSIssue struct {
+	Table   string     `json:"table"`
+	ID      string     `json:"id"`
+	Problem FTSProblem `json:"problem"`
+	// Columns are the stale columns
+	Columns []string `json:"columns,omitempty"`
+}
+
+// VerifyResult is the report of Verify
+type VerifyResult struct {
+	// Checked is the number of main rows, by FTS table
+	Checked map[string]int `json:"checked"`
+	Issues  []FTSIssue     `json:"issues"`
+}
+
+// OK is true if Verify found no issues
+func (r VerifyResult) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// ftsUnchecked are columns only stored in FTS tables, which have no main column to be checked against
+var ftsUnchecked = map[string]map[string]bool{
+	"extra_q":   {"english": true, "type": true, "tag": true},
+	"library_q": {"tag": true},
+}
+
+// ftsPartial are columns that may have tokens set by the user, only stored in the FTS table,
+// besides those from main tables and zh.db, so that only the latter are checked
+var ftsPartial = map[string]map[string]bool{
+	"quiz_q": {"description": true, "tag": true},
+}
+
+// Verify checks quiz_q, extra_q, library_q and sentence_q against their main tables, without writing.
+// Expected rows are derived from main tables and zh.db only, so that columns only stored in FTS tables
+// are not checked; see ftsUnchecked and ftsPartial.
+// Issues can be repaired by RebuildFTS.
+func Verify(tx *gorm.DB) (*VerifyResult, error) {
+	out := VerifyResult{
+		Checked: map[string]int{},
+		Issues:  make([]FTSIssue, 0),
+	}
+
+	var quizzes []Quiz
+	if r := tx.Find(&quizzes); r.Error != nil {
+		return nil, r.Error
+	}
+
+	var extras []Extra
+	if r := tx.Find(&extras); r.Error != nil {
+		return nil, r.Error
+	}
+
+	var libs []Library
+	if r := tx.Find(&libs); r.Error != nil {
+		return nil, r.Error
+	}
+
+	var sentences []Sentence
+	if r := tx.Find(&sentences); r.Error != nil {
+		return nil, r.Error
+	}
+
+	models := make([]indexed, 0, len(extras)+len(libs)+len(sentences))
+	for i := range extras {
+		models = append(models, &extras[i])
+	}
+	for i := range libs {
+		models = append(models, &libs[i])
+	}
+	for i := range sentences {
+		models = append(models, &sentences[i])
+	}
+
+	expected := map[string][]map[string]interface{}{}
+	for _, m := range models {
+		v, e := m.ftsValues(tx)
+		if e != nil {
+			return nil, fmt.Errorf("cannot index %s: %w", m.ftsTable(), e)
+		}
+		expected[m.ftsTable()] = append(expected[m.ftsTable()], v)
+	}
+
+	// Without merging description and tag of the existing quiz_q row
+	for _, q := range quizzes {
+		v, e := q.ftsValuesWith(tx, "", "")
+		if e != nil {
+			return nil, fmt.Errorf("cannot index quiz_q: %w", e)
+		}
+		expected["quiz_q"] = append(expected["quiz_q"], v)
+	}
+
+	for _, table := range []string{"quiz_q", "extra_q", "library_q", "sentence_q"} {
+		issues, e := verifyFTS(tx, table, expected[table])
+		if e != nil {
+			return nil, e
+		}
+
+		out.Checked[table] = len(expected[table])
+		out.Issues = append(out.Issues, issues...)
+	}
+
+	return &out, nil
+}
+
+// verifyFTS compares rows of an FTS table with expected rows, as from ftsValues
+func verifyFTS(tx *gorm.DB, table string, expected []map[string]interface{}) ([]FTSIssue, error) {
+	var rows []map[string]interface{}
+	if r := tx.Raw("SELECT * FROM " + table).Find(&rows); r.Error != nil {
+		return nil, r.Error
+	}
+
+	actual := map[string]map[string]interface{}{}
+	count := map[string]int{}
+	for _, row := range rows {
+		id := fmt.Sprint(row["id"])
+		actual[id] = row
+		count[id]++
+	}
+
+	issues := make([]FTSIssue, 0)
+	seen := map[string]bool{}
+
+	for _, v := range expected {
+		id := fmt.Sprint(v["id"])
+		seen[id] = true
+
+		row, ok := actual[id]
+		if !ok {
+			issues = append(issues, FTSIssue{Table: table, ID: id, Problem: FTSMissing})
+			continue
+		}
+
+		if count[id] > 1 {
+			issues = append(issues, FTSIssue{Table: table, ID: id, Problem: FTSDuplicated})
+			continue
+		}
+
+		stale := make([]string, 0)
+		for k, want := range v {
+			if k == "id" || ftsUnchecked[table][k] {
+				continue
+			}
+
+			ok := ftsTokens(want) == ftsTokens(row[k])
+			if ftsPartial[table][k] {
+				ok = hasTokens(row[k], want)
+			}
+
+			if !ok {
+				stale = append(stale, k)
+			}
+		}
+
+		if len(stale) > 0 {
+			sort.Strings(stale)
+			issues = append(issues, FTSIssue{Table: table, ID: id, Problem: FTSStale, Columns: stale})
+		}
+	}
+
+	orphans := make([]string, 0)
+	for id := range actual {
+		if !seen[id] {
+			orphans = append(orphans, id)
+		}
+	}
+	sort.Strings(orphans)
+
+	for _, id := range orphans {
+		issues = append(issues, FTSIssue{Table: table, ID: id, Problem: FTSOrphaned})
+	}
+
+	return issues, nil
+}
+
+// ftsTokens normalizes an FTS column, where the order of space-separated tokens is not significant,
+// e.g. description and tag of quiz_q are built from sets
+func ftsTokens(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+
+	var s string
+	switch v := v.(type) {
+	case []byte:
+		s = string(v)
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	tokens := strings.Fields(s)
+	sort.Strings(tokens)
+
+	out := make([]string, 0, len(tokens))
+	for i, t := range tokens {
+		if i == 0 || t != tokens[i-1] {
+			out = append(out, t)
+		}
+	}
+
+	return strings.Join(out, " ")
+}
+
+// hasTokens is whether column v has all tokens of want, and no level tags but those of want
+func hasTokens(v interface{}, want interface{}) bool {
+	has := map[string]bool{}
+	for _, t := range strings.Fields(ftsTokens(v)) {
+		has[t] = true
+	}
+
+	wanted := map[string]bool{}
+	for _, t := range strings.Fields(ftsTokens(want)) {
+		if !has[t] {
+			return false
+		}
+		wanted[t] = true
+	}
+
+	for t := range has {
+		if reLevelTag.MatchString(t) && !wanted[t] {
+			return false
+		}
+	}
+
+	return true
+}
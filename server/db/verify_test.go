@@ -0,0 +1,166 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestVerifyCorrupted corrupts each FTS table of a database that verifies OK, and checks that Verify reports it
+func TestVerifyCorrupted(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		sql  []string
+		want FTSIssue
+	}{
+		{
+			"quiz english",
+			[]string{"UPDATE quiz_q SET english = 'goodbye' WHERE id = 'q1'"},
+			FTSIssue{Table: "quiz_q", ID: "q1", Problem: FTSStale, Columns: []string{"english"}},
+		},
+		{
+			"quiz level tag removed",
+			[]string{"UPDATE quiz_q SET tag = 't1' WHERE id = 'q1'"},
+			FTSIssue{Table: "quiz_q", ID: "q1", Problem: FTSStale, Columns: []string{"tag"}},
+		},
+		{
+			"quiz with another level tag",
+			[]string{"UPDATE quiz_q SET tag = 't1 level1 level3' WHERE id = 'q1'"},
+			FTSIssue{Table: "quiz_q", ID: "q1", Problem: FTSStale, Columns: []string{"tag"}},
+		},
+		{
+			"quiz tag of extra removed",
+			[]string{"UPDATE quiz_q SET tag = 'level' WHERE id = 'q2'"},
+			FTSIssue{Table: "quiz_q", ID: "q2", Problem: FTSStale, Columns: []string{"tag"}},
+		},
+		{
+			"quiz description of extra removed",
+			[]string{"UPDATE quiz_q SET description = '' WHERE id = 'q2'"},
+			FTSIssue{Table: "quiz_q", ID: "q2", Problem: FTSStale, Columns: []string{"description"}},
+		},
+		{
+			"quiz missing",
+			[]string{"DELETE FROM quiz_q WHERE id = 'q1'"},
+			FTSIssue{Table: "quiz_q", ID: "q1", Problem: FTSMissing},
+		},
+		{
+			"quiz duplicated",
+			[]string{"INSERT INTO quiz_q SELECT * FROM quiz_q WHERE id = 'q1'"},
+			FTSIssue{Table: "quiz_q", ID: "q1", Problem: FTSDuplicated},
+		},
+		{
+			"quiz orphaned",
+			[]string{"INSERT INTO quiz_q (id, entry) VALUES ('q9', '猫')"},
+			FTSIssue{Table: "quiz_q", ID: "q9", Problem: FTSOrphaned},
+		},
+		{
+			"extra chinese and pinyin",
+			[]string{"UPDATE extra_q SET chinese = '猫', pinyin = 'mao1' WHERE id = 'e1'"},
+			FTSIssue{Table: "extra_q", ID: "e1", Problem: FTSStale, Columns: []string{"chinese", "pinyin"}},
+		},
+		{
+			"extra description",
+			[]string{"UPDATE extra_q SET description = '' WHERE id = 'e1'"},
+			FTSIssue{Table: "extra_q", ID: "e1", Problem: FTSStale, Columns: []string{"description"}},
+		},
+		{
+			"extra missing",
+			[]string{"DELETE FROM extra_q WHERE id = 'e1'"},
+			FTSIssue{Table: "extra_q", ID: "e1", Problem: FTSMissing},
+		},
+		{
+			"extra orphaned",
+			[]string{"INSERT INTO extra_q (id, chinese) VALUES ('e9', '猫')"},
+			FTSIssue{Table: "extra_q", ID: "e9", Problem: FTSOrphaned},
+		},
+		{
+			"library entries and title",
+			[]string{"UPDATE library_q SET entry = '你好', title = 'M' WHERE id = 'l1'"},
+			FTSIssue{Table: "library_q", ID: "l1", Problem: FTSStale, Columns: []string{"entry", "title"}},
+		},
+		{
+			"library missing",
+			[]string{"DELETE FROM library_q WHERE id = 'l1'"},
+			FTSIssue{Table: "library_q", ID: "l1", Problem: FTSMissing},
+		},
+		{
+			"sentence english",
+			[]string{"UPDATE sentence_q SET english = 'hi' WHERE id = 1"},
+			FTSIssue{Table: "sentence_q", ID: "1", Problem: FTSStale, Columns: []string{"english"}},
+		},
+		{
+			"sentence pinyin",
+			[]string{"UPDATE sentence_q SET pinyin = 'ni hao' WHERE id = 1"},
+			FTSIssue{Table: "sentence_q", ID: "1", Problem: FTSStale, Columns: []string{"pinyin"}},
+		},
+		{
+			"sentence missing",
+			[]string{"DELETE FROM sentence_q WHERE id = 1"},
+			FTSIssue{Table: "sentence_q", ID: "1", Problem: FTSMissing},
+		},
+		{
+			"sentence orphaned",
+			[]string{"INSERT INTO sentence_q (id, chinese) VALUES (9, '猫')"},
+			FTSIssue{Table: "sentence_q", ID: "9", Problem: FTSOrphaned},
+		},
+	} {
+		db := exportTest(t)
+
+		if res, err := Verify(db); err != nil || !res.OK() {
+			t.Fatalf("%s: FTS issues before corrupting %+v: %v", c.name, res, err)
+		}
+
+		for _, sql := range c.sql {
+			if r := db.Exec(sql); r.Error != nil {
+				t.Fatal(r.Error)
+			}
+		}
+
+		res, err := Verify(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := false
+		for _, issue := range res.Issues {
+			if reflect.DeepEqual(issue, c.want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: issues %+v, without %+v", c.name, res.Issues, c.want)
+		}
+
+		if err := RebuildFTS(db); err != nil {
+			t.Fatal(err)
+		}
+		if res, err := Verify(db); err != nil || !res.OK() {
+			t.Errorf("%s: FTS issues after RebuildFTS %+v: %v", c.name, res.Issues, err)
+		}
+	}
+}
+
+// Columns only stored in FTS tables, e.g. tags set by the user, are kept as they are
+func TestVerifyUserColumns(t *testing.T) {
+	db := exportTest(t)
+
+	for _, sql := range []string{
+		"UPDATE quiz_q SET tag = 'level1', description = '' WHERE id = 'q1'",
+		"UPDATE extra_q SET english = 'ages' WHERE id = 'e1'",
+		"UPDATE library_q SET tag = '' WHERE id = 'l1'",
+	} {
+		if r := db.Exec(sql); r.Error != nil {
+			t.Fatal(r.Error)
+		}
+	}
+
+	res, err := Verify(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Quizzes of the extra resolve to the edited extra_q row
+	want := []FTSIssue{{Table: "quiz_q", ID: "q2", Problem: FTSStale, Columns: []string{"english"}}}
+	if !reflect.DeepEqual(res.Issues, want) {
+		t.Errorf("issues %+v, not %+v", res.Issues, want)
+	}
+}
@@ -0,0 +1,254 @@
+// Package pinyin converts Hanyu Pinyin between tone marks (nǐ hǎo), tone numbers (ni3 hao3) and no tones (ni hao),
+// and segments run-together pinyin (nihao) into syllables.
+package pinyin
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Syllable is a toneless syllable, and its tone, 1 to 4, 5 for neutral, or 0 if not given
+type Syllable struct {
+	Text string
+	Tone int
+}
+
+// marks are vowels with tone marks, by tone 1 to 4
+var marks = map[rune][4]rune{
+	'a': {'ā', 'á', 'ǎ', 'à'},
+	'e': {'ē', 'é', 'ě', 'è'},
+	'i': {'ī', 'í', 'ǐ', 'ì'},
+	'o': {'ō', 'ó', 'ǒ', 'ò'},
+	'u': {'ū', 'ú', 'ǔ', 'ù'},
+	'ü': {'ǖ', 'ǘ', 'ǚ', 'ǜ'},
+}
+
+// unmarked is marks, reversed
+var unmarked = func() map[rune]Syllable {
+	out := map[rune]Syllable{}
+	for base, ms := range marks {
+		for i, m := range ms {
+			out[m] = Syllable{Text: string(base), Tone: i + 1}
+		}
+	}
+	return out
+}()
+
+var reToneNumber = regexp.MustCompile(`[1-5]$`)
+
+// Split segments s into syllables, e.g. "nǐhǎo", "ni3hao3", "Ni3 hao3" or "ni'hao" into ni3 hao3.
+// ü may also be typed as v or u:. OK is false if any part of s is not pinyin.
+func Split(s string) (out []Syllable, ok bool) {
+	out = make([]Syllable, 0)
+
+	for _, w := range words(s) {
+		ss, ok := splitWord(w)
+		if !ok {
+			return nil, false
+		}
+		out = append(out, ss...)
+	}
+
+	return out, len(out) > 0
+}
+
+// IsPinyin checks if all of s is pinyin, with or without tones
+func IsPinyin(s string) bool {
+	_, ok := Split(s)
+	return ok
+}
+
+// words splits s at spaces, apostrophes, hyphens and punctuation between syllables
+func words(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(`'’-,.·`, r)
+	})
+}
+
+func splitWord(w string) ([]Syllable, bool) {
+	letters := make([]rune, 0)
+	// markAt is tone by index of a marked letter
+	markAt := map[int]int{}
+	// numberAt is tone by index of the letter after the tone number
+	numberAt := map[int]int{}
+
+	rs := []rune(strings.ToLower(w))
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+
+		switch {
+		case r == 'u' && i+1 < len(rs) && rs[i+1] == ':':
+			letters = append(letters, 'ü')
+			i++
+		case r == 'v':
+			letters = append(letters, 'ü')
+		case r >= 'a' && r <= 'z', r == 'ü':
+			letters = append(letters, r)
+		case r >= '1' && r <= '5':
+			if _, ok := numberAt[len(letters)]; ok || len(letters) == 0 {
+				return nil, false
+			}
+			numberAt[len(letters)] = int(r - '0')
+		default:
+			m, ok := unmarked[r]
+			if !ok {
+				return nil, false
+			}
+			markAt[len(letters)] = m.Tone
+			letters = append(letters, []rune(m.Text)...)
+		}
+	}
+
+	if len(letters) == 0 {
+		return nil, false
+	}
+
+	// failed are indices of letters, from which there is no segmentation
+	failed := map[int]bool{}
+
+	var segment func(i int) []Syllable
+	segment = func(i int) []Syllable {
+		if i == len(letters) {
+			return []Syllable{}
+		}
+
+		if failed[i] {
+			return nil
+		}
+
+		// Longer syllables first, so that xian is not xi an
+		for j := i + maxSyllableLength; j > i; j-- {
+			if j > len(letters) || !syllableSet[string(letters[i:j])] {
+				continue
+			}
+
+			tone := numberAt[j]
+			valid := true
+
+			for k := i + 1; k < j; k++ {
+				if _, ok := numberAt[k]; ok {
+					valid = false
+				}
+			}
+
+			for k := i; k < j; k++ {
+				if t, ok := markAt[k]; ok {
+					if tone != 0 && tone != t {
+						valid = false
+					}
+					tone = t
+				}
+			}
+
+			if !valid {
+				continue
+			}
+
+			rest := segment(j)
+			if rest == nil {
+				continue
+			}
+
+			return append([]Syllable{{Text: string(letters[i:j]), Tone: tone}}, rest...)
+		}
+
+		failed[i] = true
+		return nil
+	}
+
+	out := segment(0)
+
+	// Erhua takes the tone number of its word, e.g. nar3 is na3 r
+	for i := 1; i < len(out); i++ {
+		if out[i].Text == "r" && out[i-1].Tone == 0 {
+			out[i-1].Tone, out[i].Tone = out[i].Tone, 0
+		}
+	}
+
+	return out, out != nil
+}
+
+// Toneless is e.g. ni, with ü as v, as typed
+func (s Syllable) Toneless() string {
+	return strings.ReplaceAll(s.Text, "ü", "v")
+}
+
+// Numbered is e.g. ni3, or ni if the tone is not known, with ü as v
+func (s Syllable) Numbered() string {
+	if s.Tone == 0 {
+		return s.Toneless()
+	}
+
+	return s.Toneless() + strconv.Itoa(s.Tone)
+}
+
+// Marked is e.g. nǐ, with the tone mark on a or e, on o of ou, or else on the last vowel
+func (s Syllable) Marked() string {
+	rs := []rune(s.Text)
+	if s.Tone < 1 || s.Tone > 4 {
+		return s.Text
+	}
+
+	at := -1
+	for i, r := range rs {
+		if _, ok := marks[r]; !ok {
+			continue
+		}
+
+		if r == 'a' || r == 'e' || (r == 'o' && i+1 < len(rs) && rs[i+1] == 'u') {
+			at = i
+			break
+		}
+		at = i
+	}
+
+	if at == -1 {
+		return s.Text
+	}
+
+	rs[at] = marks[rs[at]][s.Tone-1]
+	return string(rs)
+}
+
+// Numbered converts pinyin in s to tone numbers, word by word, e.g. "nǐhǎo ma" to "ni3 hao3 ma".
+// Zhuyin is also converted. Words that are neither are kept.
+func Numbered(s string) string {
+	return convert(s, Syllable.Numbered, func(w string) string { return w })
+}
+
+// Marked converts pinyin in s to tone marks, word by word, e.g. "ni3hao3 ma5" to "nǐ hǎo ma".
+// Zhuyin is also converted. Words that are neither are kept.
+func Marked(s string) string {
+	return convert(s, Syllable.Marked, func(w string) string { return w })
+}
+
+// Toneless removes tones of pinyin in s, word by word, e.g. "nǐhǎo" to "ni hao".
+// Zhuyin is also converted. Words that are neither only lose a trailing tone number, as CEDICT's xx5.
+func Toneless(s string) string {
+	return convert(s, Syllable.Toneless, func(w string) string {
+		return reToneNumber.ReplaceAllString(w, "")
+	})
+}
+
+func convert(s string, fn func(Syllable) string, fallback func(string) string) string {
+	out := make([]string, 0)
+
+	for _, w := range strings.Fields(s) {
+		ss, ok := Split(w)
+		if !ok {
+			ss, ok = SplitZhuyin(w)
+		}
+		if !ok {
+			out = append(out, fallback(w))
+			continue
+		}
+
+		for _, it := range ss {
+			out = append(out, fn(it))
+		}
+	}
+
+	return strings.Join(out, " ")
+}
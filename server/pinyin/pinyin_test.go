@@ -0,0 +1,133 @@
+package pinyin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want []Syllable
+	}{
+		{"ni3hao3", []Syllable{{"ni", 3}, {"hao", 3}}},
+		{"nǐhǎo", []Syllable{{"ni", 3}, {"hao", 3}}},
+		{"Ni3 Hao3", []Syllable{{"ni", 3}, {"hao", 3}}},
+		{"nihao", []Syllable{{"ni", 0}, {"hao", 0}}},
+		// Longer syllables first, unless separated
+		{"xian", []Syllable{{"xian", 0}}},
+		{"xi'an", []Syllable{{"xi", 0}, {"an", 0}}},
+		{"Xī’ān", []Syllable{{"xi", 1}, {"an", 1}}},
+		{"xi1an1", []Syllable{{"xi", 1}, {"an", 1}}},
+		// but backtracking where they fail
+		{"xianggang", []Syllable{{"xiang", 0}, {"gang", 0}}},
+		{"fangan", []Syllable{{"fang", 0}, {"an", 0}}},
+		// ü as v or u:
+		{"lüe4", []Syllable{{"lüe", 4}}},
+		{"lve4", []Syllable{{"lüe", 4}}},
+		{"lu:e4", []Syllable{{"lüe", 4}}},
+		{"lüè", []Syllable{{"lüe", 4}}},
+		{"nv3", []Syllable{{"nü", 3}}},
+		// Erhua
+		{"nar3", []Syllable{{"na", 3}, {"r", 0}}},
+		{"na3r", []Syllable{{"na", 3}, {"r", 0}}},
+		{"na3 r5", []Syllable{{"na", 3}, {"r", 5}}},
+		{"ma5", []Syllable{{"ma", 5}}},
+		{"yi1-ge4", []Syllable{{"yi", 1}, {"ge", 4}}},
+		// Not pinyin
+		{"", nil},
+		{"hello", nil},
+		{"你好", nil},
+		{"ni33", nil},
+		{"3ni", nil},
+		{"ni6", nil},
+		// Tone mark and number disagree
+		{"nǐ2", nil},
+	} {
+		out, ok := Split(c.in)
+		if ok != (c.want != nil) || (ok && !reflect.DeepEqual(out, c.want)) {
+			t.Errorf("%q is %v, %v, not %v", c.in, out, ok, c.want)
+		}
+
+		if IsPinyin(c.in) != (c.want != nil) {
+			t.Errorf("IsPinyin(%q) is %v", c.in, !(c.want != nil))
+		}
+	}
+}
+
+func TestSyllable(t *testing.T) {
+	for _, c := range []struct {
+		in                         Syllable
+		toneless, numbered, marked string
+	}{
+		{Syllable{"ni", 3}, "ni", "ni3", "nǐ"},
+		{Syllable{"hao", 3}, "hao", "hao3", "hǎo"},
+		{Syllable{"gou", 3}, "gou", "gou3", "gǒu"},
+		{Syllable{"gui", 4}, "gui", "gui4", "guì"},
+		{Syllable{"liu", 2}, "liu", "liu2", "liú"},
+		{Syllable{"xue", 2}, "xue", "xue2", "xué"},
+		{Syllable{"lüe", 4}, "lve", "lve4", "lüè"},
+		{Syllable{"nü", 3}, "nv", "nv3", "nǚ"},
+		{Syllable{"ma", 5}, "ma", "ma5", "ma"},
+		{Syllable{"ma", 0}, "ma", "ma", "ma"},
+		{Syllable{"r", 5}, "r", "r5", "r"},
+		{Syllable{"er", 4}, "er", "er4", "èr"},
+	} {
+		if out := c.in.Toneless(); out != c.toneless {
+			t.Errorf("%v Toneless is %q, not %q", c.in, out, c.toneless)
+		}
+		if out := c.in.Numbered(); out != c.numbered {
+			t.Errorf("%v Numbered is %q, not %q", c.in, out, c.numbered)
+		}
+		if out := c.in.Marked(); out != c.marked {
+			t.Errorf("%v Marked is %q, not %q", c.in, out, c.marked)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	for _, c := range []struct {
+		in                         string
+		numbered, marked, toneless string
+	}{
+		{"nǐhǎo ma", "ni3 hao3 ma", "nǐ hǎo ma", "ni hao ma"},
+		{"ni3hao3 ma5", "ni3 hao3 ma5", "nǐ hǎo ma", "ni hao ma"},
+		{"nv3 lu:e4", "nv3 lve4", "nǚ lüè", "nv lve"},
+		{"Xi1'an1", "xi1 an1", "xī ān", "xi an"},
+		{"ㄋㄧˇㄏㄠˇ", "ni3 hao3", "nǐ hǎo", "ni hao"},
+		// Words that are not pinyin are kept, except for a tone number in Toneless, as in CEDICT
+		{"ni3 OK", "ni3 OK", "nǐ OK", "ni OK"},
+		{"xx5", "xx5", "xx5", "xx"},
+		{"", "", "", ""},
+	} {
+		if out := Numbered(c.in); out != c.numbered {
+			t.Errorf("Numbered(%q) is %q, not %q", c.in, out, c.numbered)
+		}
+		if out := Marked(c.in); out != c.marked {
+			t.Errorf("Marked(%q) is %q, not %q", c.in, out, c.marked)
+		}
+		if out := Toneless(c.in); out != c.toneless {
+			t.Errorf("Toneless(%q) is %q, not %q", c.in, out, c.toneless)
+		}
+	}
+}
+
+// Every syllable and tone converts to marks, and back
+func TestMarkedRoundTrip(t *testing.T) {
+	for _, s := range syllables {
+		for tone := 1; tone <= 4; tone++ {
+			in := Syllable{Text: s, Tone: tone}
+			m := in.Marked()
+
+			// Syllabic consonants have no vowel to mark
+			if s == "r" || s == "m" || s == "n" || s == "ng" || s == "hm" || s == "hng" {
+				continue
+			}
+
+			out, ok := Split(m)
+			if !ok || len(out) != 1 || out[0] != in {
+				t.Errorf("%s: %q is %v, %v", in.Numbered(), m, out, ok)
+			}
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package pinyin
+
+import (
+	"strings"
+	"unicode"
+)
+
+// zhuyinInitials are by pinyin initial, longest first
+var zhuyinInitials = []struct{ pinyin, zhuyin string }{
+	{"zh", "ㄓ"}, {"ch", "ㄔ"}, {"sh", "ㄕ"},
+	{"b", "ㄅ"}, {"p", "ㄆ"}, {"m", "ㄇ"}, {"f", "ㄈ"},
+	{"d", "ㄉ"}, {"t", "ㄊ"}, {"n", "ㄋ"}, {"l", "ㄌ"},
+	{"g", "ㄍ"}, {"k", "ㄎ"}, {"h", "ㄏ"},
+	{"j", "ㄐ"}, {"q", "ㄑ"}, {"x", "ㄒ"},
+	{"r", "ㄖ"}, {"z", "ㄗ"}, {"c", "ㄘ"}, {"s", "ㄙ"},
+}
+
+// zhuyinFinals are by pinyin final, after an initial
+var zhuyinFinals = map[string]string{
+	"a": "ㄚ", "o": "ㄛ", "e": "ㄜ", "ai": "ㄞ", "ei": "ㄟ", "ao": "ㄠ", "ou": "ㄡ",
+	"an": "ㄢ", "en": "ㄣ", "ang": "ㄤ", "eng": "ㄥ", "ong": "ㄨㄥ", "er": "ㄦ",
+	"i": "ㄧ", "ia": "ㄧㄚ", "ie": "ㄧㄝ", "iao": "ㄧㄠ", "iu": "ㄧㄡ",
+	"ian": "ㄧㄢ", "in": "ㄧㄣ", "iang": "ㄧㄤ", "ing": "ㄧㄥ", "iong": "ㄩㄥ",
+	"u": "ㄨ", "ua": "ㄨㄚ", "uo": "ㄨㄛ", "uai": "ㄨㄞ", "ui": "ㄨㄟ",
+	"uan": "ㄨㄢ", "un": "ㄨㄣ", "uang": "ㄨㄤ",
+	"ü": "ㄩ", "üe": "ㄩㄝ", "üan": "ㄩㄢ", "ün": "ㄩㄣ",
+}
+
+// zhuyinStandalone are syllables without an initial, or spelt otherwise in Zhuyin
+var zhuyinStandalone = map[string]string{
+	"yi": "ㄧ", "ya": "ㄧㄚ", "yo": "ㄧㄛ", "yao": "ㄧㄠ", "ye": "ㄧㄝ", "you": "ㄧㄡ",
+	"yan": "ㄧㄢ", "yin": "ㄧㄣ", "yang": "ㄧㄤ", "ying": "ㄧㄥ", "yong": "ㄩㄥ",
+	"yu": "ㄩ", "yue": "ㄩㄝ", "yuan": "ㄩㄢ", "yun": "ㄩㄣ",
+	"wu": "ㄨ", "wa": "ㄨㄚ", "wo": "ㄨㄛ", "wai": "ㄨㄞ", "wei": "ㄨㄟ",
+	"wan": "ㄨㄢ", "wen": "ㄨㄣ", "wang": "ㄨㄤ", "weng": "ㄨㄥ",
+	// Syllabic consonants are written without a vowel
+	"zhi": "ㄓ", "chi": "ㄔ", "shi": "ㄕ", "ri": "ㄖ", "zi": "ㄗ", "ci": "ㄘ", "si": "ㄙ",
+	// Erhua is written as ㄦ, as is er
+	"r": "ㄦ",
+}
+
+// zhuyinTones are marks of tones 1 to 5. The first tone is usually unmarked, and the neutral tone goes first.
+var zhuyinTones = [5]string{"", "ˊ", "ˇ", "ˋ", "˙"}
+
+// zhuyinSyllables are Zhuyin of all syllables, by toneless pinyin
+var zhuyinSyllables = func() map[string]string {
+	out := map[string]string{}
+
+	for _, s := range syllables {
+		if z, ok := zhuyinStandalone[s]; ok {
+			out[s] = z
+			continue
+		}
+
+		initial, final := "", s
+		for _, it := range zhuyinInitials {
+			if strings.HasPrefix(s, it.pinyin) {
+				initial, final = it.zhuyin, strings.TrimPrefix(s, it.pinyin)
+				break
+			}
+		}
+
+		// ju, que, xuan and jun are written with u, but are ü
+		if strings.ContainsAny(initial, "ㄐㄑㄒ") && strings.HasPrefix(final, "u") {
+			final = "ü" + strings.TrimPrefix(final, "u")
+		}
+
+		z, ok := zhuyinFinals[final]
+		if !ok {
+			panic("pinyin: no Zhuyin for " + s)
+		}
+		out[s] = initial + z
+	}
+
+	return out
+}()
+
+// zhuyinPinyin is zhuyinSyllables, reversed. ㄦ is er, rather than erhua.
+var zhuyinPinyin = func() map[string]string {
+	out := map[string]string{}
+	for p, z := range zhuyinSyllables {
+		if p != "r" {
+			out[z] = p
+		}
+	}
+	return out
+}()
+
+// maxZhuyinLength is in runes, i.e. ㄓㄨㄤ
+const maxZhuyinLength = 3
+
+// Zhuyin is e.g. ㄋㄧˇ, or ˙ㄇㄚ for the neutral tone. Tones 0 and 1 are both unmarked.
+func (s Syllable) Zhuyin() string {
+	z, ok := zhuyinSyllables[s.Text]
+	if !ok {
+		return s.Text
+	}
+
+	switch {
+	case s.Tone == 5:
+		return zhuyinTones[4] + z
+	case s.Tone > 1:
+		return z + zhuyinTones[s.Tone-1]
+	}
+
+	return z
+}
+
+// Zhuyin converts pinyin in s to Zhuyin (bopomofo), word by word, e.g. "ni3hao3 ma5" to "ㄋㄧˇ ㄏㄠˇ ˙ㄇㄚ".
+// Words that are not pinyin are kept.
+func Zhuyin(s string) string {
+	return convert(s, Syllable.Zhuyin, func(w string) string { return w })
+}
+
+// SplitZhuyin segments Zhuyin s into syllables, e.g. "ㄋㄧˇㄏㄠˇ" into ni3 hao3.
+// As in Zhuyin, syllables without tone marks are of the first tone; ˉ is also accepted.
+// The neutral tone mark ˙ may come before or after the syllable. OK is false if any part of s is not Zhuyin.
+func SplitZhuyin(s string) (out []Syllable, ok bool) {
+	out = make([]Syllable, 0)
+
+	for _, w := range strings.FieldsFunc(s, unicode.IsSpace) {
+		ss, ok := splitZhuyinWord([]rune(w))
+		if !ok {
+			return nil, false
+		}
+		out = append(out, ss...)
+	}
+
+	return out, len(out) > 0
+}
+
+// IsZhuyin checks if all of s is Zhuyin, with or without tones
+func IsZhuyin(s string) bool {
+	_, ok := SplitZhuyin(s)
+	return ok
+}
+
+func splitZhuyinWord(rs []rune) ([]Syllable, bool) {
+	toneOf := func(r rune) int {
+		switch r {
+		case 'ˉ':
+			return 1
+		case 'ˊ':
+			return 2
+		case 'ˇ':
+			return 3
+		case 'ˋ':
+			return 4
+		case '˙':
+			return 5
+		}
+		return 0
+	}
+
+	// failed are indices of runes, from which there is no segmentation
+	failed := map[int]bool{}
+
+	var segment func(i int) []Syllable
+	segment = func(i int) []Syllable {
+		if i == len(rs) {
+			return []Syllable{}
+		}
+
+		if failed[i] {
+			return nil
+		}
+
+		start, tone := i, 1
+		if rs[i] == '˙' {
+			start, tone = i+1, 5
+		}
+
+		// Longer syllables first, as with pinyin
+		for j := start + maxZhuyinLength; j > start; j-- {
+			if j > len(rs) {
+				continue
+			}
+
+			p, ok := zhuyinPinyin[string(rs[start:j])]
+			if !ok {
+				continue
+			}
+
+			// A trailing ˙ is of this syllable only at the end of the word, or else it goes before the next
+			t, end := tone, j
+			if j < len(rs) && tone == 1 {
+				if mark := toneOf(rs[j]); mark != 0 && (mark != 5 || j+1 == len(rs)) {
+					t, end = mark, j+1
+				}
+			}
+
+			rest := segment(end)
+			if rest == nil {
+				continue
+			}
+
+			return append([]Syllable{{Text: p, Tone: t}}, rest...)
+		}
+
+		failed[i] = true
+		return nil
+	}
+
+	out := segment(0)
+	return out, out != nil
+}
@@ -0,0 +1,76 @@
+package pinyin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestZhuyinRoundTrip(t *testing.T) {
+	for _, s := range syllables {
+		for tone := 1; tone <= 5; tone++ {
+			in := Syllable{Text: s, Tone: tone}
+			z := in.Zhuyin()
+
+			want := in
+			// Erhua is written as er
+			if s == "r" {
+				want.Text = "er"
+			}
+
+			out, ok := SplitZhuyin(z)
+			if !ok || len(out) != 1 || out[0] != want {
+				t.Errorf("%s: %q is %v, %v", in.Numbered(), z, out, ok)
+			}
+		}
+	}
+}
+
+func TestSplitZhuyin(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want []Syllable
+	}{
+		{"ㄋㄧˇㄏㄠˇ", []Syllable{{"ni", 3}, {"hao", 3}}},
+		{"ㄋㄧˇ ㄏㄠˇ ˙ㄇㄚ", []Syllable{{"ni", 3}, {"hao", 3}, {"ma", 5}}},
+		{"ㄒㄧㄢ", []Syllable{{"xian", 1}}},
+		{"ㄋㄧˉㄏㄠˋ", []Syllable{{"ni", 1}, {"hao", 4}}},
+		// ˙ is trailing only at the end of a word, and else leads the next syllable
+		{"ㄇㄚ˙", []Syllable{{"ma", 5}}},
+		{"˙ㄇㄚ", []Syllable{{"ma", 5}}},
+		{"ㄋㄧ˙ㄇㄚ", []Syllable{{"ni", 1}, {"ma", 5}}},
+		{"ㄏㄠˇ˙ㄇㄚ", []Syllable{{"hao", 3}, {"ma", 5}}},
+		{"ㄏㄠˇ ㄇㄚ˙", []Syllable{{"hao", 3}, {"ma", 5}}},
+		{"nihao", nil},
+		{"ㄋㄧˇ hao", nil},
+		{"˙", nil},
+		{"", nil},
+	} {
+		out, ok := SplitZhuyin(c.in)
+		if ok != (c.want != nil) || (ok && !reflect.DeepEqual(out, c.want)) {
+			t.Errorf("%q is %v, %v, not %v", c.in, out, ok, c.want)
+		}
+	}
+}
+
+func TestZhuyin(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{"ni3hao3 ma5", "ㄋㄧˇ ㄏㄠˇ ˙ㄇㄚ"},
+		{"nǐ hǎo", "ㄋㄧˇ ㄏㄠˇ"},
+		{"Xi1'an1", "ㄒㄧ ㄢ"},
+		{"lv4 nu:3", "ㄌㄩˋ ㄋㄩˇ"},
+		{"ju2 que4 xuan1 jiong3", "ㄐㄩˊ ㄑㄩㄝˋ ㄒㄩㄢ ㄐㄩㄥˇ"},
+		{"zhi1 shi4 zi5", "ㄓ ㄕˋ ˙ㄗ"},
+		{"yi1 wu3 yu2", "ㄧ ㄨˇ ㄩˊ"},
+		{"na3 r5", "ㄋㄚˇ ˙ㄦ"},
+		{"ni3 OK", "ㄋㄧˇ OK"},
+	} {
+		if out := Zhuyin(c.in); out != c.want {
+			t.Errorf("%q is %q, not %q", c.in, out, c.want)
+		}
+
+		// and back, except for erhua
+		if out, want := Numbered(Zhuyin(c.in)), Numbered(c.in); c.in != "na3 r5" && out != want {
+			t.Errorf("%q is %q, not %q", c.in, out, want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package sentence
+
+import (
+	"context"
+	"strings"
+
+	"github.com/zhquiz/go-zhquiz/server/db"
+	"gorm.io/gorm"
+)
+
+// Cache searches db.Sentence, i.e. sentences saved from online providers, or imported
+type Cache struct {
+	DB *db.DB
+}
+
+// Name implements Provider
+func (Cache) Name() string {
+	return "cache"
+}
+
+// where is the same as Tatoeba, but using sentence_q in data.db.
+// Sentences without a level, i.e. without known words, are within any level bounds.
+func (c Cache) where(ctx context.Context, q Query) *gorm.DB {
+	andCond := []string{"TRUE"}
+
+	cond := map[string]interface{}{
+		"q":         q.Q,
+		"levelMin":  q.LevelMin,
+		"levelMax":  q.LevelMax,
+		"lengthMin": q.LengthMin,
+		"lengthMax": q.LengthMax,
+	}
+
+	if q.LevelMin != 0 {
+		andCond = append(andCond, "([level] IS NULL OR [level] >= @levelMin)")
+	}
+
+	if q.LevelMax != 0 {
+		andCond = append(andCond, "([level] IS NULL OR [level] <= @levelMax)")
+	}
+
+	if q.Q != "" {
+		if like := likeQ(q.Q); like != "" {
+			cond["q"] = like
+			andCond = append(andCond, "chinese LIKE @q")
+		} else {
+			andCond = append(andCond, `id IN (
+				SELECT id FROM sentence_q WHERE sentence_q MATCH @q
+			)`)
+		}
+	} else {
+		if q.LengthMin != 0 {
+			andCond = append(andCond, "length(chinese) >= @lengthMin")
+		}
+
+		if q.LengthMax != 0 {
+			andCond = append(andCond, "length(chinese) <= @lengthMax")
+		}
+	}
+
+	return c.DB.Current().WithContext(ctx).Model(&db.Sentence{}).Where(strings.Join(andCond, " AND "), cond)
+}
+
+// Search implements Provider
+func (c Cache) Search(ctx context.Context, q Query) ([]Sentence, error) {
+	out := make([]Sentence, 0)
+
+	tx := c.where(ctx, q)
+
+	if q.Random {
+		tx = tx.Order("RANDOM()")
+	} else {
+		tx = tx.Order("level, id")
+	}
+
+	if q.Limit > 0 {
+		tx = tx.Limit(q.Limit).Offset(q.Offset)
+	}
+
+	if r := tx.Find(&out); r.Error != nil {
+		return nil, r.Error
+	}
+
+	// Imported from Tatoeba, English may have more than one translation, as in zh.db
+	for i, it := range out {
+		out[i].English = strings.Split(it.English, "\u001f")[0]
+	}
+
+	return out, nil
+}
+
+// Save saves and indexes sentences, skipping existing ones
+func (c Cache) Save(ctx context.Context, ss []Sentence) error {
+	dbSentences := make([]db.Sentence, 0)
+
+	for _, s := range ss {
+		dbSentences = append(dbSentences, db.Sentence{
+			Chinese: s.Chinese,
+			English: s.English,
+		})
+	}
+
+	return c.DB.Current().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		_, err := db.CreateSentences(tx, dbSentences)
+		return err
+	})
+}
+
+// Saved wraps an online Provider, saving its results to Cache,
+// then searching Cache instead, so that levels and other bounds of Query apply
+type Saved struct {
+	Provider
+	Cache Cache
+}
+
+// Search implements Provider
+func (s Saved) Search(ctx context.Context, q Query) ([]Sentence, error) {
+	result, err := s.Provider.Search(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result) == 0 {
+		return result, nil
+	}
+
+	if err := s.Cache.Save(ctx, result); err != nil {
+		return nil, err
+	}
+
+	return s.Cache.Search(ctx, q)
+}
@@ -0,0 +1,92 @@
+package sentence
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zhquiz/go-zhquiz/server/db"
+	"github.com/zhquiz/go-zhquiz/shared"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// connectTest connects to data.db in a temporary directory, with zh.db of levels of 你 and 好
+func connectTest(t *testing.T) *db.DB {
+	dir, err := ioutil.TempDir("", "zhquiz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	if err := os.MkdirAll(filepath.Join(dir, "assets"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "assets", "dict.txt"), []byte("你好 10 l\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	zhDB, err := gorm.Open(sqlite.Open(filepath.Join(dir, "assets", "zh.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		"CREATE TABLE token (entry, pinyin, english, frequency, hanzi_level, vocab_level)",
+		"CREATE TABLE vocab (simplified, traditional, pinyin, english, frequency, source)",
+		"CREATE TABLE sentence (id, chinese, pinyin, english, frequency, level)",
+		"CREATE TABLE library (title, entries)",
+		"INSERT INTO token VALUES ('你', 'ni3', 'you', 1, 1, NULL)",
+		"INSERT INTO token VALUES ('好', 'hao3', 'good', 1, 2, NULL)",
+	} {
+		if r := zhDB.Exec(stmt); r.Error != nil {
+			t.Fatal(r.Error)
+		}
+	}
+	if sqlDB, err := zhDB.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	shared.ExecDir = dir
+	os.Setenv("USER_DATA_DIR", dir)
+
+	d := db.Connect()
+	t.Cleanup(func() { d.Close() })
+
+	return &d
+}
+
+func TestCache(t *testing.T) {
+	c := Cache{DB: connectTest(t)}
+	ctx := context.Background()
+
+	if err := c.Save(ctx, []Sentence{
+		// Level 2, by 好
+		{Chinese: "你好", English: "hello\u001fhi"},
+		// No level, as 猫 is not in zh.db
+		{Chinese: "猫", English: "cat"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		q    Query
+		want []Sentence
+	}{
+		{"default levels", Query{LevelMin: 1, LevelMax: 60}, []Sentence{{Chinese: "猫", English: "cat"}, {Chinese: "你好", English: "hello"}}},
+		{"above level", Query{LevelMin: 3}, []Sentence{{Chinese: "猫", English: "cat"}}},
+		{"below level", Query{LevelMax: 1}, []Sentence{{Chinese: "猫", English: "cat"}}},
+		{"like", Query{Q: "%好%", LevelMin: 1}, []Sentence{{Chinese: "你好", English: "hello"}}},
+	} {
+		out, err := c.Search(ctx, tc.q)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(out, tc.want) {
+			t.Errorf("%s: %v, not %v", tc.name, out, tc.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package sentence
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zhquiz/go-zhquiz/shared"
+)
+
+// Corpus searches a user-supplied file of tab-separated Chinese and English, one sentence per line.
+// Lines starting with # are ignored. The file is re-read on change.
+type Corpus struct {
+	// Path is per request, e.g. of the current profile. It must be inside shared.UserDataDir(), see CorpusPath.
+	Path func(ctx context.Context) string
+
+	mu        sync.Mutex
+	loaded    string
+	modTime   time.Time
+	sentences []Sentence
+}
+
+// Name implements Provider
+func (*Corpus) Name() string {
+	return "corpus"
+}
+
+func (c *Corpus) load(ctx context.Context) ([]Sentence, error) {
+	path := c.Path(ctx)
+	if path == "" {
+		return nil, nil
+	}
+
+	path, err := CorpusPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.loaded == path && c.modTime.Equal(stat.ModTime()) {
+		return c.sentences, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sentences, err := ParseTSV(f)
+	if err != nil {
+		return nil, err
+	}
+
+	c.loaded = path
+	c.modTime = stat.ModTime()
+	c.sentences = sentences
+
+	return sentences, nil
+}
+
+// Search implements Provider
+func (c *Corpus) Search(ctx context.Context, q Query) ([]Sentence, error) {
+	sentences, err := c.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Sentence, 0)
+
+	var re *regexp.Regexp
+	if like := likeQ(q.Q); like != "" {
+		re = regexp.MustCompile(strings.ReplaceAll(regexp.QuoteMeta(like), "%", ".*"))
+	} else if q.Q != "" {
+		return out, nil
+	}
+
+	for _, s := range sentences {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if re != nil && !re.MatchString(s.Chinese) {
+			continue
+		}
+
+		// Like Tatoeba, length only bounds random sentences, not searches
+		if q.Q == "" {
+			length := uint(utf8.RuneCountInString(s.Chinese))
+			if q.LengthMin != 0 && length < q.LengthMin {
+				continue
+			}
+			if q.LengthMax != 0 && length > q.LengthMax {
+				continue
+			}
+		}
+
+		out = append(out, s)
+	}
+
+	if q.Random {
+		rand.Shuffle(len(out), func(i, j int) {
+			out[i], out[j] = out[j], out[i]
+		})
+	}
+
+	if q.Offset > 0 {
+		if q.Offset >= len(out) {
+			return []Sentence{}, nil
+		}
+		out = out[q.Offset:]
+	}
+
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+
+	return out, nil
+}
+
+// CorpusPath resolves path of a corpus, relative to shared.UserDataDir(), or absolute.
+// As it is set by API clients, paths outside shared.UserDataDir() are rejected, including by .. or symlinks.
+func CorpusPath(path string) (string, error) {
+	dir, err := filepath.EvalSymlinks(shared.UserDataDir())
+	if err != nil {
+		return "", err
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(shared.UserDataDir(), path)
+	}
+
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+
+	if rel, err := filepath.Rel(dir, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("corpus must be inside %s: %s", shared.UserDataDir(), path)
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,64 @@
+package sentence
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCorpus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zhquiz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := filepath.Join(dir, "data")
+	outside := filepath.Join(dir, "outside.tsv")
+	if err := os.MkdirAll(filepath.Join(data, "corpus"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{filepath.Join(data, "corpus", "mine.tsv"), outside} {
+		if err := ioutil.WriteFile(p, []byte("# comment\n你好\thello\n好久不见\tlong time no see\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(data, "link.tsv")); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("USER_DATA_DIR", data)
+	defer os.Unsetenv("USER_DATA_DIR")
+
+	for _, c := range []struct {
+		path string
+		ok   bool
+	}{
+		{"corpus/mine.tsv", true},
+		{filepath.Join(data, "corpus", "mine.tsv"), true},
+		{"corpus/../corpus/mine.tsv", true},
+		{"../outside.tsv", false},
+		{outside, false},
+		{"link.tsv", false},
+		{"corpus/missing.tsv", false},
+		{"/etc/passwd", false},
+	} {
+		path := c.path
+		corpus := &Corpus{Path: func(context.Context) string { return path }}
+
+		out, err := corpus.Search(context.Background(), Query{Q: "好"})
+		if c.ok {
+			if err != nil || len(out) != 2 {
+				t.Errorf("%s: %v, %v", c.path, out, err)
+			}
+		} else if err == nil {
+			t.Errorf("%s: read outside of user data", c.path)
+		}
+
+		if _, err := CorpusPath(c.path); (err == nil) != c.ok {
+			t.Errorf("%s: CorpusPath %v", c.path, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package sentence
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Jukuu searches http://www.jukuu.com, i.e. online. Results should be saved to Cache.
+type Jukuu struct {
+	Client *http.Client
+}
+
+// Name implements Provider
+func (Jukuu) Name() string {
+	return "jukuu"
+}
+
+// Search implements Provider. Paging is not supported.
+func (j Jukuu) Search(ctx context.Context, q Query) ([]Sentence, error) {
+	if q.Q == "" || q.Offset > 0 {
+		return []Sentence{}, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("http://www.jukuu.com/search.php?q=%s", url.QueryEscape(q.Q)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := j.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+
+	return parseJukuu(resp.Body, q.Limit)
+}
+
+// parseJukuu parses search.php, i.e. alternating rows of tr.c (Chinese) and tr.e (English)
+func parseJukuu(r io.Reader, limit int) ([]Sentence, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	chinese := doc.Find("table tr.c td:last-child")
+	english := doc.Find("table tr.e td:last-child")
+
+	out := make([]Sentence, 0)
+
+	chinese.Each(func(i int, item *goquery.Selection) {
+		if limit > 0 && len(out) >= limit {
+			return
+		}
+
+		s := Sentence{
+			Chinese: strings.TrimSpace(item.Text()),
+		}
+
+		if i < english.Length() {
+			s.English = strings.TrimSpace(english.Eq(i).Text())
+		}
+
+		if s.Chinese != "" {
+			out = append(out, s)
+		}
+	})
+
+	return out, nil
+}
@@ -0,0 +1,98 @@
+package sentence
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseJukuu(t *testing.T) {
+	f, err := os.Open("testdata/jukuu.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	out, err := parseJukuu(f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Sentence{
+		{Chinese: "你好，很高兴认识你。", English: "Hello, nice to meet you."},
+		{Chinese: "她向我说了声你好。", English: "She said hello to me."},
+		{Chinese: "你好吗？", English: "How are you?"},
+	}
+
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("%v, not %v", out, want)
+	}
+}
+
+func TestParseJukuuLimit(t *testing.T) {
+	f, err := os.Open("testdata/jukuu.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	out, err := parseJukuu(f, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out) != 2 {
+		t.Errorf("%d sentences, not 2", len(out))
+	}
+}
+
+// roundTripFunc serves requests of http.Client without network
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (fn roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestJukuuSearch(t *testing.T) {
+	var q string
+
+	j := Jukuu{Client: &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			q = req.URL.Query().Get("q")
+
+			f, err := os.Open("testdata/jukuu.html")
+			if err != nil {
+				return nil, err
+			}
+
+			return &http.Response{
+				StatusCode: 200,
+				Status:     "200 OK",
+				Header:     http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+				Body:       f,
+				Request:    req,
+			}, nil
+		}),
+	}}
+
+	out, err := j.Search(context.Background(), Query{Q: "你好 吗", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q != "你好 吗" {
+		t.Errorf("queried %q", q)
+	}
+
+	if len(out) != 3 {
+		t.Errorf("%d sentences, not 3", len(out))
+	}
+
+	// Jukuu has no paging
+	out, err = j.Search(context.Background(), Query{Q: "你好", Offset: 10})
+	if err != nil || len(out) != 0 {
+		t.Errorf("paged: %v, %v", out, err)
+	}
+}
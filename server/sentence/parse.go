@@ -0,0 +1,212 @@
+package sentence
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func scanLines(r io.Reader, fn func(line string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fn(line)
+	}
+
+	return scanner.Err()
+}
+
+// ParseTSV parses lines of Chinese, tab, then English. Lines starting with # are ignored.
+func ParseTSV(r io.Reader) ([]Sentence, error) {
+	out := make([]Sentence, 0)
+
+	err := scanLines(r, func(line string) {
+		cols := strings.SplitN(line, "\t", 3)
+		s := Sentence{
+			Chinese: strings.TrimSpace(cols[0]),
+		}
+		if len(cols) > 1 {
+			s.English = strings.TrimSpace(cols[1])
+		}
+
+		if reHan.MatchString(s.Chinese) {
+			out = append(out, s)
+		}
+	})
+
+	return out, err
+}
+
+// ParseTatoeba parses Tatoeba sentence pairs export, i.e. ID, Chinese, ID, English.
+// The same Chinese sentence may be on several lines, with different translations.
+func ParseTatoeba(r io.Reader) ([]Sentence, error) {
+	out := make([]Sentence, 0)
+	idx := map[string]int{}
+
+	err := scanLines(r, func(line string) {
+		cols := strings.Split(line, "\t")
+		if len(cols) < 4 {
+			return
+		}
+
+		s := Sentence{
+			Chinese: strings.TrimSpace(cols[1]),
+			English: strings.TrimSpace(cols[3]),
+		}
+
+		if !reHan.MatchString(s.Chinese) {
+			return
+		}
+
+		if i, ok := idx[s.Chinese]; ok {
+			if s.English != "" {
+				out[i].English += "\u001f" + s.English
+			}
+			return
+		}
+
+		idx[s.Chinese] = len(out)
+		out = append(out, s)
+	})
+
+	return out, err
+}
+
+type srtCue struct {
+	Start time.Duration
+	Lines []string
+}
+
+var reSRTTime = regexp.MustCompile(`^(\d+):(\d+):(\d+)[,.](\d+)\s*-->`)
+var reSRTTag = regexp.MustCompile(`<[^>]*>|\{[^}]*\}`)
+
+func parseSRT(r io.Reader) ([]srtCue, error) {
+	out := make([]srtCue, 0)
+	var cur *srtCue
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+
+		if m := reSRTTime.FindStringSubmatch(line); m != nil {
+			n := make([]int, 4)
+			for i := range n {
+				n[i], _ = strconv.Atoi(m[i+1])
+			}
+
+			out = append(out, srtCue{
+				Start: time.Duration(n[0])*time.Hour +
+					time.Duration(n[1])*time.Minute +
+					time.Duration(n[2])*time.Second +
+					time.Duration(n[3])*time.Millisecond,
+			})
+			cur = &out[len(out)-1]
+			continue
+		}
+
+		if line == "" {
+			cur = nil
+			continue
+		}
+
+		if cur != nil {
+			if text := strings.TrimSpace(reSRTTag.ReplaceAllString(line, "")); text != "" {
+				cur.Lines = append(cur.Lines, text)
+			}
+		}
+	}
+
+	return out, scanner.Err()
+}
+
+// ParseSRT parses bilingual subtitles, where lines with Chinese are paired with other lines of the same cue.
+// If english is not nil, it is a separate English subtitle file, paired by the nearest start time.
+func ParseSRT(r io.Reader, english io.Reader) ([]Sentence, error) {
+	cues, err := parseSRT(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var enCues []srtCue
+	if english != nil {
+		if enCues, err = parseSRT(english); err != nil {
+			return nil, err
+		}
+
+		sort.Slice(enCues, func(i, j int) bool {
+			return enCues[i].Start < enCues[j].Start
+		})
+	}
+
+	out := make([]Sentence, 0)
+
+	for _, c := range cues {
+		zh := make([]string, 0)
+		en := make([]string, 0)
+
+		for _, line := range c.Lines {
+			if reHan.MatchString(line) {
+				zh = append(zh, line)
+			} else {
+				en = append(en, line)
+			}
+		}
+
+		if len(zh) == 0 {
+			continue
+		}
+
+		if len(enCues) > 0 {
+			if m := nearestCue(enCues, c.Start); m != nil {
+				en = m.Lines
+			}
+		}
+
+		out = append(out, Sentence{
+			Chinese: strings.Join(zh, " "),
+			English: strings.Join(en, " "),
+		})
+	}
+
+	return out, nil
+}
+
+// nearestCue finds the cue starting nearest to start, within a second
+func nearestCue(cues []srtCue, start time.Duration) *srtCue {
+	i := sort.Search(len(cues), func(i int) bool {
+		return cues[i].Start >= start
+	})
+
+	var best *srtCue
+	diff := time.Second
+
+	for _, j := range []int{i - 1, i} {
+		if j < 0 || j >= len(cues) {
+			continue
+		}
+
+		d := cues[j].Start - start
+		if d < 0 {
+			d = -d
+		}
+
+		if d <= diff {
+			best = &cues[j]
+			diff = d
+		}
+	}
+
+	return best
+}
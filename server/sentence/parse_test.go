@@ -0,0 +1,30 @@
+package sentence
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseTatoeba(t *testing.T) {
+	f, err := os.Open("testdata/tatoeba.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	out, err := ParseTatoeba(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Sentence{
+		{Chinese: "你好。", English: "Hello!\u001fHi."},
+		{Chinese: "我在学中文。", English: "I'm studying Chinese."},
+		{Chinese: "谢谢！", English: "Thank you!\u001fThanks!"},
+	}
+
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("%q, not %q", out, want)
+	}
+}
@@ -0,0 +1,162 @@
+package sentence
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Sentence is an example sentence
+type Sentence struct {
+	Chinese string `json:"chinese"`
+	English string `json:"english"`
+	// Source is Provider.Name(), not a column of Cache
+	Source string `gorm:"-" json:"-"`
+}
+
+// Query searches for sentences. Zero values are unbounded.
+type Query struct {
+	Q string
+
+	LevelMin  uint
+	LevelMax  uint
+	LengthMin uint
+	LengthMax uint
+
+	Limit  int
+	Offset int
+	// Random orders randomly, otherwise by level and frequency
+	Random bool
+}
+
+// Provider searches example sentences from a source
+type Provider interface {
+	Name() string
+	Search(ctx context.Context, q Query) ([]Sentence, error)
+}
+
+// DefaultPriority is the order of providers, if not set in UserMeta
+var DefaultPriority = []string{"tatoeba", "cache", "corpus", "jukuu"}
+
+// Limited wraps Provider with a timeout, and a minimum interval between calls
+type Limited struct {
+	Provider
+	Timeout  time.Duration
+	Interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// Limit creates Limited Provider
+func Limit(p Provider, timeout time.Duration, interval time.Duration) *Limited {
+	return &Limited{
+		Provider: p,
+		Timeout:  timeout,
+		Interval: interval,
+	}
+}
+
+// Search implements Provider, waiting for the rate limit
+func (l *Limited) Search(ctx context.Context, q Query) ([]Sentence, error) {
+	if err := l.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, l.Timeout)
+	defer cancel()
+
+	out, err := l.Provider.Search(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", l.Name(), err)
+	}
+
+	return out, nil
+}
+
+func (l *Limited) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.Interval)
+	l.mu.Unlock()
+
+	select {
+	case <-time.After(at.Sub(now)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Search merges results of providers in order, without duplicates, then skips q.Offset, up to q.Limit.
+// Failing providers are skipped, and their errors are returned along with results.
+func Search(ctx context.Context, providers []Provider, q Query) ([]Sentence, []error) {
+	out := make([]Sentence, 0)
+	errs := make([]error, 0)
+	seen := map[string]bool{}
+
+	// Offset is of the merged results, so that each provider is searched from its start
+	pq := q
+	pq.Offset = 0
+	if q.Limit > 0 {
+		pq.Limit = q.Offset + q.Limit
+	}
+
+	for _, p := range providers {
+		if pq.Limit > 0 && len(out) >= pq.Limit {
+			break
+		}
+
+		// Each provider is asked for the full limit, as its results may duplicate earlier ones
+		result, err := p.Search(ctx, pq)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, s := range result {
+			if s.Chinese == "" || seen[s.Chinese] {
+				continue
+			}
+			seen[s.Chinese] = true
+
+			s.Source = p.Name()
+			out = append(out, s)
+		}
+	}
+
+	return Page(out, q.Offset, q.Limit), errs
+}
+
+// Page is ss from offset, up to limit, if limit is not 0
+func Page(ss []Sentence, offset int, limit int) []Sentence {
+	if offset >= len(ss) {
+		return []Sentence{}
+	}
+	ss = ss[offset:]
+
+	if limit > 0 && len(ss) > limit {
+		ss = ss[:limit]
+	}
+
+	return ss
+}
+
+var reHan = regexp.MustCompile(`\p{Han}`)
+var reNonHan = regexp.MustCompile(`[^\p{Han}]+`)
+
+// likeQ converts Chinese in q to SQL LIKE pattern, i.e. matching Han characters in order.
+// Returns empty string, if q has no Chinese.
+func likeQ(q string) string {
+	if !reHan.MatchString(q) {
+		return ""
+	}
+
+	return "%" + reNonHan.ReplaceAllString(q, "%") + "%"
+}
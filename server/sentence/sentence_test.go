@@ -0,0 +1,198 @@
+package sentence
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// static is a Provider of fixed sentences, or of an error
+type static struct {
+	name string
+	out  []Sentence
+	err  error
+	// calls are the queries searched
+	calls []Query
+}
+
+func (p *static) Name() string {
+	return p.name
+}
+
+func (p *static) Search(ctx context.Context, q Query) ([]Sentence, error) {
+	p.calls = append(p.calls, q)
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	out := p.out
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	return out, nil
+}
+
+// blocking is a Provider that waits for ctx
+type blocking struct{}
+
+func (blocking) Name() string {
+	return "blocking"
+}
+
+func (blocking) Search(ctx context.Context, q Query) ([]Sentence, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func chinese(ss []Sentence) []string {
+	out := make([]string, 0, len(ss))
+	for _, s := range ss {
+		out = append(out, s.Chinese+"/"+s.Source)
+	}
+	return out
+}
+
+func TestSearchPriority(t *testing.T) {
+	tatoeba := &static{name: "tatoeba", out: []Sentence{{Chinese: "一"}, {Chinese: "二"}}}
+	failing := &static{name: "corpus", err: errors.New("no corpus")}
+	cache := &static{name: "cache", out: []Sentence{{Chinese: "二"}, {Chinese: ""}, {Chinese: "三"}, {Chinese: "四"}}}
+	jukuu := &static{name: "jukuu", out: []Sentence{{Chinese: "五"}}}
+
+	out, errs := Search(context.Background(), []Provider{tatoeba, failing, cache, jukuu}, Query{Q: "x", Limit: 4})
+
+	want := []string{"一/tatoeba", "二/tatoeba", "三/cache", "四/cache"}
+	if got := chinese(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("%v, not %v", got, want)
+	}
+
+	if len(errs) != 1 || errs[0] != failing.err {
+		t.Errorf("errors %v", errs)
+	}
+
+	// Duplicates and empty sentences do not count toward the limit, and none is searched after the limit is reached
+	if l := cache.calls[0].Limit; l != 4 {
+		t.Errorf("cache asked for %d, not 4", l)
+	}
+	if len(jukuu.calls) != 0 {
+		t.Errorf("jukuu searched after the limit")
+	}
+}
+
+func TestSearchUnlimited(t *testing.T) {
+	a := &static{name: "a", out: []Sentence{{Chinese: "一"}, {Chinese: "二"}}}
+	b := &static{name: "b", out: []Sentence{{Chinese: "二"}, {Chinese: "三"}}}
+
+	out, errs := Search(context.Background(), []Provider{b, a}, Query{})
+
+	want := []string{"二/b", "三/b", "一/a"}
+	if got := chinese(out); !reflect.DeepEqual(got, want) || len(errs) != 0 {
+		t.Errorf("%v, %v, not %v", got, errs, want)
+	}
+}
+
+func TestSearchOffset(t *testing.T) {
+	a := &static{name: "a", out: []Sentence{{Chinese: "一"}, {Chinese: "二"}, {Chinese: "三"}}}
+	b := &static{name: "b", out: []Sentence{{Chinese: "二"}, {Chinese: "四"}, {Chinese: "五"}}}
+
+	for _, c := range []struct {
+		offset int
+		limit  int
+		want   []string
+	}{
+		{0, 2, []string{"一/a", "二/a"}},
+		// Duplicates of b are skipped before the offset
+		{2, 2, []string{"三/a", "四/b"}},
+		{4, 2, []string{"五/b"}},
+		{6, 2, []string{}},
+		{3, 0, []string{"四/b", "五/b"}},
+	} {
+		a.calls, b.calls = nil, nil
+
+		out, errs := Search(context.Background(), []Provider{a, b}, Query{Offset: c.offset, Limit: c.limit})
+		if got := chinese(out); !reflect.DeepEqual(got, c.want) || len(errs) != 0 {
+			t.Errorf("offset %d, limit %d: %v, %v, not %v", c.offset, c.limit, got, errs, c.want)
+		}
+
+		// Providers are searched from their start, for the merged offset
+		if q := a.calls[0]; q.Offset != 0 || c.limit > 0 && q.Limit != c.offset+c.limit {
+			t.Errorf("offset %d, limit %d: a is searched at %d, up to %d", c.offset, c.limit, q.Offset, q.Limit)
+		}
+	}
+}
+
+func TestLimitedInterval(t *testing.T) {
+	var n int32
+	p := Limit(&counting{n: &n}, time.Second, 50*time.Millisecond)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := p.Search(context.Background(), Query{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first call is immediate, then each waits for the interval
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("3 calls in %v", d)
+	}
+	if n != 3 {
+		t.Errorf("%d calls, not 3", n)
+	}
+}
+
+func TestLimitedIntervalCanceled(t *testing.T) {
+	var n int32
+	p := Limit(&counting{n: &n}, time.Second, time.Hour)
+
+	if _, err := p.Search(context.Background(), Query{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := p.Search(ctx, Query{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waited for the interval: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("%d calls, not 1", n)
+	}
+}
+
+func TestLimitedTimeout(t *testing.T) {
+	p := Limit(blocking{}, 20*time.Millisecond, 0)
+
+	start := time.Now()
+	_, err := p.Search(context.Background(), Query{})
+
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.HasPrefix(err.Error(), "blocking: ") {
+		t.Errorf("error %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("timed out after %v", d)
+	}
+
+	// A timed out provider is skipped by Search
+	out, errs := Search(context.Background(), []Provider{p, &static{name: "a", out: []Sentence{{Chinese: "一"}}}}, Query{})
+	if len(out) != 1 || len(errs) != 1 {
+		t.Errorf("%v, %v", out, errs)
+	}
+}
+
+// counting is a Provider counting its calls
+type counting struct {
+	n *int32
+}
+
+func (counting) Name() string {
+	return "counting"
+}
+
+func (c *counting) Search(ctx context.Context, q Query) ([]Sentence, error) {
+	atomic.AddInt32(c.n, 1)
+	return []Sentence{}, nil
+}
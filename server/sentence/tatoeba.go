@@ -0,0 +1,91 @@
+package sentence
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/zhquiz/go-zhquiz/server/zh"
+)
+
+// Tatoeba searches the built-in sentence table of zh.db
+type Tatoeba struct {
+	DB *zh.DB
+}
+
+// Name implements Provider
+func (Tatoeba) Name() string {
+	return "tatoeba"
+}
+
+func (t Tatoeba) where(q Query) (string, map[string]interface{}) {
+	andCond := []string{"TRUE"}
+
+	cond := map[string]interface{}{
+		"q":         q.Q,
+		"levelMin":  q.LevelMin,
+		"levelMax":  q.LevelMax,
+		"lengthMin": q.LengthMin,
+		"lengthMax": q.LengthMax,
+	}
+
+	if q.LevelMin != 0 {
+		andCond = append(andCond, "[level] >= @levelMin")
+	}
+
+	if q.LevelMax != 0 {
+		andCond = append(andCond, "[level] <= @levelMax")
+	}
+
+	if q.Q != "" {
+		if like := likeQ(q.Q); like != "" {
+			cond["q"] = like
+			andCond = append(andCond, "chinese LIKE @q")
+		} else {
+			andCond = append(andCond, `id IN (
+				SELECT id FROM sentence_q WHERE sentence_q MATCH @q
+			)`)
+		}
+	} else {
+		if q.LengthMin != 0 {
+			andCond = append(andCond, "length(chinese) >= @lengthMin")
+		}
+
+		if q.LengthMax != 0 {
+			andCond = append(andCond, "length(chinese) <= @lengthMax")
+		}
+	}
+
+	return strings.Join(andCond, " AND "), cond
+}
+
+// Search implements Provider
+func (t Tatoeba) Search(ctx context.Context, q Query) ([]Sentence, error) {
+	where, cond := t.where(q)
+
+	order := "ORDER BY RANDOM()"
+	if !q.Random {
+		order = "ORDER BY level, frequency DESC"
+	}
+
+	if q.Limit > 0 {
+		order += fmt.Sprintf(" LIMIT %d OFFSET %d", q.Limit, q.Offset)
+	}
+
+	out := make([]Sentence, 0)
+
+	if r := t.DB.Current.WithContext(ctx).Raw(fmt.Sprintf(`
+	SELECT Chinese, English
+	FROM sentence
+	WHERE %s
+	%s
+	`, where, order), cond).Find(&out); r.Error != nil {
+		return nil, r.Error
+	}
+
+	for i, it := range out {
+		out[i].English = strings.Split(it.English, "\u001f")[0]
+	}
+
+	return out, nil
+}
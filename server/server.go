@@ -2,9 +2,12 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"path/filepath"
@@ -20,9 +23,51 @@ import (
 	"github.com/zhquiz/go-zhquiz/shared"
 )
 
+// Options is server options
+type Options struct {
+	// Host is the bind address, e.g. 127.0.0.1 for this machine only, or 0.0.0.0 for all interfaces
+	Host string
+	Port int
+	// Password is required of every request, if not empty
+	Password string
+}
+
+// Server is the running server
+type Server struct {
+	Engine *gin.Engine
+	HTTP   *http.Server
+	// URL is where the server can be reached from this machine
+	URL string
+}
+
+// Shutdown stops accepting connections, and waits for in-flight requests, until ctx is done.
+// Resource should be cleaned up afterwards.
+func (s *Server) Shutdown(ctx context.Context) error {
+	log.Println("Shutting down server")
+	return s.HTTP.Shutdown(ctx)
+}
+
 // Serve starts the server.
 // Runs `go func` by default.
-func Serve(res *api.Resource) *gin.Engine {
+func Serve(res *api.Resource, opts Options) *Server {
+	s := newServer(res, opts)
+
+	fmt.Printf("Server running at %s\n", s.URL)
+	if strings.HasPrefix(s.URL, "http://localhost:") {
+		fmt.Printf("Listening on all interfaces, at port %d\n", opts.Port)
+	}
+
+	go func() {
+		if err := s.HTTP.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("listen: %s\n", err)
+		}
+	}()
+
+	return s
+}
+
+// newServer builds the server, without listening
+func newServer(res *api.Resource, opts Options) *Server {
 	if !shared.IsDebug() {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -57,31 +102,32 @@ func Serve(res *api.Resource) *gin.Engine {
 	}))
 	app.Use(gin.Recovery())
 
-	app.Use(func(c *gin.Context) {
-		b, _ := ioutil.ReadAll(c.Request.Body)
+	app.Use(logBody(gin.DefaultWriter))
 
-		if len(b) > 0 {
-			c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(b))
+	if opts.Password != "" {
+		app.Use(api.AuthRequired(opts.Password))
+	}
 
-			gin.DefaultWriter.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + " body: "))
-			gin.DefaultWriter.Write(b)
-			gin.DefaultWriter.Write([]byte("\n"))
-		}
-		c.Next()
-	})
+	token, e := rand.GenerateRandomString(64)
+	if e != nil {
+		log.Fatalln(e)
+	}
 
 	serverOptions := api.Options{
-		Token: "",
+		Token:    token,
+		SkipCSRF: shared.SkipCSRF(),
 	}
 
-	if !shared.IsDebug() {
-		token, _ := rand.GenerateRandomString(64)
-		serverOptions.Token = token
+	if serverOptions.SkipCSRF {
+		log.Println("CSRF check is disabled, for debugging")
 	}
 
 	app.Use(func(c *gin.Context) {
 		if c.Request.Method == "GET" {
-			c.SetCookie("csrf_token", serverOptions.Token, 2592000, "/", "localhost", false, true)
+			// Not HttpOnly, so that the UI can echo it back in api.CSRFHeader
+			c.SetSameSite(http.SameSiteStrictMode)
+			// Host-only, so that it also works from other devices
+			c.SetCookie("csrf_token", serverOptions.Token, 2592000, "/", "", false, false)
 
 			static.Serve("/", static.LocalFile(filepath.Join(shared.ExecDir, "public"), true))(c)
 			return
@@ -91,19 +137,53 @@ func Serve(res *api.Resource) *gin.Engine {
 
 	res.Register(app, &serverOptions)
 
-	port := shared.Port()
-	fmt.Printf("Server running at http://localhost:%d\n", port)
+	addr := net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port))
+
+	localHost := opts.Host
+	switch localHost {
+	case "", "0.0.0.0", "::":
+		localHost = "localhost"
+	}
+	localURL := "http://" + net.JoinHostPort(localHost, strconv.Itoa(opts.Port))
 
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
+		Addr:    addr,
 		Handler: app,
 	}
 
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen: %s\n", err)
+	return &Server{
+		Engine: app,
+		HTTP:   srv,
+		URL:    localURL,
+	}
+}
+
+// maxLoggedBody is how much of a request body is logged, in bytes
+const maxLoggedBody = 4096
+
+// logBody writes request bodies to w, up to maxLoggedBody, except uploads.
+// Only the logged part is buffered; the rest is left to be read by handlers.
+func logBody(w io.Writer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.ContentType(), "multipart/") {
+			c.Next()
+			return
 		}
-	}()
 
-	return app
+		b, _ := ioutil.ReadAll(io.LimitReader(c.Request.Body, maxLoggedBody+1))
+
+		if len(b) > 0 {
+			c.Request.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(b), c.Request.Body))
+
+			w.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + " body: "))
+			if len(b) > maxLoggedBody {
+				w.Write(b[:maxLoggedBody])
+				w.Write([]byte(" ... (truncated)"))
+			} else {
+				w.Write(b)
+			}
+			w.Write([]byte("\n"))
+		}
+		c.Next()
+	}
 }
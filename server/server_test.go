@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhquiz/go-zhquiz/server/api"
+	"github.com/zhquiz/go-zhquiz/shared"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// prepare makes Resource in a temporary directory, with zh.db of empty tables
+func prepare(t *testing.T) api.Resource {
+	dir, err := ioutil.TempDir("", "zhquiz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	if err := os.MkdirAll(filepath.Join(dir, "assets"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "assets", "dict.txt"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	zhDB, err := gorm.Open(sqlite.Open(filepath.Join(dir, "assets", "zh.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		"CREATE TABLE token (entry, pinyin, english, frequency, hanzi_level, vocab_level)",
+		"CREATE TABLE vocab (simplified, traditional, pinyin, english, frequency, source)",
+		"CREATE TABLE sentence (id, chinese, pinyin, english, frequency, level)",
+		"CREATE TABLE library (title, entries)",
+	} {
+		if r := zhDB.Exec(stmt); r.Error != nil {
+			t.Fatal(r.Error)
+		}
+	}
+	if sqlDB, err := zhDB.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	shared.ExecDir = dir
+	os.Setenv("USER_DATA_DIR", dir)
+
+	return api.Prepare()
+}
+
+func TestShutdown(t *testing.T) {
+	res := prepare(t)
+
+	s := newServer(&res, Options{})
+
+	started := make(chan struct{})
+	var finished int32
+	s.Engine.GET("/test/slow", func(ctx *gin.Context) {
+		close(started)
+		defer atomic.StoreInt32(&finished, 1)
+		time.Sleep(200 * time.Millisecond)
+
+		// The database is still open for in-flight requests
+		if r := res.DB.Current().Exec("SELECT 1"); r.Error != nil {
+			ctx.String(500, r.Error.Error())
+			return
+		}
+		ctx.String(200, "done")
+	})
+
+	ts := httptest.NewUnstartedServer(s.Engine)
+	ts.Config = s.HTTP
+	ts.Start()
+
+	type response struct {
+		status int
+		body   string
+		err    error
+	}
+	done := make(chan response, 1)
+
+	go func() {
+		r, err := http.Get(ts.URL + "/test/slow")
+		if err != nil {
+			done <- response{err: err}
+			return
+		}
+		defer r.Body.Close()
+
+		b, err := ioutil.ReadAll(r.Body)
+		done <- response{status: r.StatusCode, body: string(b), err: err}
+	}()
+
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Shutdown waits for the in-flight request
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Error("Shutdown returned before the in-flight request finished")
+	}
+
+	select {
+	case r := <-done:
+		if r.err != nil || r.status != 200 || r.body != "done" {
+			t.Errorf("in-flight request: %d %q %v", r.status, r.body, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("in-flight request did not finish")
+	}
+
+	if _, err := http.Get(ts.URL + "/server/settings"); err == nil {
+		t.Error("still accepting requests after Shutdown")
+	}
+
+	res.Cleanup()
+
+	sqlDB, err := res.DB.Current().DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sqlDB.Ping(); err == nil {
+		t.Error("data.db is still open after Cleanup")
+	}
+}
+
+func TestLogBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var upload bytes.Buffer
+	form := multipart.NewWriter(&upload)
+	if f, err := form.CreateFormFile("file", "data.db"); err != nil {
+		t.Fatal(err)
+	} else {
+		f.Write([]byte("SQLite format 3"))
+	}
+	form.Close()
+
+	large := strings.Repeat("x", 1<<20)
+
+	for _, c := range []struct {
+		name        string
+		contentType string
+		body        string
+		// logged is the expected log, or empty if not logged
+		logged string
+	}{
+		{"json", "application/json", `{"entry":"你好"}`, `POST /test body: {"entry":"你好"}` + "\n"},
+		{"large", "application/json", large, "POST /test body: " + large[:maxLoggedBody] + " ... (truncated)\n"},
+		{"multipart", form.FormDataContentType(), upload.String(), ""},
+		{"empty", "application/json", "", ""},
+	} {
+		var log bytes.Buffer
+		var read string
+
+		r := gin.New()
+		r.Use(logBody(&log))
+		r.POST("/test", func(ctx *gin.Context) {
+			b, _ := ioutil.ReadAll(ctx.Request.Body)
+			read = string(b)
+		})
+
+		req := httptest.NewRequest("POST", "/test", strings.NewReader(c.body))
+		req.Header.Set("Content-Type", c.contentType)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		if log.String() != c.logged {
+			t.Errorf("%s: logged %.100q, not %.100q", c.name, log.String(), c.logged)
+		}
+
+		// Handlers still read the whole body
+		if read != c.body {
+			t.Errorf("%s: handler read %d bytes, not %d", c.name, len(read), len(c.body))
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package tts
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// Cache saves audio of another TTS on disk, e.g. for offline use
+type Cache struct {
+	TTS TTS
+	Dir string
+	// Key identifies the settings of TTS, so that changing voice doesn't hit old cache
+	Key string
+}
+
+// Speak implements TTS
+func (c *Cache) Speak(ctx context.Context, text string) (*Audio, error) {
+	h := sha1.Sum([]byte(c.Key + "\x00" + text))
+	name := filepath.Join(c.Dir, hex.EncodeToString(h[:]))
+
+	if matches, _ := filepath.Glob(name + ".*"); len(matches) > 0 {
+		if data, err := ioutil.ReadFile(matches[0]); err == nil {
+			return &Audio{
+				ContentType: contentTypes[filepath.Ext(matches[0])],
+				Data:        data,
+			}, nil
+		}
+	}
+
+	a, err := c.TTS.Speak(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	// Failing to write cache doesn't fail speaking
+	if err := os.MkdirAll(c.Dir, 0755); err == nil {
+		ioutil.WriteFile(name+extension(a.ContentType), a.Data, 0644)
+	}
+
+	return a, nil
+}
+
+var contentTypes = map[string]string{
+	".mp3": "audio/mpeg",
+	".ogg": "audio/ogg",
+	".wav": "audio/wav",
+	".bin": "application/octet-stream",
+}
+
+func extension(contentType string) string {
+	t, _, _ := mime.ParseMediaType(contentType)
+
+	switch t {
+	case "audio/mpeg", "audio/mp3":
+		return ".mp3"
+	case "audio/ogg":
+		return ".ogg"
+	case "audio/wav", "audio/x-wav", "audio/wave":
+		return ".wav"
+	}
+
+	return ".bin"
+}
@@ -0,0 +1,78 @@
+package tts
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zhquiz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	f := &fake{audio: &Audio{ContentType: "audio/mpeg", Data: []byte("mp3")}}
+	c := &Cache{TTS: f, Dir: dir, Key: "google"}
+
+	for i := 0; i < 2; i++ {
+		a, err := c.Speak(ctx, "你好")
+		if err != nil || string(a.Data) != "mp3" || a.ContentType != "audio/mpeg" {
+			t.Fatalf("%v, %v", a, err)
+		}
+	}
+	if len(f.calls) != 1 {
+		t.Errorf("spoke %d times, not once, then from cache", len(f.calls))
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.mp3"))
+	if len(files) != 1 {
+		t.Errorf("cached as %v", files)
+	}
+
+	// Other settings, or other text, are not cached
+	other := &Cache{TTS: f, Dir: dir, Key: "local"}
+	if _, err := other.Speak(ctx, "你好"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Speak(ctx, "再见"); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.calls) != 3 {
+		t.Errorf("spoke %d times, not 3", len(f.calls))
+	}
+
+	// Errors are not cached
+	f.err = os.ErrNotExist
+	if _, err := c.Speak(ctx, "谢谢"); err == nil {
+		t.Error("error is not returned")
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 3 {
+		t.Errorf("cached %v", files)
+	}
+}
+
+func TestExtension(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{"audio/mpeg", ".mp3"},
+		{"audio/mp3", ".mp3"},
+		{"audio/ogg; codecs=opus", ".ogg"},
+		{"audio/wav", ".wav"},
+		{"audio/x-wav", ".wav"},
+		{"text/html", ".bin"},
+		{"", ".bin"},
+	} {
+		if out := extension(c.in); out != c.want {
+			t.Errorf("%q is %q, not %q", c.in, out, c.want)
+		}
+
+		// and back
+		if ct := contentTypes[extension(c.in)]; ct == "" {
+			t.Errorf("%q has no content type", extension(c.in))
+		}
+	}
+}
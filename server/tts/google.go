@@ -0,0 +1,66 @@
+package tts
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Google proxies translate.google.com/translate_tts. Requires internet connection.
+type Google struct {
+	Client *http.Client
+}
+
+// NewGoogle creates Google TTS, with a timeout
+func NewGoogle() Google {
+	return Google{
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Speak implements TTS
+func (g Google) Speak(ctx context.Context, text string) (*Audio, error) {
+	params := url.Values{}
+	params.Add("ie", "UTF-8")
+	params.Add("tl", "zh-CN")
+	params.Add("q", text)
+	params.Add("total", "1")
+	params.Add("idx", "0")
+	params.Add("client", "tw-ob")
+	params.Add("textlen", strconv.Itoa(len(text)))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("http://translate.google.com/translate_tts?%s", params.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Referrer", "http://translate.google.com/")
+	req.Header.Add("User-Agent", getUserAgent())
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded;charset=utf-8")
+
+	response, err := g.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return nil, fmt.Errorf("google tts: %s", response.Status)
+	}
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Audio{
+		ContentType: response.Header.Get("Content-Type"),
+		Data:        data,
+	}, nil
+}
@@ -0,0 +1,132 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Local runs an offline engine as subprocess, i.e. espeak-ng, or piper with a Chinese voice model
+type Local struct {
+	// Command is one of Engines, found in PATH. As it is set by API clients, it cannot be a path.
+	Command string
+	// Path is the engine executable, set by whoever runs the server, e.g. by ZHQUIZ_TTS_COMMAND.
+	// It is used instead of Command, if not empty.
+	Path    string
+	Voice   string
+	Timeout time.Duration
+}
+
+// Engines are the local engines that Command may name
+var Engines = []string{"espeak-ng", "espeak", "piper"}
+
+// NewLocal creates Local TTS. Empty command finds espeak-ng, then espeak, in PATH.
+func NewLocal(command string, voice string) Local {
+	return Local{
+		Command: command,
+		Voice:   voice,
+		Timeout: 10 * time.Second,
+	}
+}
+
+// Speak implements TTS, outputting WAV
+func (l Local) Speak(ctx context.Context, text string) (*Audio, error) {
+	command, err := l.lookPath()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, l.Timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	out := ""
+
+	switch engine(command) {
+	case "piper":
+		if l.Voice == "" {
+			return nil, errors.New("piper requires a voice model")
+		}
+
+		tmp, err := ioutil.TempFile("", "zhquiz-*.wav")
+		if err != nil {
+			return nil, err
+		}
+		tmp.Close()
+		out = tmp.Name()
+		defer os.Remove(out)
+
+		cmd = exec.CommandContext(ctx, command, "--model", l.Voice, "--output_file", out)
+		cmd.Stdin = strings.NewReader(text)
+	default:
+		voice := l.Voice
+		if voice == "" {
+			voice = "cmn"
+		}
+
+		// Text is passed by stdin, so that it cannot be taken as options
+		cmd = exec.CommandContext(ctx, command, "-v", voice, "--stdout", "--stdin")
+		cmd.Stdin = strings.NewReader(text)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", filepath.Base(command), err, strings.TrimSpace(stderr.String()))
+	}
+
+	data := stdout.Bytes()
+	if out != "" {
+		if data, err = ioutil.ReadFile(out); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%s: no audio output", filepath.Base(command))
+	}
+
+	return &Audio{
+		ContentType: "audio/wav",
+		Data:        data,
+	}, nil
+}
+
+func (l Local) lookPath() (string, error) {
+	if l.Path != "" {
+		return exec.LookPath(l.Path)
+	}
+
+	if l.Command != "" {
+		for _, c := range Engines {
+			if l.Command == c {
+				return exec.LookPath(c)
+			}
+		}
+
+		return "", fmt.Errorf("TTS command must be one of %s, not %q", strings.Join(Engines, ", "), l.Command)
+	}
+
+	for _, c := range Engines[:2] {
+		if p, err := exec.LookPath(c); err == nil {
+			return p, nil
+		}
+	}
+
+	return "", errors.New("no local TTS engine found, please install espeak-ng")
+}
+
+// engine is the name of executable, without extension
+func engine(command string) string {
+	base := filepath.Base(command)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
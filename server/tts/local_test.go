@@ -0,0 +1,72 @@
+package tts
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestEngine(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{"espeak-ng", "espeak-ng"},
+		{"/usr/bin/espeak", "espeak"},
+		{"/opt/piper/piper", "piper"},
+		{"piper.exe", "piper"},
+	} {
+		if out := engine(c.in); out != c.want {
+			t.Errorf("%q is %q, not %q", c.in, out, c.want)
+		}
+	}
+}
+
+func TestLookPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake engines are shell scripts")
+	}
+
+	dir, err := ioutil.TempDir("", "zhquiz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"espeak", "piper", "sh"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir)
+	defer os.Setenv("PATH", path)
+
+	for _, c := range []struct {
+		name string
+		l    Local
+		// want is the base name found, or empty if rejected
+		want string
+	}{
+		{"default", Local{}, "espeak"},
+		{"piper", Local{Command: "piper"}, "piper"},
+		{"not found", Local{Command: "espeak-ng"}, ""},
+		{"not an engine", Local{Command: "sh"}, ""},
+		{"path", Local{Command: filepath.Join(dir, "sh")}, ""},
+		{"relative path", Local{Command: "../" + filepath.Base(dir) + "/piper"}, ""},
+		{"path of engine", Local{Command: filepath.Join(dir, "piper")}, ""},
+		{"path by operator", Local{Command: "espeak", Path: filepath.Join(dir, "piper")}, "piper"},
+	} {
+		p, err := c.l.lookPath()
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("%s: found %q", c.name, p)
+			}
+			continue
+		}
+
+		if err != nil || filepath.Base(p) != c.want {
+			t.Errorf("%s: %q, %v, not %s", c.name, p, err, c.want)
+		}
+	}
+}
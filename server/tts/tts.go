@@ -0,0 +1,85 @@
+package tts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/zhquiz/go-zhquiz/shared"
+)
+
+// Audio is synthesized speech
+type Audio struct {
+	ContentType string
+	Data        []byte
+}
+
+// TTS synthesizes Chinese text to speech
+type TTS interface {
+	Speak(ctx context.Context, text string) (*Audio, error)
+}
+
+// Settings chooses TTS provider, stored in UserMeta
+type Settings struct {
+	// Provider is local, google, or empty for local, then falling back to google
+	Provider string `json:"provider"`
+	// Command is the local engine, i.e. espeak-ng, espeak or piper, found in PATH.
+	// ZHQUIZ_TTS_COMMAND overrides it, e.g. with a path.
+	Command string `json:"command" binding:"omitempty,oneof=espeak-ng espeak piper"`
+	// Voice is espeak-ng voice, or piper model (.onnx)
+	Voice string `json:"voice"`
+	// NoCache disables caching audio in MediaPath
+	NoCache bool `json:"noCache"`
+}
+
+// New creates TTS from Settings, cached on disk unless disabled
+func New(s Settings) TTS {
+	var t TTS
+
+	local := NewLocal(s.Command, s.Voice)
+	local.Path = shared.TTSCommand()
+
+	switch s.Provider {
+	case "local":
+		t = local
+	case "google":
+		t = NewGoogle()
+	default:
+		t = Fallback{local, NewGoogle()}
+	}
+
+	if s.NoCache {
+		return t
+	}
+
+	return &Cache{
+		TTS: t,
+		Dir: filepath.Join(shared.MediaPath(), "tts"),
+		Key: strings.Join([]string{s.Provider, s.Command, local.Path, s.Voice}, "\x00"),
+	}
+}
+
+// Fallback tries each TTS in order, until one succeeds
+type Fallback []TTS
+
+// Speak implements TTS
+func (f Fallback) Speak(ctx context.Context, text string) (*Audio, error) {
+	errs := make([]string, 0)
+
+	for _, t := range f {
+		a, err := t.Speak(ctx, text)
+		if err == nil {
+			return a, nil
+		}
+
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) == 0 {
+		return nil, errors.New("no TTS provider")
+	}
+
+	return nil, fmt.Errorf("all TTS providers failed: %s", strings.Join(errs, "; "))
+}
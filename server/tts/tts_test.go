@@ -0,0 +1,90 @@
+package tts
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fake is a TTS of fixed audio, or of an error
+type fake struct {
+	audio *Audio
+	err   error
+	// calls are the texts spoken
+	calls []string
+}
+
+func (f *fake) Speak(ctx context.Context, text string) (*Audio, error) {
+	f.calls = append(f.calls, text)
+	return f.audio, f.err
+}
+
+func TestFallback(t *testing.T) {
+	wav := &Audio{ContentType: "audio/wav", Data: []byte("wav")}
+	mp3 := &Audio{ContentType: "audio/mpeg", Data: []byte("mp3")}
+
+	for _, c := range []struct {
+		name string
+		ttss []*fake
+		want *Audio
+		// calls are the number of calls of each TTS
+		calls []int
+		err   string
+	}{
+		{"first", []*fake{{audio: wav}, {audio: mp3}}, wav, []int{1, 0}, ""},
+		{"second", []*fake{{err: errors.New("no espeak")}, {audio: mp3}}, mp3, []int{1, 1}, ""},
+		{"none", []*fake{{err: errors.New("no espeak")}, {err: errors.New("offline")}}, nil, []int{1, 1}, "no espeak; offline"},
+		{"empty", []*fake{}, nil, []int{}, "no TTS provider"},
+	} {
+		f := Fallback{}
+		for _, it := range c.ttss {
+			f = append(f, it)
+		}
+
+		a, err := f.Speak(context.Background(), "你好")
+		if a != c.want || (err == nil) != (c.err == "") || (err != nil && !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: %v, %v", c.name, a, err)
+		}
+
+		calls := make([]int, 0)
+		for _, it := range c.ttss {
+			calls = append(calls, len(it.calls))
+		}
+		if !reflect.DeepEqual(calls, c.calls) {
+			t.Errorf("%s: calls %v, not %v", c.name, calls, c.calls)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	os.Unsetenv("ZHQUIZ_TTS_COMMAND")
+
+	if _, ok := New(Settings{Provider: "local", NoCache: true}).(Local); !ok {
+		t.Error("local is not Local")
+	}
+
+	if _, ok := New(Settings{Provider: "google", NoCache: true}).(Google); !ok {
+		t.Error("google is not Google")
+	}
+
+	if f, ok := New(Settings{NoCache: true}).(Fallback); !ok || len(f) != 2 {
+		t.Error("default is not Fallback of local, then google")
+	} else {
+		if _, ok := f[0].(Local); !ok {
+			t.Error("default does not try local first")
+		}
+		if _, ok := f[1].(Google); !ok {
+			t.Error("default does not fall back to google")
+		}
+	}
+
+	os.Setenv("ZHQUIZ_TTS_COMMAND", "/opt/piper/piper")
+	defer os.Unsetenv("ZHQUIZ_TTS_COMMAND")
+
+	if l := New(Settings{Provider: "local", Command: "espeak", NoCache: true}).(Local); l.Path != "/opt/piper/piper" {
+		t.Errorf("ZHQUIZ_TTS_COMMAND is not used, but %q", l.Path)
+	}
+}
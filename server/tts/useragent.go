@@ -1,4 +1,4 @@
-package api
+package tts
 
 import (
 	"math/rand"
@@ -30,3 +30,13 @@ func Connect() DB {
 		Current: db,
 	}
 }
+
+// Close closes the database
+func (d DB) Close() error {
+	sqlDB, err := d.Current.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
+}
@@ -1,20 +1,79 @@
 package shared
 
 import (
+	"fmt"
+	"net/url"
 	"os/exec"
 	"runtime"
 	"strings"
 )
 
-// OpenURL opens specified URL in the default web browser
-func OpenURL(u string) {
-	switch runtime.GOOS {
-	case "linux":
-		exec.Command("xdg-open", u).Run()
-	case "darwin":
-		exec.Command("open", u).Run()
+// OpenURL opens specified URL in the default web browser.
+// The URL should be checked with ParseOpenURL first.
+func OpenURL(u string) error {
+	name, args := openURLCommand(runtime.GOOS, u)
+	if name == "" {
+		return fmt.Errorf("cannot open URL on %s", runtime.GOOS)
+	}
+
+	return exec.Command(name, args...).Run()
+}
+
+// openURLCommand builds the command to open URL, per OS.
+// No shell is involved, so URL needs no escaping.
+func openURLCommand(goos string, u string) (string, []string) {
+	switch goos {
 	case "windows":
-		r := strings.NewReplacer("&", "^&")
-		exec.Command("cmd", "/c", "start", r.Replace(u)).Run()
+		return "rundll32", []string{"url.dll,FileProtocolHandler", u}
+	case "darwin":
+		return "open", []string{u}
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return "xdg-open", []string{u}
 	}
+
+	return "", nil
+}
+
+// OpenURLHosts gets hosts allowed by ParseOpenURL, including their subdomains
+func OpenURLHosts() []string {
+	hosts := make([]string, 0)
+
+	for _, h := range strings.Split(getenvOrSetDefault(
+		"ZHQUIZ_OPEN_URL_HOSTS",
+		"forvo.com,mdbg.net,wiktionary.org,zhquiz.cc,github.com,jukuu.com",
+	), ",") {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+
+	return hosts
+}
+
+// ParseOpenURL parses and validates URL to be opened by OpenURL,
+// allowing only http(s) to OpenURLHosts
+func ParseOpenURL(raw string) (*url.URL, error) {
+	u, e := url.Parse(raw)
+	if e != nil {
+		return nil, e
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("scheme not allowed: %q", u.Scheme)
+	}
+
+	if u.User != nil {
+		return nil, fmt.Errorf("userinfo not allowed")
+	}
+
+	host := strings.ToLower(u.Hostname())
+
+	for _, h := range OpenURLHosts() {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return u, nil
+		}
+	}
+
+	return nil, fmt.Errorf("host not allowed: %q", host)
 }
@@ -2,9 +2,11 @@ package shared
 
 import (
 	"log"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 )
 
 // UserDataDir is used to store all writable data
@@ -22,7 +24,7 @@ func MediaPath() string {
 	mediaPath := filepath.Join(UserDataDir(), "_media")
 	_, err := os.Stat(mediaPath)
 	if os.IsNotExist(err) {
-		if err := os.Mkdir(mediaPath, 0644); err != nil {
+		if err := os.Mkdir(mediaPath, 0755); err != nil {
 			log.Fatalln(err)
 		}
 	}
@@ -42,11 +44,71 @@ func Port() int {
 	return defaultPort
 }
 
+// Host gets server bind address, defaulting to loopback only
+func Host() string {
+	return getenvOrSetDefault("ZHQUIZ_HOST", "127.0.0.1")
+}
+
+// IsLoopback is whether host, as a bind address, is reachable from this machine only.
+// Host names other than localhost are not, as they may resolve to any interface.
+func IsLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Password gets the password (or token) required by --serve mode, or by any host not IsLoopback
+func Password() string {
+	return os.Getenv("ZHQUIZ_PASSWORD")
+}
+
+// TTSCommand is the local TTS engine, e.g. a path to piper, overriding user settings, which can only name one in PATH
+func TTSCommand() string {
+	return os.Getenv("ZHQUIZ_TTS_COMMAND")
+}
+
+// Fsck decides whether to check FTS tables on startup, i.e. "check", "repair" or empty for neither
+func Fsck() string {
+	return os.Getenv("ZHQUIZ_FSCK")
+}
+
+// BackupInterval is how often data.db is backed up while running, or 0 for only on startup
+func BackupInterval() time.Duration {
+	defaultInterval := 24 * time.Hour
+
+	d, e := time.ParseDuration(getenvOrSetDefault("ZHQUIZ_BACKUP_INTERVAL", defaultInterval.String()))
+	if e != nil || d < 0 {
+		return defaultInterval
+	}
+
+	return d
+}
+
+// BackupKeep is the number of backups of data.db to keep, oldest deleted first
+func BackupKeep() int {
+	defaultKeep := 10
+
+	if n, e := strconv.Atoi(getenvOrSetDefault("ZHQUIZ_BACKUP_KEEP", strconv.Itoa(defaultKeep))); e == nil && n > 0 {
+		return n
+	}
+
+	return defaultKeep
+}
+
 // IsDebug decides whether to run in debug mode (e.g. development server)
 func IsDebug() bool {
 	return os.Getenv("DEBUG") != ""
 }
 
+// SkipCSRF decides whether API requests skip the CSRF check, so that the UI development server can call the API.
+// It needs both DEBUG and ZHQUIZ_SKIP_CSRF.
+func SkipCSRF() bool {
+	return IsDebug() && os.Getenv("ZHQUIZ_SKIP_CSRF") != ""
+}
+
 // IsChromeApp decides whether to run in Chrome App (i.e. windowed mode)
 func IsChromeApp() bool {
 	return getenvOrSetDefault("ZHQUIZ_CHROME_APP", "1") != "0"
@@ -0,0 +1,49 @@
+package shared
+
+import (
+	"os"
+	"testing"
+)
+
+func TestIsLoopback(t *testing.T) {
+	for _, c := range []struct {
+		host string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"127.1.2.3", true},
+		{"::1", true},
+		{"localhost", true},
+		{"", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"192.168.1.2", false},
+		{"example.com", false},
+	} {
+		if out := IsLoopback(c.host); out != c.want {
+			t.Errorf("%q is %v", c.host, out)
+		}
+	}
+}
+
+func TestSkipCSRF(t *testing.T) {
+	defer os.Unsetenv("DEBUG")
+	defer os.Unsetenv("ZHQUIZ_SKIP_CSRF")
+
+	for _, c := range []struct {
+		debug, skip string
+		want        bool
+	}{
+		{"", "", false},
+		{"1", "", false},
+		{"", "1", false},
+		{"1", "1", true},
+	} {
+		os.Setenv("DEBUG", c.debug)
+		os.Setenv("ZHQUIZ_SKIP_CSRF", c.skip)
+
+		if out := SkipCSRF(); out != c.want {
+			t.Errorf("DEBUG=%q ZHQUIZ_SKIP_CSRF=%q is %v", c.debug, c.skip, out)
+		}
+	}
+}
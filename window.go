@@ -0,0 +1,85 @@
+//go:build !headless
+// +build !headless
+
+package main
+
+/*
+#cgo darwin LDFLAGS: -framework CoreGraphics
+#cgo linux pkg-config: x11
+#if defined(__APPLE__)
+#include <CoreGraphics/CGDisplayConfiguration.h>
+int display_width() {
+	return CGDisplayPixelsWide(CGMainDisplayID());
+}
+int display_height() {
+	return CGDisplayPixelsHigh(CGMainDisplayID());
+}
+#elif defined(_WIN32)
+#include <wtypes.h>
+int display_width() {
+	RECT desktop;
+	const HWND hDesktop = GetDesktopWindow();
+	GetWindowRect(hDesktop, &desktop);
+	return desktop.right;
+}
+int display_height() {
+	RECT desktop;
+	const HWND hDesktop = GetDesktopWindow();
+	GetWindowRect(hDesktop, &desktop);
+	return desktop.bottom;
+}
+#else
+#include <X11/Xlib.h>
+// Returns 0 if there is no X display, e.g. over SSH
+int display_width() {
+	Display* d = XOpenDisplay(NULL);
+	if (d == NULL) {
+		return 0;
+	}
+	Screen*  s = DefaultScreenOfDisplay(d);
+	int w = s->width - 50;
+	XCloseDisplay(d);
+	return w;
+}
+int display_height() {
+	Display* d = XOpenDisplay(NULL);
+	if (d == NULL) {
+		return 0;
+	}
+	Screen*  s = DefaultScreenOfDisplay(d);
+	int h = s->height - 50;
+	XCloseDisplay(d);
+	return h;
+}
+#endif
+*/
+import "C"
+import (
+	"errors"
+	"os"
+
+	"github.com/webview/webview"
+)
+
+// openWindow opens url in webview, until the window is closed or quit
+func openWindow(url string, quit <-chan os.Signal) error {
+	width, height := int(C.display_width()), int(C.display_height())
+	if width <= 0 || height <= 0 {
+		return errors.New("cannot open display, try --serve")
+	}
+
+	w := webview.New(true)
+	defer w.Destroy()
+
+	w.SetSize(width, height, webview.HintNone)
+	w.SetTitle("ZhQuiz")
+	w.Navigate(url + "/etabs.html")
+
+	go func() {
+		<-quit
+		w.Dispatch(w.Terminate)
+	}()
+
+	w.Run()
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build headless
+// +build headless
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// openWindow is unavailable without webview, i.e. built with `-tags headless`
+func openWindow(url string, quit <-chan os.Signal) error {
+	return errors.New("built without webview, try --serve")
+}